@@ -0,0 +1,33 @@
+package main
+
+import "gosync/pkg/filter"
+
+// ruleFlag is a repeatable flag appending its rules to a list shared with the other rule flags,
+// so the rules keep the order of the command line.
+type ruleFlag struct {
+	rules *[]filter.Rule
+	parse func(value string) ([]filter.Rule, error)
+}
+
+func (f ruleFlag) String() string {
+	return ""
+}
+
+func (f ruleFlag) Set(value string) error {
+	rules, err := f.parse(value)
+	if err != nil {
+		return err
+	}
+	*f.rules = append(*f.rules, rules...)
+	return nil
+}
+
+func singleRule(newRule func(pattern string) (filter.Rule, error)) func(string) ([]filter.Rule, error) {
+	return func(pattern string) ([]filter.Rule, error) {
+		rule, err := newRule(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return []filter.Rule{rule}, nil
+	}
+}
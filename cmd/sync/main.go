@@ -1,24 +1,81 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"gosync/pkg/directory"
+	syncFile "gosync/pkg/file"
+	"gosync/pkg/filter"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 )
 
 var Version = "0.1.dev"
 
 func main() {
-	var source, destination string
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		runVerify(os.Args[2:])
+		return
+	}
+
+	var source, destination, compare, preserve, ignoreFile, stateFile, conflict, backupDir, verify, indexFile, journalFile, copyMethod string
+	var fifos, sockets, devices, symlinks string
+	var dryRun, atomic, delta, deleteExcluded, noDelete, stats, jsonOutput, keepGoing, watch, twoWay, rescan, hardLinks, sparse, detectMoves bool
+	var maxErrors, keepBackups, maxDelete int
+	var maxDeletePercent float64
+	var debounce, backupMaxAge time.Duration
+	var rules []filter.Rule
 
 	flag.StringVar(&source, "s", "", "The source folder to synchronize")
 	flag.StringVar(&destination, "d", "", "The destination folder to synchronize")
+	flag.BoolVar(&dryRun, "n", false, "Print the actions of the synchronization without modifying the destination folder")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the actions of the synchronization without modifying the destination folder")
+	flag.StringVar(&preserve, "p", syncFile.DefaultAttributes.String(), "The comma separated attributes preserved on copy: mode, times, owner (root only), xattrs, trusted, acls, security or none")
+	flag.BoolVar(&atomic, "atomic", true, "Copy the files through a temporary file renamed over the destination file, use -atomic=false to write in place")
+	flag.BoolVar(&delta, "delta", false, "Only write the blocks of the modified files that changed, for large files with small changes")
+	flag.BoolVar(&sparse, "sparse", false, "Skip the blocks of zeros of the copied files so they become holes at the destination, the holes of the source are always kept")
+	flag.BoolVar(&detectMoves, "detect-moves", false, "Move the files renamed or moved in the source at the destination instead of copying them again")
+	flag.BoolVar(&hardLinks, "hard-links", false, "Recreate the hard links of the source files at the destination instead of copying each link")
+	flag.StringVar(&symlinks, "symlinks", directory.PreserveLinks.String(), "How the symlinks of the source are synchronized: preserve, follow (or copy-target), skip, rewrite-relative or safe-links")
+	flag.StringVar(&fifos, "fifos", directory.SkipSpecial.String(), "How the named pipes of the source are synchronized: skip with a warning, recreate or error")
+	flag.StringVar(&sockets, "sockets", directory.SkipSpecial.String(), "How the sockets of the source are synchronized: skip with a warning, recreate or error")
+	flag.StringVar(&devices, "devices", directory.SkipSpecial.String(), "How the device nodes of the source are synchronized: skip with a warning, recreate (root only) or error")
+	flag.StringVar(&copyMethod, "copy-method", "", "Copy the files with the kernel copy paths: auto, reflink, copy-file-range, sendfile or buffered, each one falls back to the next")
+	flag.StringVar(&verify, "verify", "", "Hash every copied file and its source to verify the copy: sha256, sha512, blake2b, crc64 or xxhash")
+	flag.Var(ruleFlag{&rules, singleRule(filter.Include)}, "include", "A pattern of entries to include even if excluded by a previous rule, can be repeated")
+	flag.Var(ruleFlag{&rules, singleRule(filter.Exclude)}, "exclude", "A pattern of entries to exclude, can be repeated")
+	flag.Var(ruleFlag{&rules, filter.ReadRulesFile}, "exclude-from", "A file of exclude patterns with the gitignore syntax, can be repeated")
+	flag.StringVar(&ignoreFile, "ignore-file", filter.DefaultIgnoreFile, "The name of the per-directory files of exclude patterns, empty to disable them")
+	flag.BoolVar(&deleteExcluded, "delete-excluded", false, "Delete the excluded entries from the destination folder")
+	flag.BoolVar(&noDelete, "no-delete", false, "Never delete the destination entries that don't exist in the source")
+	flag.IntVar(&maxDelete, "max-delete", 0, "Abort before any change when the synchronization would delete more entries, 0 means no limit")
+	flag.Float64Var(&maxDeletePercent, "max-delete-percent", 0, "Abort before any change when the synchronization would delete more than this percentage of the destination entries, 0 means no limit")
+	flag.BoolVar(&keepGoing, "keep-going", false, "Record the failure of a directory and continue with the rest of the tree instead of stopping")
+	flag.IntVar(&maxErrors, "max-errors", 0, "The number of errors after which the synchronization stops, 0 means no limit")
+	flag.BoolVar(&stats, "stats", false, "Print the statistics of the synchronization")
+	flag.BoolVar(&jsonOutput, "json", false, "Print the report of the synchronization in JSON")
+	flag.BoolVar(&watch, "watch", false, "Keep mirroring the changes of the source folder until interrupted (Linux only)")
+	flag.DurationVar(&debounce, "debounce", 500*time.Millisecond, "In watch mode, how long to wait without any new change before synchronizing")
+	flag.BoolVar(&twoWay, "two-way", false, "Propagate the changes made on both sides since the last synchronization")
+	flag.StringVar(&stateFile, "state", "", "In two-way mode, the state file of the last synchronization (default <destination>/"+directory.DefaultStateFile+")")
+	flag.StringVar(&conflict, "conflict", directory.NewerWins.String(), "In two-way mode, how the entries changed on both sides are resolved: newer, source or keep-both")
+	flag.StringVar(&backupDir, "backup-dir", "", "Move the deleted and overwritten entries into a timestamped generation of this directory instead of removing them")
+	flag.IntVar(&keepBackups, "keep-backups", 0, "The number of backup generations kept, the older ones are pruned, 0 keeps them all")
+	flag.DurationVar(&backupMaxAge, "backup-max-age", 0, "The age after which the backup generations are pruned, such as 720h, 0 keeps them all")
+	flag.StringVar(&indexFile, "index", "", "Keep the state of the destination folder in this file and trust it instead of reading the destination")
+	flag.BoolVar(&rescan, "rescan", false, "Scan the destination folder instead of trusting the index, report the drifted entries and rebuild the index")
+	flag.StringVar(&journalFile, "journal", "", "Record the progress of the synchronization in this file so an interrupted synchronization is resumed by the next one")
+	flag.StringVar(&compare, "c", "quick", "The change detection strategy for existing files: quick (size and modification time), hash or always")
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), `Sync v%s that synchronizes two directories: a source directory and a destination directory.`, Version)
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s, or %s verify to compare two directories:\n", os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 
@@ -29,24 +86,287 @@ func main() {
 		os.Exit(-1)
 	}
 
-	ds := directory.NewSynchronizer(source, destination, directory.MaxGoroutine(40))
+	changeDetector, err := newChangeDetector(compare)
+	if err != nil {
+		fmt.Println(err)
+		flag.PrintDefaults()
+		os.Exit(-1)
+	}
 
-	err := ds.Sync()
+	attributes, err := syncFile.ParseAttributes(preserve)
 	if err != nil {
+		fmt.Println(err)
+		flag.PrintDefaults()
+		os.Exit(-1)
+	}
 
-		var cpErr *directory.CopyError
-		if errors.As(err, &cpErr) {
-			fmt.Printf("Process ended with errors:\n%s\n", cpErr.Error())
-			os.Exit(1)
+	var verifyAlgorithm syncFile.HashAlgorithm
+	if verify != "" {
+		if verifyAlgorithm, err = syncFile.ParseHashAlgorithm(verify); err != nil {
+			fmt.Println(err)
+			flag.PrintDefaults()
+			os.Exit(-1)
 		}
+	}
 
+	var method syncFile.CopyMethod
+	if copyMethod != "" {
+		if method, err = syncFile.ParseCopyMethod(copyMethod); err != nil {
+			fmt.Println(err)
+			flag.PrintDefaults()
+			os.Exit(-1)
+		}
+	}
+
+	conflictPolicy, err := directory.ParseConflictPolicy(conflict)
+	if err != nil {
 		fmt.Println(err)
+		flag.PrintDefaults()
+		os.Exit(-1)
+	}
+	symlinkPolicy, err := directory.ParseSymlinkPolicy(symlinks)
+	if err != nil {
+		fmt.Println(err)
+		flag.PrintDefaults()
+		os.Exit(-1)
+	}
+	specialPolicies := make(map[directory.SpecialFileType]directory.SpecialFilePolicy)
+	for t, name := range map[directory.SpecialFileType]string{directory.NamedPipe: fifos, directory.Socket: sockets, directory.Device: devices} {
+		if specialPolicies[t], err = directory.ParseSpecialFilePolicy(name); err != nil {
+			fmt.Println(err)
+			flag.PrintDefaults()
+			os.Exit(-1)
+		}
+	}
+	if maxDeletePercent < 0 || maxDeletePercent > 100 {
+		fmt.Println("-max-delete-percent must be between 0 and 100")
+		os.Exit(-1)
+	}
+	if twoWay && watch {
+		fmt.Println("-two-way cannot be combined with -watch")
+		os.Exit(-1)
+	}
 
-		var inputErr *directory.InputError
-		if errors.As(err, &inputErr) {
-			os.Exit(2)
+	opts := []directory.SynchronizerOption{
+		directory.MaxGoroutine(40),
+		directory.ChangeDetection(changeDetector),
+		directory.PreserveAttributes(attributes),
+		directory.AtomicCopy(atomic),
+		directory.DeltaTransfer(delta),
+		directory.SparseFiles(sparse),
+		directory.PreserveHardLinks(hardLinks),
+		directory.DetectMoves(detectMoves),
+		directory.Symlinks(symlinkPolicy),
+		directory.SpecialFiles(directory.NamedPipe, specialPolicies[directory.NamedPipe]),
+		directory.SpecialFiles(directory.Socket, specialPolicies[directory.Socket]),
+		directory.SpecialFiles(directory.Device, specialPolicies[directory.Device]),
+		directory.VerifyCopies(verifyAlgorithm),
+		directory.Filter(filter.New(ignoreFile, rules...)),
+		directory.DeleteExcluded(deleteExcluded),
+		directory.NoDelete(noDelete),
+		directory.MaxDelete(maxDelete),
+		directory.MaxDeletePercent(maxDeletePercent),
+		directory.ContinueOnError(keepGoing),
+		directory.MaxErrors(maxErrors),
+		directory.WatchDebounce(debounce),
+		directory.OnConflict(conflictPolicy),
+		directory.BackupDir(backupDir),
+		directory.KeepBackups(keepBackups),
+		directory.BackupMaxAge(backupMaxAge),
+		directory.DestinationIndex(indexFile),
+		directory.RescanIndex(rescan),
+		directory.Journal(journalFile),
+	}
+	if copyMethod != "" {
+		opts = append(opts, directory.FastCopy(method))
+	}
+	var ds interface {
+		Plan() (directory.Plan, error)
+		SyncContext(ctx context.Context) (*directory.Report, error)
+	}
+	if twoWay {
+		if stateFile == "" {
+			stateFile = filepath.Join(destination, directory.DefaultStateFile)
 		}
+		ds = directory.NewTwoWaySynchronizer(source, destination, stateFile, opts...)
+	} else {
+		ds = directory.NewSynchronizer(source, destination, opts...)
+	}
 
+	if dryRun {
+		plan, err := ds.Plan()
+		printPlan(plan)
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if watch {
+		w := directory.NewWatcher(source, destination, opts...)
+		err := w.Watch(ctx, func(report *directory.Report, err error) {
+			printSyncResult(report, err, stats, jsonOutput)
+		})
+		var cancelErr *directory.CanceledError
+		if err != nil && !errors.As(err, &cancelErr) {
+			exitWithError(err)
+		}
+		return
+	}
+
+	report, err := ds.SyncContext(ctx)
+	stop()
+
+	if jsonOutput {
+		printJSONReport(report, err)
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+	if stats {
+		fmt.Println(report)
+	} else {
+		printWarnings(report)
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+}
+
+// printSyncResult prints the result of a synchronization of the watch mode, the failures don't stop the watch.
+func printSyncResult(report *directory.Report, err error, stats, jsonOutput bool) {
+	if jsonOutput {
+		printJSONReport(report, err)
+		return
+	}
+	if stats {
+		fmt.Println(report)
+	} else {
+		printWarnings(report)
+	}
+	if err != nil {
+		fmt.Printf("Synchronization ended with errors:\n%s\n", err)
+	}
+}
+
+// printWarnings prints the warnings of the report on the standard error, the statistics already list them.
+func printWarnings(report *directory.Report) {
+	for _, w := range report.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+}
+
+// exitWithError prints the error and exits with the code matching its type.
+func exitWithError(err error) {
+	var cpErr *directory.CopyError
+	if errors.As(err, &cpErr) {
+		fmt.Printf("Process ended with errors:\n%s\n", cpErr.Error())
+	} else {
+		fmt.Println(err)
+	}
+
+	os.Exit(exitCode(err))
+}
+
+// mismatchExitCode is the exit code of a destination whose content differs from the source.
+const mismatchExitCode = 7
+
+// errorKindExitCodes are the exit codes of the failures by category, from the most to the least severe.
+var errorKindExitCodes = []struct {
+	kind directory.ErrorKind
+	code int
+}{
+	{directory.ChecksumMismatch, mismatchExitCode},
+	{directory.NoSpaceError, 4},
+	{directory.PermissionError, 3},
+	{directory.NotExistError, 5},
+}
+
+// exitCode returns the exit code matching the type of err.
+func exitCode(err error) int {
+	var cpErr *directory.CopyError
+	if errors.As(err, &cpErr) {
+		kinds := cpErr.Kinds()
+		for _, c := range errorKindExitCodes {
+			if kinds[c.kind] > 0 {
+				return c.code
+			}
+		}
+		return 1
+	}
+
+	var entryErr *directory.EntryError
+	if errors.As(err, &entryErr) {
+		for _, c := range errorKindExitCodes {
+			if entryErr.Kind() == c.kind {
+				return c.code
+			}
+		}
+	}
+
+	var cancelErr *directory.CanceledError
+	if errors.As(err, &cancelErr) {
+		return 130
+	}
+
+	var limitErr *directory.DeleteLimitError
+	if errors.As(err, &limitErr) {
+		return 6
+	}
+
+	var inputErr *directory.InputError
+	if errors.As(err, &inputErr) {
+		return 2
+	}
+
+	return 255
+}
+
+// printJSONReport prints the report and the error of the synchronization as a JSON object.
+func printJSONReport(report *directory.Report, err error) {
+	output := struct {
+		*directory.Report
+		Error string `json:"error,omitempty"`
+	}{Report: report}
+	if err != nil {
+		output.Error = err.Error()
+	}
+
+	b, jsonErr := json.MarshalIndent(output, "", "  ")
+	if jsonErr != nil {
+		fmt.Println(jsonErr)
 		os.Exit(255)
 	}
+	fmt.Println(string(b))
+}
+
+func newChangeDetector(name string) (syncFile.ChangeDetector, error) {
+	switch name {
+	case "quick":
+		return &syncFile.QuickCheck{}, nil
+	case "hash":
+		return &syncFile.HashCheck{}, nil
+	case "always":
+		return &syncFile.AlwaysCopy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown change detection strategy %q", name)
+	}
+}
+
+func printPlan(plan directory.Plan) {
+	if plan == nil {
+		return
+	}
+	plan = plan.Changes()
+	if len(plan) == 0 {
+		fmt.Println("Nothing to synchronize")
+		return
+	}
+	for _, action := range plan {
+		fmt.Println(action)
+	}
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gosync/pkg/directory"
+	syncFile "gosync/pkg/file"
+	"gosync/pkg/filter"
+	"os"
+)
+
+// runVerify compares a source and a destination folder without copying anything.
+// It exits with the code of a checksum mismatch when the folders differ.
+func runVerify(args []string) {
+	var source, destination, algorithm, ignoreFile string
+	var jsonOutput, keepGoing bool
+	var rules []filter.Rule
+
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.StringVar(&source, "s", "", "The source folder to compare")
+	flags.StringVar(&destination, "d", "", "The destination folder to compare")
+	flags.StringVar(&algorithm, "hash", string(syncFile.SHA256), "The hash algorithm comparing the files: sha256, sha512, blake2b, crc64 or xxhash")
+	flags.Var(ruleFlag{&rules, singleRule(filter.Include)}, "include", "A pattern of entries to include even if excluded by a previous rule, can be repeated")
+	flags.Var(ruleFlag{&rules, singleRule(filter.Exclude)}, "exclude", "A pattern of entries to exclude, can be repeated")
+	flags.Var(ruleFlag{&rules, filter.ReadRulesFile}, "exclude-from", "A file of exclude patterns with the gitignore syntax, can be repeated")
+	flags.StringVar(&ignoreFile, "ignore-file", filter.DefaultIgnoreFile, "The name of the per-directory files of exclude patterns, empty to disable them")
+	flags.BoolVar(&keepGoing, "keep-going", false, "Record the unreadable directories and compare the rest of the tree instead of stopping")
+	flags.BoolVar(&jsonOutput, "json", false, "Print the differences in JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of %s verify: compares the files of two directories without copying anything.\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if source == "" || destination == "" {
+		flags.PrintDefaults()
+		os.Exit(-1)
+	}
+	hashAlgorithm, err := syncFile.ParseHashAlgorithm(algorithm)
+	if err != nil {
+		fmt.Println(err)
+		flags.PrintDefaults()
+		os.Exit(-1)
+	}
+
+	diffs, err := directory.Compare(source, destination,
+		directory.ChangeDetection(&syncFile.HashCheck{Algorithm: hashAlgorithm}),
+		directory.Filter(filter.New(ignoreFile, rules...)),
+		directory.ContinueOnError(keepGoing),
+	)
+
+	if jsonOutput {
+		printJSONDifferences(diffs, err)
+	} else {
+		printDifferences(diffs)
+	}
+	if err != nil {
+		if !jsonOutput {
+			fmt.Println(err)
+		}
+		os.Exit(exitCode(err))
+	}
+	if len(diffs) > 0 {
+		os.Exit(mismatchExitCode)
+	}
+}
+
+func printDifferences(diffs []directory.Difference) {
+	if len(diffs) == 0 {
+		fmt.Println("The folders are identical")
+		return
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+}
+
+// printJSONDifferences prints the differences and the error of the comparison as a JSON object.
+func printJSONDifferences(diffs []directory.Difference, err error) {
+	type difference struct {
+		Type        string `json:"type"`
+		Source      string `json:"source,omitempty"`
+		Destination string `json:"destination"`
+	}
+	output := struct {
+		Differences []difference `json:"differences"`
+		Error       string       `json:"error,omitempty"`
+	}{Differences: make([]difference, len(diffs))}
+	for i, d := range diffs {
+		output.Differences[i] = difference{Type: d.Type.String(), Source: d.Source, Destination: d.Destination}
+	}
+	if err != nil {
+		output.Error = err.Error()
+	}
+
+	b, jsonErr := json.MarshalIndent(output, "", "  ")
+	if jsonErr != nil {
+		fmt.Println(jsonErr)
+		os.Exit(255)
+	}
+	fmt.Println(string(b))
+}
@@ -1,3 +1,7 @@
 module gosync
 
 go 1.20
+
+require golang.org/x/crypto v0.33.0
+
+require golang.org/x/sys v0.30.0
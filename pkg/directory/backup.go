@@ -0,0 +1,163 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// backupTimeFormat names the generations of the backup directory, their names sort in chronological order.
+const backupTimeFormat = "20060102-150405.000000000"
+
+// generation returns the backup generation of the run, the directory receiving the entries it deletes or overwrites.
+func (s *synchronizer) generation(r *run) string {
+	return path.Join(s.backupDir, r.started.Format(backupTimeFormat))
+}
+
+// backupPath returns the path of entry in the backup generation of the run, relative to the folder it belongs to.
+// The entries of a two-way synchronization are backed up in a source and a destination sub directory.
+func (s *synchronizer) backupPath(r *run, entry string) (string, error) {
+	roots := []struct{ root, dir string }{{s.Destination, ""}}
+	if s.twoWay {
+		roots = []struct{ root, dir string }{{s.Destination, "destination"}, {s.Source, "source"}}
+	}
+	for _, root := range roots {
+		if rel, ok := relativePath(root.root, entry); ok && rel != "" {
+			return path.Join(s.generation(r), root.dir, rel), nil
+		}
+	}
+	return "", fmt.Errorf("cannot back up %s: not inside the synchronized folders", entry)
+}
+
+// backup moves an entry deleted by the synchronization into the backup generation of the run.
+// The backup directory is on the file system of the destination, which is the one of the source in two-way mode.
+func (s *synchronizer) backup(r *run, entry string) error {
+	if _, err := s.destinationFS.Lstat(entry); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	target, err := s.backupPath(r, entry)
+	if err != nil {
+		return err
+	}
+	if err := s.destinationFS.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return fmt.Errorf("cannot create backup directory %s: %w", path.Dir(target), err)
+	}
+
+	err = s.destinationFS.Rename(entry, target)
+	if errors.Is(err, syscall.EXDEV) {
+		// the backup directory is on another device
+		if err = copyTree(s.destinationFS, entry, target); err == nil {
+			err = s.destinationFS.RemoveAll(entry)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot back up %s: %w", entry, err)
+	}
+	r.report.recordBackup()
+	return nil
+}
+
+// backupCopy keeps the content of a file or a symlink about to be overwritten in the backup generation of the run.
+// A file replaced by an atomic copy is kept with a hard link when the backup directory is on the same file system.
+func (s *synchronizer) backupCopy(r *run, entry string) error {
+	info, err := s.destinationFS.Lstat(entry)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot back up %s: %w", entry, err)
+	}
+	target, err := s.backupPath(r, entry)
+	if err != nil {
+		return err
+	}
+	if err := s.destinationFS.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return fmt.Errorf("cannot create backup directory %s: %w", path.Dir(target), err)
+	}
+
+	symlink := info.Mode()&os.ModeSymlink != 0
+	if !s.atomic || symlink || s.destinationFS.Link(entry, target) != nil {
+		if syncFile.IsSpecial(info.Mode()) {
+			err = syncFile.CreateSpecialFS(s.destinationFS, entry, s.destinationFS, target, syncFile.DefaultAttributes)
+		} else {
+			c := &syncFile.BasicCopy{Preserve: syncFile.DefaultAttributes, Source: s.destinationFS, Destination: s.destinationFS}
+			err = c.Copy(entry, target, symlink)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot back up %s: %w", entry, err)
+	}
+	r.report.recordBackup()
+	return nil
+}
+
+// copyTree copies the entry source of fsys and all its content to destination.
+func copyTree(fsys syncFile.FS, source, destination string) error {
+	c := &syncFile.BasicCopy{Preserve: syncFile.DefaultAttributes, Source: fsys, Destination: fsys}
+	return walkFS(fsys, source, func(name string, d fs.DirEntry) error {
+		rel, err := filepath.Rel(source, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, rel)
+		switch getEntryType(d.Type()) {
+		case folder:
+			return fsys.MkdirAll(target, os.ModePerm)
+		case symlink:
+			return c.Copy(name, target, true)
+		case fifo, socket, device:
+			return syncFile.CreateSpecialFS(fsys, name, fsys, target, syncFile.DefaultAttributes)
+		default:
+			return c.Copy(name, target, false)
+		}
+	})
+}
+
+// pruneBackups deletes the generations of the backup directory beyond the number of generations to keep
+// or older than the maximum age. The generation of the run is always kept.
+func (s *synchronizer) pruneBackups(r *run) error {
+	if s.keepBackups == 0 && s.backupMaxAge == 0 {
+		return nil
+	}
+	entries, err := s.destinationFS.ReadDir(s.backupDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read backup directory %s: %w", s.backupDir, err)
+	}
+
+	current := path.Base(s.generation(r))
+	generations := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if _, err := time.ParseInLocation(backupTimeFormat, entry.Name(), time.Local); err == nil && entry.IsDir() && entry.Name() != current {
+			generations = append(generations, entry.Name())
+		}
+	}
+	// newest first, the current generation is the first one kept if the run backed up entries
+	sort.Sort(sort.Reverse(sort.StringSlice(generations)))
+	kept := 0
+	if _, err := s.destinationFS.Stat(s.generation(r)); err == nil {
+		kept = 1
+	}
+
+	for i, name := range generations {
+		created, _ := time.ParseInLocation(backupTimeFormat, name, time.Local)
+		tooMany := s.keepBackups > 0 && kept+i >= s.keepBackups
+		tooOld := s.backupMaxAge > 0 && r.started.Sub(created) > s.backupMaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := s.destinationFS.RemoveAll(path.Join(s.backupDir, name)); err != nil {
+			return fmt.Errorf("cannot prune backup generation %s: %w", name, err)
+		}
+	}
+	return nil
+}
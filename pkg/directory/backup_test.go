@@ -0,0 +1,108 @@
+package directory
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_synchronizer_Sync_backupDir(t *testing.T) {
+	source, destination, backupDir := t.TempDir(), t.TempDir(), t.TempDir()
+	now := time.Now().Truncate(time.Second)
+
+	writeFile(t, source, "file_a", "new a", now.Add(time.Hour))
+	writeFile(t, source, "dir_a/file_b", "b", now)
+	writeFile(t, destination, "file_a", "old a", now)
+	writeFile(t, destination, "dir_a/file_b", "b", now)
+	writeFile(t, destination, "dir_b/file_c", "c", now)
+
+	s := NewSynchronizer(source, destination, BackupDir(backupDir))
+	report, err := s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.EntriesBackedUp != 2 {
+		t.Errorf("Sync() entries backed up = %v, want 2", report.EntriesBackedUp)
+	}
+
+	generations, err := os.ReadDir(backupDir)
+	if err != nil || len(generations) != 1 {
+		t.Fatalf("backup generations = %v, error = %v, want 1 generation", generations, err)
+	}
+	generation := path.Join(backupDir, generations[0].Name())
+	wantContent(t, generation, "file_a", "old a")
+	wantContent(t, generation, "dir_b/file_c", "c")
+	wantContent(t, generation, "dir_a/file_b", "")
+	wantContent(t, destination, "file_a", "new a")
+	wantContent(t, destination, "dir_b/file_c", "")
+}
+
+func Test_synchronizer_validate_backupDir(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	s := NewSynchronizer(source, destination, BackupDir(path.Join(destination, "backup")))
+
+	_, err := s.Sync()
+	var inputErr *InputError
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Sync() error = %v, want an *InputError", err)
+	}
+}
+
+func Test_synchronizer_pruneBackups(t *testing.T) {
+	started := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	generations := []string{
+		started.AddDate(0, 0, -9).Format(backupTimeFormat),
+		started.AddDate(0, 0, -5).Format(backupTimeFormat),
+		started.AddDate(0, 0, -2).Format(backupTimeFormat),
+		started.AddDate(0, 0, -1).Format(backupTimeFormat),
+	}
+
+	tests := []struct {
+		name   string
+		keep   int
+		maxAge time.Duration
+		want   []string
+	}{
+		{"keep all", 0, 0, generations},
+		{"keep 3", 3, 0, generations[2:]},
+		{"max age", 0, 72 * time.Hour, generations[2:]},
+		{"keep 1", 1, 72 * time.Hour, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backupDir := t.TempDir()
+			for _, name := range append(generations, "notes") {
+				if err := os.Mkdir(path.Join(backupDir, name), os.ModePerm); err != nil {
+					t.Fatalf("cannot create directory for test: %v", err)
+				}
+			}
+			// the current generation counts as a kept generation
+			r := &run{started: started}
+			s := newSynchronizer("a", "b", BackupDir(backupDir), KeepBackups(tt.keep), BackupMaxAge(tt.maxAge))
+			if err := os.Mkdir(s.generation(r), os.ModePerm); err != nil {
+				t.Fatalf("cannot create directory for test: %v", err)
+			}
+
+			if err := s.pruneBackups(r); err != nil {
+				t.Fatalf("pruneBackups() unexpected error: %v", err)
+			}
+
+			entries, err := os.ReadDir(backupDir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := make([]string, 0)
+			for _, entry := range entries {
+				if entry.Name() != "notes" && entry.Name() != path.Base(s.generation(r)) {
+					got = append(got, entry.Name())
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruneBackups() kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
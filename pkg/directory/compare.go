@@ -0,0 +1,88 @@
+package directory
+
+import (
+	"fmt"
+	"path"
+)
+
+// DifferenceType is the way an entry differs between the source and the destination.
+type DifferenceType int
+
+const (
+	// Missing is a source entry that doesn't exist at the destination.
+	Missing = DifferenceType(iota)
+	// Extraneous is a destination entry that doesn't exist in the source.
+	Extraneous
+	// Modified is a file or a symlink whose content differs from its source.
+	Modified
+	// TypeMismatch is a destination entry whose type differs from its source.
+	TypeMismatch
+)
+
+func (t DifferenceType) String() string {
+	switch t {
+	case Missing:
+		return "missing"
+	case Extraneous:
+		return "extraneous"
+	case Modified:
+		return "modified"
+	case TypeMismatch:
+		return "type mismatch"
+	default:
+		return fmt.Sprintf("unknown difference %d", int(t))
+	}
+}
+
+// Difference is an entry that differs between the source and the destination.
+type Difference struct {
+	Type DifferenceType
+	// Source is the source entry, it is empty for an Extraneous entry.
+	Source      string
+	Destination string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s %s", d.Type, d.Destination)
+}
+
+// Compare compares the source and the destination trees without modifying them.
+// The entries are compared with the change detection and selected by the filter of the options,
+// the content of the files is only compared if the change detection hashes it, see syncFile.HashCheck.
+// When the comparison continues on errors, the differences of the readable entries are returned with a *CopyError.
+func Compare(source, destination string, opts ...SynchronizerOption) ([]Difference, error) {
+	s := newSynchronizer(source, destination, opts...)
+	p, err := s.Plan()
+	if p == nil {
+		return nil, err
+	}
+
+	diffs := make([]Difference, 0)
+	// replaced is the last entry whose type differs, its copy is part of the same difference
+	replaced := ""
+	for _, a := range p {
+		switch a.Type {
+		case DeleteEntry:
+			diffs = append(diffs, Difference{Type: Extraneous, Destination: a.Destination})
+		case ReplaceType:
+			diffs = append(diffs, Difference{Type: TypeMismatch, Source: a.Source, Destination: a.Destination})
+			replaced = a.Destination
+		case MoveEntry:
+			// a file moved in the source is extraneous at its previous place and missing at the new one
+			diffs = append(diffs, Difference{Type: Extraneous, Destination: a.Source})
+			if rel, ok := relativePath(destination, a.Destination); ok {
+				diffs = append(diffs, Difference{Type: Missing, Source: path.Join(source, rel), Destination: a.Destination})
+			}
+		case CreateDir, CopyFile, CopySymlink, LinkFile, CreateSpecial:
+			if a.Destination == replaced {
+				continue
+			}
+			d := Difference{Type: Missing, Source: a.Source, Destination: a.Destination}
+			if _, statErr := s.destinationFS.Lstat(a.Destination); statErr == nil {
+				d.Type = Modified
+			}
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, err
+}
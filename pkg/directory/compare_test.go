@@ -0,0 +1,89 @@
+package directory
+
+import (
+	"errors"
+	syncFile "gosync/pkg/file"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	now := time.Now().Truncate(time.Second)
+
+	writeFile(t, source, "same", "same", now)
+	writeFile(t, destination, "same", "same", now)
+	// same size and time, only a hash sees the difference
+	writeFile(t, source, "modified", "content", now)
+	writeFile(t, destination, "modified", "CONTENT", now)
+	writeFile(t, source, "missing_dir/missing", "missing", now)
+	writeFile(t, destination, "extraneous", "extraneous", now)
+	writeFile(t, source, "type/file", "file", now)
+	writeFile(t, destination, "type", "type", now)
+
+	diffs, err := Compare(source, destination, ChangeDetection(&syncFile.HashCheck{Algorithm: syncFile.CRC64}))
+	if err != nil {
+		t.Fatalf("Compare() unexpected error: %v", err)
+	}
+
+	got := make(map[string]DifferenceType)
+	for _, d := range diffs {
+		rel, _ := relativePath(destination, d.Destination)
+		got[rel] = d.Type
+	}
+	want := map[string]DifferenceType{
+		"modified":            Modified,
+		"missing_dir":         Missing,
+		"missing_dir/missing": Missing,
+		"extraneous":          Extraneous,
+		"type":                TypeMismatch,
+		"type/file":           Missing,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() = %v, want %v", got, want)
+	}
+}
+
+// corruptingCopier writes a content that differs from the source.
+type corruptingCopier struct{}
+
+func (corruptingCopier) Copy(source, destination string, symlink bool) error {
+	return os.WriteFile(destination, []byte("corrupted"), 0644)
+}
+
+func Test_synchronizer_Sync_verifyCopies(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFile(t, source, "file_a", "content", time.Now())
+
+	tests := []struct {
+		name         string
+		copier       syncFile.Copier
+		wantMismatch bool
+	}{
+		{"verified", &syncFile.BasicCopy{}, false},
+		{"corrupted", corruptingCopier{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := NewSynchronizer(source, destination, fileCopier(tt.copier), VerifyCopies(syncFile.SHA256)).Sync()
+
+			var mismatchErr *syncFile.MismatchError
+			if errors.As(err, &mismatchErr) != tt.wantMismatch {
+				t.Fatalf("Sync() error = %v, want a *syncFile.MismatchError %v", err, tt.wantMismatch)
+			}
+			if tt.wantMismatch {
+				if report.Errors[string(ChecksumMismatch)] != 1 {
+					t.Errorf("Sync() errors = %v, want 1 checksum mismatch", report.Errors)
+				}
+				if mismatchErr.Destination != path.Join(destination, "file_a") {
+					t.Errorf("Sync() mismatch destination = %v", mismatchErr.Destination)
+				}
+			} else if err != nil || report.FilesVerified != 1 {
+				t.Errorf("Sync() files verified = %v, error = %v, want 1 file verified", report.FilesVerified, err)
+			}
+		})
+	}
+}
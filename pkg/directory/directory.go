@@ -3,8 +3,12 @@ package directory
 import (
 	"errors"
 	"fmt"
+	syncFile "gosync/pkg/file"
 	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
 type entryType int
@@ -13,6 +17,9 @@ const (
 	folder = entryType(iota)
 	file
 	symlink
+	fifo
+	socket
+	device
 )
 
 type InputError struct {
@@ -25,7 +32,12 @@ func (e *InputError) Error() string {
 
 // IsValid returns an error if the path doesn't exist, or if it is not a directory
 func IsValid(path string) error {
-	sourceInfo, err := os.Stat(path)
+	return isValidFS(syncFile.OSFS{}, path)
+}
+
+// isValidFS returns an error if the path doesn't exist in fsys, or if it is not a directory.
+func isValidFS(fsys syncFile.FS, path string) error {
+	sourceInfo, err := fsys.Stat(path)
 	if err != nil {
 		return fmt.Errorf("%s is not a valid directory: %w", path, err)
 	}
@@ -41,17 +53,27 @@ type dirEntryLister interface {
 	listEntries(folderPath string) (map[string]entryType, error)
 }
 
+// basicDirEntryLister lists the entries of the folders of fs, the local disk if it is nil.
 type basicDirEntryLister struct {
+	fs syncFile.FS
 }
 
-func (basicDirEntryLister) listEntries(folderPath string) (map[string]entryType, error) {
-	return ListEntries(folderPath)
+func (l basicDirEntryLister) listEntries(folderPath string) (map[string]entryType, error) {
+	if l.fs == nil {
+		return ListEntries(folderPath)
+	}
+	return listEntries(l.fs, folderPath)
 }
 
 // ListEntries lists all the entries in the folderPath and returns a map[string]entryType of the entries.
 func ListEntries(folderPath string) (map[string]entryType, error) {
+	return listEntries(syncFile.OSFS{}, folderPath)
+}
+
+// listEntries lists all the entries in the folderPath of fsys and returns a map[string]entryType of the entries.
+func listEntries(fsys syncFile.FS, folderPath string) (map[string]entryType, error) {
 	existingEntries := make(map[string]entryType)
-	destEntries, err := os.ReadDir(folderPath)
+	destEntries, err := fsys.ReadDir(folderPath)
 	if err != nil {
 		var pathErr *fs.PathError
 		if !errors.As(err, &pathErr) {
@@ -71,7 +93,59 @@ func getEntryType(fileMode os.FileMode) entryType {
 		return folder
 	case os.ModeSymlink:
 		return symlink
+	case os.ModeNamedPipe:
+		return fifo
+	case os.ModeSocket:
+		return socket
+	case os.ModeDevice, os.ModeDevice | os.ModeCharDevice:
+		return device
 	default:
 		return file
 	}
 }
+
+// entryKind returns the kind of the entry name of fsys in the messages: symlink, the type of a special file, or entry.
+func entryKind(fsys syncFile.FS, name string) string {
+	info, err := fsys.Lstat(name)
+	if err != nil {
+		return "entry"
+	}
+	t := getEntryType(info.Mode().Type())
+	if special, ok := specialFileType(t); ok {
+		return special.String()
+	}
+	if t == symlink {
+		return "symlink"
+	}
+	return "entry"
+}
+
+// relativePath returns the slash separated path of entry relative to root, ok is false if entry is not inside root.
+func relativePath(root, entry string) (rel string, ok bool) {
+	root = path.Clean(root)
+	entry = path.Clean(entry)
+	if entry == root {
+		return "", true
+	}
+	if root == "." {
+		return entry, !strings.HasPrefix(entry, "../") && entry != ".." && !path.IsAbs(entry)
+	}
+	if !strings.HasPrefix(entry, root+"/") {
+		return "", false
+	}
+	return entry[len(root)+1:], true
+}
+
+// isInsideDir returns true if entry is dir or inside it, once both are made absolute.
+func isInsideDir(entry, dir string) (bool, error) {
+	absEntry, err := filepath.Abs(entry)
+	if err != nil {
+		return false, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	_, ok := relativePath(filepath.ToSlash(absDir), filepath.ToSlash(absEntry))
+	return ok, nil
+}
@@ -0,0 +1,101 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"io/fs"
+	"strings"
+	"syscall"
+)
+
+// ErrorKind is the category of the cause of an EntryError.
+type ErrorKind string
+
+const (
+	// PermissionError is a failure caused by missing permissions.
+	PermissionError = ErrorKind("permission")
+	// NoSpaceError is a failure caused by a full disk.
+	NoSpaceError = ErrorKind("no space")
+	// NotExistError is a failure caused by an entry that doesn't exist, usually a source entry deleted during the synchronization.
+	NotExistError = ErrorKind("not exist")
+	// ChecksumMismatch is a copied file whose content differs from its source.
+	ChecksumMismatch = ErrorKind("checksum mismatch")
+	// OtherError is any other failure.
+	OtherError = ErrorKind("other")
+)
+
+// Kind returns the category of the cause of err.
+func Kind(err error) ErrorKind {
+	var mismatchErr *syncFile.MismatchError
+	switch {
+	case errors.As(err, &mismatchErr):
+		return ChecksumMismatch
+	case errors.Is(err, fs.ErrPermission):
+		return PermissionError
+	case errors.Is(err, syscall.ENOSPC):
+		return NoSpaceError
+	case errors.Is(err, fs.ErrNotExist):
+		return NotExistError
+	default:
+		return OtherError
+	}
+}
+
+// EntryError is the failure of an action on an entry of the synchronization.
+type EntryError struct {
+	Op ActionType
+	// Source is the source entry of the action, it is empty for the actions without a source.
+	Source      string
+	Destination string
+	Err         error
+}
+
+func newEntryError(a Action, err error) *EntryError {
+	return &EntryError{Op: a.Type, Source: a.Source, Destination: a.Destination, Err: err}
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// Kind returns the category of the cause of the failure.
+func (e *EntryError) Kind() ErrorKind {
+	return Kind(e.Err)
+}
+
+// CopyError gathers the failures of the entries of a synchronization: the copies, and the scans, deletions, directory
+// creations, links and special files when it continues on errors. The rest of the tree was still applied, unless
+// the failures exceeded MaxErrors: the error then wraps ErrMaxErrors and the synchronization stopped early.
+type CopyError struct {
+	Errors []*EntryError
+}
+
+func (e *CopyError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e *CopyError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Kinds returns the number of failures by category.
+func (e *CopyError) Kinds() map[ErrorKind]int {
+	kinds := make(map[ErrorKind]int)
+	for _, err := range e.Errors {
+		kinds[err.Kind()]++
+	}
+	return kinds
+}
@@ -0,0 +1,49 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"permission", &fs.PathError{Op: "open", Path: "a", Err: syscall.EACCES}, PermissionError},
+		{"no space", fmt.Errorf("cannot write: %w", &fs.PathError{Op: "write", Path: "a", Err: syscall.ENOSPC}), NoSpaceError},
+		{"not exist", fmt.Errorf("cannot open: %w", fs.ErrNotExist), NotExistError},
+		{"other", errors.New("failure"), OtherError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Kind(tt.err); got != tt.want {
+				t.Errorf("Kind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyError(t *testing.T) {
+	permErr := newEntryError(Action{Type: CopyFile, Source: "s/file_a", Destination: "d/file_a"}, fmt.Errorf("cannot open: %w", fs.ErrPermission))
+	otherErr := newEntryError(Action{Type: CopySymlink, Source: "s/link", Destination: "d/link"}, errors.New("failure"))
+	var err error = &CopyError{Errors: []*EntryError{permErr, otherErr}}
+
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("errors.Is(%v, fs.ErrPermission) = false, want true", err)
+	}
+
+	var entryErr *EntryError
+	if !errors.As(err, &entryErr) || entryErr.Destination != "d/file_a" {
+		t.Errorf("errors.As() entry error = %v, want %v", entryErr, permErr)
+	}
+
+	kinds := err.(*CopyError).Kinds()
+	if kinds[PermissionError] != 1 || kinds[OtherError] != 1 {
+		t.Errorf("Kinds() = %v", kinds)
+	}
+}
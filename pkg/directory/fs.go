@@ -0,0 +1,94 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"gosync/pkg/filter"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+)
+
+// sameFS returns true if a and b are the same file system, the file systems that cannot be compared are different.
+func sameFS(a, b syncFile.FS) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// validateFS returns an *InputError if an option is set that the file systems of the folders don't support.
+func (s *synchronizer) validateFS() error {
+	_, sourceXattrs := s.sourceFS.(syncFile.XattrFS)
+	_, destinationXattrs := s.destinationFS.(syncFile.XattrFS)
+	_, destinationSpecial := s.destinationFS.(syncFile.SpecialFS)
+
+	var msg string
+	switch {
+	case s.twoWay && !sameFS(s.sourceFS, s.destinationFS):
+		msg = "the two-way synchronization needs both folders on the same file system"
+	case s.preserve&syncFile.ExtendedAttributes != 0 && (!sourceXattrs || !destinationXattrs):
+		msg = "the extended attributes are not supported by the file systems of the folders"
+	case !destinationSpecial:
+		for t, p := range s.specialFiles {
+			if p == RecreateSpecial {
+				msg = fmt.Sprintf("the recreation of the %ss is not supported by the file system of the destination folder", SpecialFileType(t))
+			}
+		}
+	}
+	if msg != "" {
+		return &InputError{msg: msg}
+	}
+	return nil
+}
+
+// basicCopy returns the copy of the files from the source folder to the destination folder, the copiers embed it.
+func (s *synchronizer) basicCopy() syncFile.BasicCopy {
+	return syncFile.BasicCopy{Preserve: s.preserve, Atomic: s.atomic, Sparse: s.sparse, Source: s.sourceFS, Destination: s.destinationFS}
+}
+
+// copyMetadata applies the preserved attributes of the source entry, described by info, to the destination entry.
+func (s *synchronizer) copyMetadata(source, destination string, info os.FileInfo) error {
+	return syncFile.CopyMetadataFS(s.sourceFS, source, s.destinationFS, destination, info, s.preserve)
+}
+
+// openFunc returns the filter.OpenFunc opening the files of fsys.
+func openFunc(fsys syncFile.FS) filter.OpenFunc {
+	return func(name string) (io.ReadCloser, error) {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+// walkFS calls fn for the entry root of fsys and all its content, the folders before their content.
+// The symlinks are not followed, nothing is walked if root doesn't exist.
+func walkFS(fsys syncFile.FS, root string, fn func(name string, d fs.DirEntry) error) error {
+	info, err := fsys.Lstat(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return walkEntry(fsys, root, fs.FileInfoToDirEntry(info), fn)
+}
+
+func walkEntry(fsys syncFile.FS, name string, d fs.DirEntry, fn func(name string, d fs.DirEntry) error) error {
+	if err := fn(name, d); err != nil || !d.IsDir() {
+		return err
+	}
+	entries, err := fsys.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := walkEntry(fsys, path.Join(name, entry.Name()), entry, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
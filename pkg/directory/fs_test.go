@@ -0,0 +1,185 @@
+package directory
+
+import (
+	syncFile "gosync/pkg/file"
+	"gosync/pkg/filter"
+	"testing"
+	"time"
+)
+
+func Test_synchronizer_Sync_memFS(t *testing.T) {
+	source, destination := syncFile.NewMemFS(), syncFile.NewMemFS()
+	source.MkdirAll("source/dir/sub", 0750)
+	syncFile.WriteFile(source, "source/a", []byte("content of a"), 0644)
+	syncFile.WriteFile(source, "source/dir/b", []byte("content of b"), 0644)
+	source.Symlink("dir/b", "source/link")
+	destination.MkdirAll("destination/extraneous", 0755)
+	syncFile.WriteFile(destination, "destination/extraneous/c", []byte("content of c"), 0644)
+
+	opts := []SynchronizerOption{SourceFS(source), DestinationFS(destination)}
+	report, err := NewSynchronizer("source", "destination", opts...).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 2 || report.SymlinksCreated != 1 || report.DirsCreated != 2 || report.EntriesDeleted != 1 {
+		t.Errorf("Sync() report = %v", report)
+	}
+	for name, content := range map[string]string{"a": "content of a", "dir/b": "content of b", "link": "content of b"} {
+		got, err := syncFile.ReadFile(destination, "destination/"+name)
+		if err != nil {
+			t.Errorf("Sync() destination %s: %v", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("Sync() destination %s = %q, want %q", name, got, content)
+		}
+	}
+	if info, err := destination.Stat("destination/dir"); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Sync() destination dir = %v, %v, want mode 0750", info, err)
+	}
+	if _, err := destination.Lstat("destination/extraneous"); err == nil {
+		t.Errorf("Sync() extraneous entry not deleted")
+	}
+
+	report, err = NewSynchronizer("source", "destination", opts...).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 0 || report.UpToDate != 3 {
+		t.Errorf("second Sync() report = %v, want everything up to date", report)
+	}
+
+	// a renamed file is moved at the destination
+	source.Rename("source/a", "source/dir/sub/a")
+	report, err = NewSynchronizer("source", "destination", append(opts, DetectMoves(true))...).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.EntriesMoved != 1 || report.FilesCopied != 0 {
+		t.Errorf("Sync() report = %v, want one moved file", report)
+	}
+}
+
+// plainFS hides the optional interfaces of the FS it embeds.
+type plainFS struct {
+	syncFile.FS
+}
+
+func Test_synchronizer_validate_memFS(t *testing.T) {
+	memory := syncFile.NewMemFS()
+	memory.MkdirAll("source", 0755)
+
+	tests := []struct {
+		name string
+		// destination is a new temporary folder if it is empty
+		destination string
+		twoWay      bool
+		opts        []SynchronizerOption
+		wantErr     bool
+	}{
+		{"memory", "destination", false, []SynchronizerOption{SourceFS(memory), DestinationFS(memory)}, false},
+		{"memory to local", "", false, []SynchronizerOption{SourceFS(memory)}, false},
+		{"same folder", "source", false, []SynchronizerOption{SourceFS(memory), DestinationFS(memory)}, true},
+		{"missing source", "", false, []SynchronizerOption{DestinationFS(memory)}, true},
+		{"destination index", "", false, []SynchronizerOption{SourceFS(memory), DestinationIndex(t.TempDir() + "/index")}, false},
+		{"delta", "", false, []SynchronizerOption{SourceFS(memory), DeltaTransfer(true)}, false},
+		{"ignore file", "", false, []SynchronizerOption{SourceFS(memory), Filter(filter.New(".syncignore"))}, false},
+		{"two-way memory", "destination", true, []SynchronizerOption{SourceFS(memory), DestinationFS(memory)}, false},
+		{"two-way memory to local", "", true, []SynchronizerOption{SourceFS(memory)}, true},
+		{"xattrs", "", false, []SynchronizerOption{SourceFS(memory), PreserveAttributes(syncFile.Xattrs)}, false},
+		{"xattrs unsupported", "destination", false, []SynchronizerOption{SourceFS(memory), DestinationFS(plainFS{memory}), PreserveAttributes(syncFile.Xattrs)}, true},
+		{"recreate specials", "destination", false, []SynchronizerOption{SourceFS(memory), DestinationFS(memory), SpecialFiles(NamedPipe, RecreateSpecial)}, false},
+		{"recreate specials unsupported", "destination", false, []SynchronizerOption{SourceFS(memory), DestinationFS(plainFS{memory}), SpecialFiles(NamedPipe, RecreateSpecial)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination := tt.destination
+			if destination == "" {
+				destination = t.TempDir()
+			}
+			s := newSynchronizer("source", destination, tt.opts...)
+			s.twoWay = tt.twoWay
+			err := s.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Sync_memFSFeatures(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	source, destination := syncFile.NewMemFS(), syncFile.NewMemFS()
+	source.MkdirAll("source", 0755)
+	syncFile.WriteFile(source, "source/.syncignore", []byte("*.tmp\n"), 0644)
+	syncFile.WriteFile(source, "source/a", []byte("new content of a"), 0644)
+	syncFile.WriteFile(source, "source/b.tmp", []byte("content of b"), 0644)
+	source.Link("source/a", "source/c")
+	destination.MkdirAll("destination", 0755)
+	syncFile.WriteFile(destination, "destination/a", []byte("old content of a"), 0644)
+	destination.Chtimes("destination/a", modTime, modTime)
+
+	opts := []SynchronizerOption{
+		SourceFS(source), DestinationFS(destination), Filter(filter.New(".syncignore")), DeltaTransfer(true),
+		PreserveHardLinks(true), BackupDir("backup"), DestinationIndex(t.TempDir() + "/index"),
+	}
+	report, err := NewSynchronizer("source", "destination", opts...).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 2 || report.HardLinksCreated != 1 || report.EntriesBackedUp != 1 {
+		t.Errorf("Sync() report = %v", report)
+	}
+	if got, _ := syncFile.ReadFile(destination, "destination/a"); string(got) != "new content of a" {
+		t.Errorf("Sync() destination a = %q", got)
+	}
+	if _, err := destination.Lstat("destination/b.tmp"); err == nil {
+		t.Errorf("Sync() ignored file copied")
+	}
+	a, _ := destination.Lstat("destination/a")
+	c, _ := destination.Lstat("destination/c")
+	if a == nil || c == nil || !syncFile.SameFile(a, c) {
+		t.Errorf("Sync() hard link not preserved")
+	}
+	generations, err := destination.ReadDir("backup")
+	if err != nil || len(generations) != 1 {
+		t.Fatalf("Sync() backup generations = %v, %v", generations, err)
+	}
+	if got, _ := syncFile.ReadFile(destination, "backup/"+generations[0].Name()+"/a"); string(got) != "old content of a" {
+		t.Errorf("Sync() backup of a = %q", got)
+	}
+
+	report, err = NewSynchronizer("source", "destination", opts...).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 0 || report.HardLinksCreated != 0 {
+		t.Errorf("second Sync() report = %v, want everything up to date", report)
+	}
+}
+
+func TestTwoWaySynchronizer_Sync_memFS(t *testing.T) {
+	memory := syncFile.NewMemFS()
+	memory.MkdirAll("source", 0755)
+	memory.MkdirAll("destination", 0755)
+	syncFile.WriteFile(memory, "source/a", []byte("content of a"), 0644)
+	syncFile.WriteFile(memory, "destination/b", []byte("content of b"), 0644)
+
+	opts := []SynchronizerOption{SourceFS(memory), DestinationFS(memory)}
+	if _, err := NewTwoWaySynchronizer("source", "destination", "state.json", opts...).Sync(); err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	for _, name := range []string{"source/a", "source/b", "destination/a", "destination/b"} {
+		if _, err := syncFile.ReadFile(memory, name); err != nil {
+			t.Errorf("Sync() %s not synchronized", name)
+		}
+	}
+
+	memory.Remove("destination/a")
+	if _, err := NewTwoWaySynchronizer("source", "destination", "state.json", opts...).Sync(); err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if _, err := memory.Lstat("source/a"); err == nil {
+		t.Errorf("Sync() deletion not propagated")
+	}
+}
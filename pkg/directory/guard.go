@@ -0,0 +1,100 @@
+package directory
+
+import (
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"io/fs"
+	"path"
+)
+
+// DeleteLimitError is returned when the deletions planned by a synchronization exceed its limits.
+// The synchronization stops before applying any action.
+type DeleteLimitError struct {
+	// Deletions is the number of entries the synchronization would delete, including the content of the deleted folders
+	// and the entries replaced by an entry of another type.
+	Deletions int
+	// Entries is the number of entries of the synchronized folders, it is only counted when MaxDeletePercent is set.
+	Entries          int
+	MaxDelete        int
+	MaxDeletePercent float64
+}
+
+func (e *DeleteLimitError) Error() string {
+	if e.MaxDelete > 0 && e.Deletions > e.MaxDelete {
+		return fmt.Sprintf("refusing to delete %d entries: more than the maximum of %d", e.Deletions, e.MaxDelete)
+	}
+	return fmt.Sprintf("refusing to delete %d of %d entries: more than the maximum of %g%%", e.Deletions, e.Entries, e.MaxDeletePercent)
+}
+
+// checkDeletions returns a *DeleteLimitError if the deletions of the plan exceed the limits of the synchronizer.
+func (s *synchronizer) checkDeletions(r *run, p Plan) error {
+	if s.maxDelete == 0 && s.maxDeletePercent == 0 {
+		return nil
+	}
+
+	deletions := 0
+	for _, a := range p {
+		// a replaced entry is deleted too, with the content of a folder replaced by a file
+		if (a.Type != DeleteEntry && a.Type != ReplaceType) || syncFile.IsTempFile(path.Base(a.Destination)) {
+			continue
+		}
+		n, err := s.countEntries(r, a.Destination)
+		if err != nil {
+			return fmt.Errorf("cannot count the entries to delete: %w", err)
+		}
+		deletions += n
+	}
+
+	limitErr := &DeleteLimitError{Deletions: deletions, MaxDelete: s.maxDelete, MaxDeletePercent: s.maxDeletePercent}
+	if s.maxDelete > 0 && deletions > s.maxDelete {
+		return limitErr
+	}
+	if s.maxDeletePercent == 0 || deletions == 0 {
+		return nil
+	}
+
+	roots := []string{s.Destination}
+	if s.twoWay {
+		roots = append(roots, s.Source)
+	}
+	for _, root := range roots {
+		n, err := s.countEntries(r, root)
+		if err != nil {
+			return fmt.Errorf("cannot count the entries of %s: %w", root, err)
+		}
+		// the folder itself is not counted
+		if n > 0 {
+			limitErr.Entries += n - 1
+		}
+	}
+	if float64(deletions)*100 > s.maxDeletePercent*float64(limitErr.Entries) {
+		return limitErr
+	}
+	return nil
+}
+
+// countEntries returns the number of entries of the tree root, root included, from the index of the run
+// for the destination entries if it has one.
+func (s *synchronizer) countEntries(r *run, root string) (int, error) {
+	if rel, ok := s.indexRel(r, root); ok {
+		return r.index.count(rel), nil
+	}
+	// the folders of a two-way synchronization are on the same file system
+	return countEntries(s.destinationFS, root)
+}
+
+// countEntries returns the number of entries of the tree root of fsys, root included. It is 0 if root doesn't exist.
+func countEntries(fsys syncFile.FS, root string) (int, error) {
+	n := 0
+	err := walkFS(fsys, root, func(string, fs.DirEntry) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// nonEmptyDestination returns true if the destination folder name has entries, or if they cannot be counted.
+func (s *synchronizer) nonEmptyDestination(r *run, name string) bool {
+	n, err := s.countEntries(r, name)
+	return err != nil || n > 1
+}
@@ -0,0 +1,113 @@
+package directory
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_synchronizer_Sync_deleteLimits(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name        string
+		opts        []SynchronizerOption
+		wantLimit   bool
+		wantDeleted bool
+	}{
+		{"no limit", nil, false, true},
+		{"no delete", []SynchronizerOption{NoDelete(true)}, false, false},
+		{"under max delete", []SynchronizerOption{MaxDelete(3)}, false, true},
+		{"over max delete", []SynchronizerOption{MaxDelete(2)}, true, false},
+		{"under max delete percent", []SynchronizerOption{MaxDeletePercent(80)}, false, true},
+		{"over max delete percent", []SynchronizerOption{MaxDeletePercent(50)}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, destination := t.TempDir(), t.TempDir()
+			writeFile(t, source, "file_a", "a", now)
+			writeFile(t, destination, "file_a", "a", now)
+			// the folder and its two files are 3 of the 4 destination entries
+			writeFile(t, destination, "dir_b/file_b", "b", now)
+			writeFile(t, destination, "dir_b/file_c", "c", now)
+
+			_, err := NewSynchronizer(source, destination, tt.opts...).Sync()
+			var limitErr *DeleteLimitError
+			if errors.As(err, &limitErr) != tt.wantLimit {
+				t.Fatalf("Sync() error = %v, want a *DeleteLimitError %v", err, tt.wantLimit)
+			}
+			if !tt.wantLimit && err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if tt.wantLimit && limitErr.Deletions != 3 {
+				t.Errorf("Sync() deletions = %v, want 3", limitErr.Deletions)
+			}
+			if tt.wantDeleted {
+				wantContent(t, destination, "dir_b/file_b", "")
+			} else {
+				wantContent(t, destination, "dir_b/file_b", "b")
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Sync_replacedFolder(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name         string
+		opts         []SynchronizerOption
+		emptyFolder  bool
+		wantLimit    bool
+		wantReplaced bool
+	}{
+		{"no limit", nil, false, false, true},
+		{"under max delete", []SynchronizerOption{MaxDelete(4)}, false, false, true},
+		{"over max delete", []SynchronizerOption{MaxDelete(3)}, false, true, false},
+		{"over max delete percent", []SynchronizerOption{MaxDeletePercent(50)}, false, true, false},
+		{"no delete", []SynchronizerOption{NoDelete(true)}, false, false, false},
+		{"no delete, empty folder", []SynchronizerOption{NoDelete(true)}, true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, destination := t.TempDir(), t.TempDir()
+			writeFile(t, source, "file_a", "a", now)
+			writeFile(t, destination, "file_a", "a", now)
+			// the source file replaces the destination folder and its three files, 4 of the 5 destination entries
+			writeFile(t, source, "data", "data", now)
+			if tt.emptyFolder {
+				if err := os.Mkdir(path.Join(destination, "data"), 0755); err != nil {
+					t.Fatalf("cannot create directory for test: %v", err)
+				}
+			} else {
+				for _, name := range []string{"data/file_b", "data/file_c", "data/file_d"} {
+					writeFile(t, destination, name, "b", now)
+				}
+			}
+
+			report, err := NewSynchronizer(source, destination, tt.opts...).Sync()
+			var limitErr *DeleteLimitError
+			if errors.As(err, &limitErr) != tt.wantLimit {
+				t.Fatalf("Sync() error = %v, want a *DeleteLimitError %v", err, tt.wantLimit)
+			}
+			if !tt.wantLimit && err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if tt.wantLimit && limitErr.Deletions != 4 {
+				t.Errorf("Sync() deletions = %v, want 4", limitErr.Deletions)
+			}
+			if tt.wantReplaced {
+				wantContent(t, destination, "data", "data")
+				return
+			}
+			if !tt.emptyFolder {
+				wantContent(t, destination, "data/file_b", "b")
+			}
+			if !tt.wantLimit && len(report.Warnings) != 1 {
+				t.Errorf("Sync() warnings = %v, want the source file skipped", report.Warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package directory
+
+import (
+	syncFile "gosync/pkg/file"
+	"io/fs"
+)
+
+// linkGroup is a group of hard links of the source met by a planning.
+type linkGroup struct {
+	// destination is the destination of the first file of the group, the files met afterwards are linked to it.
+	destination string
+	// copied is true if the first file is copied by the plan, the links to its previous version are then outdated.
+	copied bool
+}
+
+// linkGroups maps the groups of hard links of the source by file identity.
+type linkGroups map[syncFile.FileID]*linkGroup
+
+// sourceLinkID returns the identity of the source file entry if the synchronizer preserves hard links
+// and the file has several links.
+func (s *synchronizer) sourceLinkID(entry fs.DirEntry) (syncFile.FileID, bool) {
+	if !s.hardLinks || !entry.Type().IsRegular() {
+		return syncFile.FileID{}, false
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return syncFile.FileID{}, false
+	}
+	return syncFile.HardLinkID(info)
+}
+
+// actions returns the actions that link the destination to the first file of the group.
+// exists is true if the destination, an entry of fsys, exists with the type destinationType.
+func (g *linkGroup) actions(fsys syncFile.FS, source, destination string, exists bool, destinationType entryType) Plan {
+	link := Action{Type: LinkFile, Source: source, Destination: destination, Link: g.destination}
+	if !exists {
+		return Plan{link}
+	}
+	if destinationType != file {
+		return Plan{{Type: ReplaceType, Source: source, Destination: destination}, link}
+	}
+	if !g.copied && sameFile(fsys, destination, g.destination) {
+		return Plan{{Type: UpToDate, Source: source, Destination: destination}}
+	}
+	return Plan{link}
+}
+
+// sameFile returns true if both names of fsys are links to the same file.
+func sameFile(fsys syncFile.FS, name1, name2 string) bool {
+	info1, err := fsys.Lstat(name1)
+	if err != nil {
+		return false
+	}
+	info2, err := fsys.Lstat(name2)
+	return err == nil && syncFile.SameFile(info1, info2)
+}
+
+// applyLinks executes the LinkFile actions once the files they link to are copied.
+// The links to a file whose copy failed are skipped.
+func (s *synchronizer) applyLinks(r *run, links []Action) {
+	r.mu.Lock()
+	failed := make(map[string]bool, len(r.errs))
+	for _, err := range r.errs {
+		failed[err.Destination] = true
+	}
+	r.mu.Unlock()
+
+	for _, a := range links {
+		if r.ctx.Err() != nil {
+			return
+		}
+		if failed[a.Link] {
+			continue
+		}
+		var err error
+		if s.backupDir != "" {
+			err = s.backupCopy(r, a.Destination)
+		}
+		if err == nil {
+			err = syncFile.LinkFS(s.destinationFS, a.Link, a.Destination)
+		}
+		if err != nil {
+			r.fail(newEntryError(a, err))
+			continue
+		}
+		r.report.record(a, 0)
+		s.indexAction(r, a, "")
+	}
+}
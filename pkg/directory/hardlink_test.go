@@ -0,0 +1,74 @@
+//go:build unix
+
+package directory
+
+import (
+	syncFile "gosync/pkg/file"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_synchronizer_Sync_hardLinks(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name          string
+		enabled       bool
+		wantCopied    int
+		wantLinked    int
+		wantSameFiles bool
+	}{
+		{"preserved", true, 2, 2, true},
+		{"not preserved", false, 4, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, destination := t.TempDir(), t.TempDir()
+			writeFile(t, source, "file_a", "a", now)
+			writeFile(t, source, "file_d", "d", now)
+			for _, link := range []string{"link_b", "dir/link_c"} {
+				if err := os.MkdirAll(path.Dir(path.Join(source, link)), os.ModePerm); err != nil {
+					t.Fatalf("cannot create directory for test: %v", err)
+				}
+				if err := os.Link(path.Join(source, "file_a"), path.Join(source, link)); err != nil {
+					t.Fatalf("cannot create link for test: %v", err)
+				}
+			}
+			// a destination file that is not linked yet is replaced by a link
+			writeFile(t, destination, "link_b", "a", now)
+
+			s := NewSynchronizer(source, destination, PreserveHardLinks(tt.enabled))
+			report, err := s.Sync()
+			if err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if report.FilesCopied+report.UpToDate != tt.wantCopied || report.HardLinksCreated != tt.wantLinked {
+				t.Errorf("Sync() report = %+v, want %d files copied or up to date and %d links", report, tt.wantCopied, tt.wantLinked)
+			}
+			for _, link := range []string{"link_b", "dir/link_c"} {
+				wantContent(t, destination, link, "a")
+				if got := sameFile(syncFile.OSFS{}, path.Join(destination, "file_a"), path.Join(destination, link)); got != tt.wantSameFiles {
+					t.Errorf("Sync() %s linked to file_a = %v, want %v", link, got, tt.wantSameFiles)
+				}
+			}
+			if !tt.enabled {
+				return
+			}
+
+			report, err = s.Sync()
+			if err != nil || len(report.Errors) > 0 || report.FilesCopied != 0 || report.HardLinksCreated != 0 {
+				t.Errorf("Sync() without changes report = %+v, error = %v", report, err)
+			}
+
+			// the atomic copy of the modified file replaces it, its links are created again
+			writeFile(t, source, "file_a", "a2", now.Add(time.Hour))
+			report, err = s.Sync()
+			if err != nil || report.FilesCopied != 1 || report.HardLinksCreated != 2 {
+				t.Errorf("Sync() after a modification report = %+v, error = %v", report, err)
+			}
+			wantContent(t, destination, "dir/link_c", "a2")
+		})
+	}
+}
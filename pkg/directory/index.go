@@ -0,0 +1,484 @@
+package directory
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const indexVersion = 1
+
+// indexEntry describes an entry of the destination folder as left by the last successful synchronization.
+type indexEntry struct {
+	entryState
+	// Hash is the hex encoded hash of the content of a file with the algorithm of the index, empty if it is not known yet.
+	Hash string `json:"hash,omitempty"`
+}
+
+// destinationIndex is the state of the destination folder recorded by the last successful synchronization.
+// A synchronization with an index lists and compares the destination entries from it instead of reading the destination.
+type destinationIndex struct {
+	Version int `json:"version"`
+	// Algorithm is the hash of the content of the files, it is the algorithm of the HashCheck change detection.
+	Algorithm syncFile.HashAlgorithm `json:"algorithm,omitempty"`
+	// Entries maps the entries by slash separated path relative to the destination folder.
+	Entries map[string]indexEntry `json:"entries"`
+
+	mu sync.Mutex
+	// children maps the folders, "" for the destination folder itself, to the names of their entries.
+	children map[string]map[string]entryType
+}
+
+func newIndex(algorithm syncFile.HashAlgorithm) *destinationIndex {
+	ix := &destinationIndex{Version: indexVersion, Algorithm: algorithm, Entries: make(map[string]indexEntry)}
+	ix.buildChildren()
+	return ix
+}
+
+// loadIndex reads the index file name, the index is nil if the file doesn't exist.
+func loadIndex(name string) (*destinationIndex, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read index file %s: %w", name, err)
+	}
+
+	ix := &destinationIndex{}
+	if err := json.Unmarshal(b, ix); err != nil {
+		return nil, fmt.Errorf("cannot parse index file %s: %w", name, err)
+	}
+	if ix.Version != indexVersion {
+		return nil, fmt.Errorf("unsupported version %d of index file %s", ix.Version, name)
+	}
+	if ix.Entries == nil {
+		ix.Entries = make(map[string]indexEntry)
+	}
+	ix.buildChildren()
+	return ix, nil
+}
+
+func (ix *destinationIndex) buildChildren() {
+	ix.children = map[string]map[string]entryType{"": {}}
+	for rel, e := range ix.Entries {
+		ix.addChild(rel, e.Type)
+	}
+}
+
+func (ix *destinationIndex) addChild(rel string, t entryType) {
+	dir, name := parentDir(rel), path.Base(rel)
+	if ix.children[dir] == nil {
+		ix.children[dir] = make(map[string]entryType)
+	}
+	ix.children[dir][name] = t
+	if t == folder && ix.children[rel] == nil {
+		ix.children[rel] = make(map[string]entryType)
+	}
+}
+
+// parentDir returns the folder containing the entry rel, "" for the entries of the destination folder itself.
+func parentDir(rel string) string {
+	dir := path.Dir(rel)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// save writes the index in a temporary file renamed over the index file name.
+func (ix *destinationIndex) save(name string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	b, err := json.Marshal(ix)
+	if err != nil {
+		return fmt.Errorf("cannot encode index: %w", err)
+	}
+	return writeFileAtomic(syncFile.OSFS{}, name, b)
+}
+
+// list returns the entries of the folder rel, as a dirEntryLister does.
+func (ix *destinationIndex) list(rel string) map[string]entryType {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	entries := make(map[string]entryType, len(ix.children[rel]))
+	for name, t := range ix.children[rel] {
+		entries[name] = t
+	}
+	return entries
+}
+
+func (ix *destinationIndex) get(rel string) (indexEntry, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	e, ok := ix.Entries[rel]
+	return e, ok
+}
+
+// set records the entry rel, an entry of another type at rel is removed with its content first.
+func (ix *destinationIndex) set(rel string, e indexEntry) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if old, ok := ix.Entries[rel]; ok && old.Type != e.Type {
+		ix.removeLocked(rel)
+	}
+	ix.Entries[rel] = e
+	ix.addChild(rel, e.Type)
+}
+
+// setHash records the hash of the file rel.
+func (ix *destinationIndex) setHash(rel, hash string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if e, ok := ix.Entries[rel]; ok {
+		e.Hash = hash
+		ix.Entries[rel] = e
+	}
+}
+
+// remove forgets the entry rel and its content.
+func (ix *destinationIndex) remove(rel string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(rel)
+}
+
+func (ix *destinationIndex) removeLocked(rel string) {
+	for name := range ix.children[rel] {
+		ix.removeLocked(path.Join(rel, name))
+	}
+	delete(ix.children, rel)
+	delete(ix.Entries, rel)
+	delete(ix.children[parentDir(rel)], path.Base(rel))
+}
+
+// move records the entry from and its content at the path to.
+func (ix *destinationIndex) move(from, to string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	moved := make(map[string]indexEntry)
+	var collect func(rel string)
+	collect = func(rel string) {
+		if e, ok := ix.Entries[rel]; ok {
+			moved[to+rel[len(from):]] = e
+		}
+		for name := range ix.children[rel] {
+			collect(path.Join(rel, name))
+		}
+	}
+	collect(from)
+	ix.removeLocked(from)
+	ix.removeLocked(to)
+	for rel, e := range moved {
+		ix.Entries[rel] = e
+		ix.addChild(rel, e.Type)
+	}
+}
+
+// count returns the number of entries of the tree rel, rel included.
+func (ix *destinationIndex) count(rel string) int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	var countLocked func(rel string) int
+	countLocked = func(rel string) int {
+		n := 1
+		for name := range ix.children[rel] {
+			n += countLocked(path.Join(rel, name))
+		}
+		return n
+	}
+	if _, ok := ix.Entries[rel]; !ok && rel != "" {
+		return 0
+	}
+	return countLocked(rel)
+}
+
+// drift returns the number of entries of the index that differ from the entries of current, a fresh scan of the destination.
+// The hashes of the unchanged files are kept in current.
+func (ix *destinationIndex) drift(current *destinationIndex) int {
+	n := 0
+	for rel, e := range ix.Entries {
+		cur, ok := current.Entries[rel]
+		switch {
+		case !ok || !cur.same(e.entryState):
+			n++
+		case cur.Type == file && ix.Algorithm == current.Algorithm:
+			cur.Hash = e.Hash
+			current.Entries[rel] = cur
+		}
+	}
+	for rel := range current.Entries {
+		if _, ok := ix.Entries[rel]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// indexAlgorithm returns the hash algorithm recorded in the index, the algorithm of the HashCheck change detection.
+func (s *synchronizer) indexAlgorithm() syncFile.HashAlgorithm {
+	if hc, ok := s.changeDetector.(*syncFile.HashCheck); ok {
+		if hc.Algorithm == "" {
+			return syncFile.SHA256
+		}
+		return hc.Algorithm
+	}
+	return ""
+}
+
+// openIndex sets up the index of the run when the synchronizer has an index file. The destination is scanned
+// when there is no index yet or when a rescan is requested, the entries that drifted from the index are then reported.
+func (s *synchronizer) openIndex(r *run) error {
+	if s.indexFile == "" || s.twoWay {
+		return nil
+	}
+	ix, err := loadIndex(s.indexFile)
+	if err != nil {
+		return err
+	}
+	algorithm := s.indexAlgorithm()
+	if ix != nil && ix.Algorithm != algorithm {
+		for rel, e := range ix.Entries {
+			e.Hash = ""
+			ix.Entries[rel] = e
+		}
+		ix.Algorithm = algorithm
+	}
+
+	if ix == nil || s.rescan {
+		current, err := s.scanIndex(r, algorithm)
+		if err != nil {
+			return err
+		}
+		if ix != nil {
+			r.report.Drifted = ix.drift(current)
+		}
+		ix = current
+	}
+	r.index = ix
+	return nil
+}
+
+// scanIndex records the entries of the destination folder, except the index file itself.
+func (s *synchronizer) scanIndex(r *run, algorithm syncFile.HashAlgorithm) (*destinationIndex, error) {
+	ix := newIndex(algorithm)
+	var indexInfo os.FileInfo
+	if syncFile.IsLocal(s.destinationFS) {
+		indexInfo, _ = os.Lstat(s.indexFile)
+	}
+
+	dirs := []string{""}
+	for len(dirs) > 0 {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+		rel := dirs[0]
+		dirs = dirs[1:]
+		dir := path.Join(s.Destination, rel)
+
+		entries, err := s.destinationFS.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) && rel == "" {
+			// the destination folder is created by the synchronization
+			return ix, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan the destination: %w", newEntryError(Action{Type: Scan, Destination: dir}, err))
+		}
+
+		for _, entry := range entries {
+			entryRel := path.Join(rel, entry.Name())
+			info, err := entry.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("cannot scan the destination: %w", newEntryError(Action{Type: Scan, Destination: path.Join(dir, entry.Name())}, err))
+			}
+			if indexInfo != nil && syncFile.SameFile(info, indexInfo) {
+				continue
+			}
+
+			e, err := newIndexEntry(s.destinationFS, path.Join(dir, entry.Name()), info)
+			if err != nil {
+				return nil, fmt.Errorf("cannot scan the destination: %w", newEntryError(Action{Type: Scan, Destination: path.Join(dir, entry.Name())}, err))
+			}
+			ix.Entries[entryRel] = e
+			ix.addChild(entryRel, e.Type)
+			if e.Type == folder {
+				dirs = append(dirs, entryRel)
+			}
+		}
+	}
+	return ix, nil
+}
+
+// newIndexEntry returns the index entry of the entry name of fsys given its stats.
+func newIndexEntry(fsys syncFile.FS, name string, info os.FileInfo) (indexEntry, error) {
+	e := indexEntry{entryState: entryState{Type: getEntryType(info.Mode().Type()), ModTime: info.ModTime().UnixNano()}}
+	switch e.Type {
+	case file:
+		e.Size = info.Size()
+	case symlink:
+		target, err := fsys.Readlink(name)
+		if err != nil {
+			return e, err
+		}
+		e.Target = target
+	}
+	return e, nil
+}
+
+// indexRel returns the path of the destination entry relative to the destination folder, ok is false if the run has no index.
+func (s *synchronizer) indexRel(r *run, destination string) (rel string, ok bool) {
+	if r.index == nil {
+		return "", false
+	}
+	return relativePath(s.Destination, destination)
+}
+
+// listDestination lists the entries of the destination folder dir, from the index of the run if it has one.
+func (s *synchronizer) listDestination(r *run, dir string) (map[string]entryType, error) {
+	if rel, ok := s.indexRel(r, dir); ok {
+		return r.index.list(rel), nil
+	}
+	return s.entryLister.listEntries(dir)
+}
+
+// indexChanged returns true if the source file or symlink differs from the entry e of the index, only the source is read.
+// The change detections other than QuickCheck and HashCheck read the destination file too.
+func (s *synchronizer) indexChanged(r *run, rel, source, destination string, e indexEntry) (bool, error) {
+	if e.Type == symlink {
+		target, err := s.symlinkTarget(source)
+		if err != nil {
+			return false, err
+		}
+		return target != e.Target, nil
+	}
+
+	switch cd := s.changeDetector.(type) {
+	case *syncFile.QuickCheck:
+		info, err := s.sourceFS.Stat(source)
+		if err != nil {
+			return true, fmt.Errorf("error getting stats for file %s: %w", source, err)
+		}
+		return cd.ChangedStats(info.Size(), info.ModTime(), e.Size, time.Unix(0, e.ModTime)), nil
+	case *syncFile.HashCheck:
+		info, err := s.sourceFS.Stat(source)
+		if err != nil {
+			return true, fmt.Errorf("error getting stats for file %s: %w", source, err)
+		}
+		if info.Size() != e.Size {
+			return true, nil
+		}
+		sourceSum, err := syncFile.HashFS(s.sourceFS, source, cd.Algorithm)
+		if err != nil {
+			return false, err
+		}
+		if e.Hash == "" {
+			// the hash of the destination file is computed once and kept in the index
+			destinationSum, err := syncFile.HashFS(s.destinationFS, destination, cd.Algorithm)
+			if err != nil {
+				return false, err
+			}
+			e.Hash = hex.EncodeToString(destinationSum)
+			r.index.setHash(rel, e.Hash)
+		}
+		return hex.EncodeToString(sourceSum) != e.Hash, nil
+	case syncFile.FSChangeDetector:
+		return cd.ChangedFS(s.sourceFS, source, s.destinationFS, destination)
+	default:
+		return s.changeDetector.Changed(source, destination)
+	}
+}
+
+// indexHash returns the hex encoded hash of the source file copied by the action a, recorded in the index of the run.
+// It is empty if the run has no index hashing the files or the file cannot be read. The workers copying the files
+// compute it, so the files are hashed concurrently.
+func (s *synchronizer) indexHash(r *run, a Action) string {
+	if r.index == nil || r.index.Algorithm == "" || a.Type != CopyFile {
+		return ""
+	}
+	// the destination file is a copy of the source, which is usually faster to read
+	sum, err := syncFile.HashFS(s.sourceFS, a.Source, r.index.Algorithm)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(sum)
+}
+
+// indexAction records the outcome of a successful action in the index of the run,
+// hash is the hash of the copied file given by indexHash.
+func (s *synchronizer) indexAction(r *run, a Action, hash string) {
+	rel, ok := s.indexRel(r, a.Destination)
+	if !ok || rel == "" {
+		return
+	}
+	// the index is only saved when all the destination entries are known
+	fail := func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.indexFailed = true
+	}
+
+	switch a.Type {
+	case CopyFile, CopySymlink, CreateDir, LinkFile, CreateSpecial:
+		info, err := s.destinationFS.Lstat(a.Destination)
+		if err != nil {
+			fail()
+			return
+		}
+		e, err := newIndexEntry(s.destinationFS, a.Destination, info)
+		if err != nil {
+			fail()
+			return
+		}
+		e.Hash = hash
+		r.index.set(rel, e)
+	case ReplaceType, DeleteEntry:
+		r.index.remove(rel)
+	case MoveEntry:
+		if from, ok := relativePath(s.Destination, a.Source); ok && from != "" {
+			r.index.move(from, rel)
+		} else {
+			fail()
+		}
+	}
+}
+
+// saveIndex records the index of the run once all the actions succeeded. The index file is removed while the destination
+// is modified, so an interrupted synchronization is followed by a scan of the destination. saved is true if the index is saved.
+func (s *synchronizer) saveIndex(r *run) (saved bool, err error) {
+	r.mu.Lock()
+	failed := len(r.errs) > 0 || r.indexFailed
+	r.mu.Unlock()
+	if failed || r.ctx.Err() != nil {
+		return false, nil
+	}
+	if err := r.index.save(s.indexFile); err != nil {
+		return false, fmt.Errorf("cannot save the destination index: %w", err)
+	}
+	return true, nil
+}
+
+// invalidateIndex removes the index file before the destination is modified.
+func (s *synchronizer) invalidateIndex() error {
+	if err := os.Remove(s.indexFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove the destination index %s: %w", s.indexFile, err)
+	}
+	return nil
+}
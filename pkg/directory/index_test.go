@@ -0,0 +1,165 @@
+package directory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	syncFile "gosync/pkg/file"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingEntryLister lists the entries of the folders and counts the listings.
+type countingEntryLister struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (el *countingEntryLister) listEntries(folder string) (map[string]entryType, error) {
+	el.mu.Lock()
+	el.calls++
+	el.mu.Unlock()
+	return ListEntries(folder)
+}
+
+func Test_synchronizer_Sync_destinationIndex(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	indexFile := path.Join(t.TempDir(), "index.json")
+	now := time.Now().Truncate(time.Second)
+	writeFile(t, source, "file_a", "a", now)
+	writeFile(t, source, "dir_b/file_b", "b", now)
+
+	report, err := NewSynchronizer(source, destination, DestinationIndex(indexFile)).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 2 {
+		t.Errorf("Sync() files copied = %v, want 2", report.FilesCopied)
+	}
+	if _, err := os.Stat(indexFile); err != nil {
+		t.Fatalf("Sync() index not saved: %v", err)
+	}
+
+	// the destination is not listed anymore and its modifications are not seen
+	writeFile(t, source, "file_a", "a2", now.Add(time.Hour))
+	if err := os.Remove(path.Join(destination, "dir_b/file_b")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	el := &countingEntryLister{}
+	report, err = NewSynchronizer(source, destination, DestinationIndex(indexFile), entryLister(el)).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if el.calls != 0 {
+		t.Errorf("Sync() listed the destination %d times, want 0", el.calls)
+	}
+	if report.FilesCopied != 1 || report.UpToDate != 1 {
+		t.Errorf("Sync() report = %+v, want 1 file copied and 1 up to date", report)
+	}
+	wantContent(t, destination, "file_a", "a2")
+	wantContent(t, destination, "dir_b/file_b", "")
+
+	// a rescan finds the drift and repairs it
+	report, err = NewSynchronizer(source, destination, DestinationIndex(indexFile), RescanIndex(true)).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.Drifted != 1 || report.FilesCopied != 1 {
+		t.Errorf("Sync() with rescan report = %+v, want 1 drifted entry and 1 file copied", report)
+	}
+	wantContent(t, destination, "dir_b/file_b", "b")
+}
+
+func Test_synchronizer_Sync_indexHashes(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	indexFile := path.Join(t.TempDir(), "index.json")
+	files := map[string]string{"file_a": "a", "file_b": "b", "dir/file_c": "c", "dir/file_d": "d"}
+	for name, content := range files {
+		writeFile(t, source, name, content, time.Now())
+	}
+
+	opts := []SynchronizerOption{DestinationIndex(indexFile), ChangeDetection(&syncFile.HashCheck{}), MaxGoroutine(4)}
+	if _, err := NewSynchronizer(source, destination, opts...).Sync(); err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	ix, err := loadIndex(indexFile)
+	if err != nil || ix == nil {
+		t.Fatalf("loadIndex() = %v, %v, want the saved index", ix, err)
+	}
+	for name, content := range files {
+		want := sha256.Sum256([]byte(content))
+		if got := ix.Entries[name].Hash; got != hex.EncodeToString(want[:]) {
+			t.Errorf("index hash of %s = %q, want %x", name, got, want)
+		}
+	}
+}
+
+func Test_synchronizer_Sync_indexInsideDestination(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	indexFile := path.Join(destination, ".index.json")
+	now := time.Now().Truncate(time.Second)
+	writeFile(t, source, "file_a", "a", now)
+
+	for _, rescan := range []bool{false, false, true} {
+		report, err := NewSynchronizer(source, destination, DestinationIndex(indexFile), RescanIndex(rescan)).Sync()
+		if err != nil {
+			t.Fatalf("Sync() unexpected error: %v", err)
+		}
+		if report.EntriesDeleted != 0 || report.Drifted != 0 {
+			t.Errorf("Sync() report = %+v, want the index kept", report)
+		}
+		if _, err := os.Stat(indexFile); err != nil {
+			t.Fatalf("Sync() index not saved: %v", err)
+		}
+	}
+}
+
+func Test_synchronizer_Sync_indexNotSavedOnFailure(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	indexFile := path.Join(t.TempDir(), "index.json")
+	now := time.Now().Truncate(time.Second)
+	writeFile(t, source, "file_a", "a", now)
+
+	if _, err := NewSynchronizer(source, destination, DestinationIndex(indexFile)).Sync(); err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	writeFile(t, source, "file_b", "b", now)
+	s := NewSynchronizer(source, destination, DestinationIndex(indexFile), fileCopier(&fakeCopier{err: errors.New("copy failed")}))
+	if _, err := s.Sync(); err == nil {
+		t.Fatalf("Sync() expected an error")
+	}
+	if _, err := os.Stat(indexFile); !os.IsNotExist(err) {
+		t.Errorf("Sync() kept the index after a failure: %v", err)
+	}
+}
+
+func Test_destinationIndex(t *testing.T) {
+	ix := newIndex("")
+	ix.set("dir", indexEntry{entryState: entryState{Type: folder}})
+	ix.set("dir/sub", indexEntry{entryState: entryState{Type: folder}})
+	ix.set("dir/sub/file", indexEntry{entryState: entryState{Type: file, Size: 1}})
+	ix.set("file", indexEntry{entryState: entryState{Type: file, Size: 2}})
+
+	if got := ix.count(""); got != 5 {
+		t.Errorf("count() = %v, want 5", got)
+	}
+	ix.move("dir", "moved")
+	if got := ix.list("moved/sub"); got["file"] != file || len(got) != 1 {
+		t.Errorf("list() after move = %v", got)
+	}
+	if _, ok := ix.get("dir/sub/file"); ok {
+		t.Errorf("get() found an entry moved away")
+	}
+	// an entry replaced by another type loses its content
+	ix.set("moved", indexEntry{entryState: entryState{Type: file}})
+	if got := ix.count(""); got != 3 {
+		t.Errorf("count() after replace = %v, want 3", got)
+	}
+	ix.remove("file")
+	if got := ix.list(""); len(got) != 1 || got["moved"] != file {
+		t.Errorf("list() after remove = %v", got)
+	}
+}
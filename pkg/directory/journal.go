@@ -0,0 +1,255 @@
+package directory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+)
+
+// journal operations
+const (
+	journalPending    = "pending"
+	journalDone       = "done"
+	journalCheckpoint = "checkpoint"
+)
+
+// journalRecord is a line of the journal file.
+type journalRecord struct {
+	Op string `json:"op"`
+	// Path is the slash separated path of the destination entry relative to the destination folder.
+	Path string `json:"path"`
+	// Source is the state of the source entry copied by a done operation.
+	Source     *entryState          `json:"source,omitempty"`
+	Checkpoint *syncFile.Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// journal records the copies of the synchronizations that did not complete: the copies in progress, the copies done
+// and the progress of the copies of large files. The journal of an interrupted synchronization lets the next one
+// copy the entries that were partially written again, skip the entries already copied and resume the large files.
+type journal struct {
+	name, root string
+	// source is the file system of the source folder.
+	source syncFile.FS
+
+	mu   sync.Mutex
+	file *os.File
+	// pending are the copies started and not done, done maps the copies done to the state of their source.
+	pending     map[string]bool
+	done        map[string]entryState
+	checkpoints map[string][]syncFile.Checkpoint
+}
+
+// loadJournal reads the journal file name of the destination folder root, the journal is empty if the file doesn't exist.
+// A truncated last line, written when the process died, is ignored.
+func loadJournal(name, root string) (*journal, error) {
+	j := &journal{name: name, root: root, source: syncFile.OSFS{}}
+	j.reset()
+
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read journal file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			break
+		}
+		j.apply(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read journal file %s: %w", name, err)
+	}
+	return j, nil
+}
+
+func (j *journal) reset() {
+	j.pending = make(map[string]bool)
+	j.done = make(map[string]entryState)
+	j.checkpoints = make(map[string][]syncFile.Checkpoint)
+}
+
+// apply updates the state of the journal with a record.
+func (j *journal) apply(rec journalRecord) {
+	switch rec.Op {
+	case journalPending:
+		j.pending[rec.Path] = true
+		delete(j.done, rec.Path)
+	case journalDone:
+		delete(j.pending, rec.Path)
+		delete(j.checkpoints, rec.Path)
+		if rec.Source != nil {
+			j.done[rec.Path] = *rec.Source
+		}
+	case journalCheckpoint:
+		if rec.Checkpoint != nil {
+			j.checkpoints[rec.Path] = append(j.checkpoints[rec.Path], *rec.Checkpoint)
+		}
+	}
+}
+
+// record appends a record to the journal file and applies it.
+func (j *journal) record(rec journalRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("cannot encode journal record: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		if j.file, err = os.OpenFile(j.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			return fmt.Errorf("cannot open journal file %s: %w", j.name, err)
+		}
+	}
+	if _, err := j.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("cannot write journal file %s: %w", j.name, err)
+	}
+	j.apply(rec)
+	return nil
+}
+
+// rel returns the path of the destination entry relative to the destination folder.
+func (j *journal) rel(destination string) (string, bool) {
+	rel, ok := relativePath(j.root, destination)
+	return rel, ok && rel != ""
+}
+
+// begin records the start of the copy of a.
+func (j *journal) begin(a Action) error {
+	rel, ok := j.rel(a.Destination)
+	if !ok {
+		return nil
+	}
+	return j.record(journalRecord{Op: journalPending, Path: rel})
+}
+
+// complete records the copy of a as done.
+func (j *journal) complete(a Action) error {
+	rel, ok := j.rel(a.Destination)
+	if !ok {
+		return nil
+	}
+	rec := journalRecord{Op: journalDone, Path: rel}
+	if st, err := j.sourceState(a.Source); err == nil {
+		rec.Source = &st
+	}
+	return j.record(rec)
+}
+
+// changed returns whether the destination entry must be copied according to the journal, ok is false if the journal
+// doesn't know the entry. The entries pending may be partially written, the entries done are up to date
+// as long as their source is unchanged.
+func (j *journal) changed(source, destination string) (changed, ok bool) {
+	rel, ok := j.rel(destination)
+	if !ok {
+		return false, false
+	}
+	j.mu.Lock()
+	pending := j.pending[rel]
+	done, isDone := j.done[rel]
+	j.mu.Unlock()
+
+	if pending {
+		return true, true
+	}
+	if isDone {
+		if st, err := j.sourceState(source); err == nil && st.same(done) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// keeps returns true if the temporary file is the partial file of a copy that can be resumed.
+func (j *journal) keeps(tempFile string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for rel := range j.checkpoints {
+		if syncFile.PartialFile(path.Join(j.root, rel)) == tempFile {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *journal) Checkpoints(destinationFile string) []syncFile.Checkpoint {
+	rel, ok := j.rel(destinationFile)
+	if !ok {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]syncFile.Checkpoint(nil), j.checkpoints[rel]...)
+}
+
+func (j *journal) RecordCheckpoint(destinationFile string, c syncFile.Checkpoint) error {
+	rel, ok := j.rel(destinationFile)
+	if !ok {
+		return nil
+	}
+	return j.record(journalRecord{Op: journalCheckpoint, Path: rel, Checkpoint: &c})
+}
+
+// finish closes the journal file, which is removed if the synchronization completed.
+func (j *journal) finish(completed bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var err error
+	if j.file != nil {
+		err = j.file.Close()
+		j.file = nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot close journal file %s: %w", j.name, err)
+	}
+	if !completed {
+		return nil
+	}
+	if err := os.Remove(j.name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove journal file %s: %w", j.name, err)
+	}
+	j.reset()
+	return nil
+}
+
+// sourceState returns the state of the source entry name.
+func (j *journal) sourceState(name string) (entryState, error) {
+	info, err := j.source.Lstat(name)
+	if err != nil {
+		return entryState{}, err
+	}
+	e, err := newIndexEntry(j.source, name, info)
+	return e.entryState, err
+}
+
+// openJournal sets up the journal of the run when the synchronizer has a journal file.
+// The large files are then copied by a syncFile.ResumableCopy unless a custom copier is used.
+func (s *synchronizer) openJournal(r *run) error {
+	if s.journalFile == "" || r.journal != nil {
+		return nil
+	}
+	j, err := loadJournal(s.journalFile, s.Destination)
+	if err != nil {
+		return err
+	}
+	j.source = s.sourceFS
+	r.journal = j
+	if s.resumable {
+		r.copier = &syncFile.ResumableCopy{BasicCopy: s.basicCopy(), Recorder: j}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package directory
+
+import (
+	"errors"
+	syncFile "gosync/pkg/file"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_synchronizer_Sync_journal(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	journalFile := path.Join(t.TempDir(), "journal")
+	now := time.Now().Truncate(time.Second)
+
+	// file_a was being copied in place: its size and time match but its content is partial
+	writeFile(t, source, "file_a", "aaaa", now)
+	writeFile(t, destination, "file_a", "aa\x00\x00", now)
+	// file_b was copied, file_c was not
+	writeFile(t, source, "file_b", "b", now)
+	writeFile(t, destination, "file_b", "b", now)
+	writeFile(t, source, "file_c", "c", now)
+	writeFile(t, destination, "file_c", "c", now)
+
+	j, err := loadJournal(journalFile, destination)
+	if err != nil {
+		t.Fatalf("loadJournal() unexpected error: %v", err)
+	}
+	copyA := Action{Type: CopyFile, Source: path.Join(source, "file_a"), Destination: path.Join(destination, "file_a")}
+	copyB := Action{Type: CopyFile, Source: path.Join(source, "file_b"), Destination: path.Join(destination, "file_b")}
+	for _, err := range []error{j.begin(copyB), j.begin(copyA), j.complete(copyB), j.finish(false)} {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// every file is copied again unless the journal knows better
+	report, err := NewSynchronizer(source, destination, Journal(journalFile), ChangeDetection(&syncFile.AlwaysCopy{})).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 2 || report.UpToDate != 1 {
+		t.Errorf("Sync() report = %+v, want 2 files copied and 1 up to date", report)
+	}
+	wantContent(t, destination, "file_a", "aaaa")
+	if _, err := os.Stat(journalFile); !os.IsNotExist(err) {
+		t.Errorf("Sync() kept the journal of a complete synchronization: %v", err)
+	}
+}
+
+func Test_synchronizer_Plan_journalKeepsPartialFiles(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	journalFile := path.Join(t.TempDir(), "journal")
+	now := time.Now().Truncate(time.Second)
+	writeFile(t, source, "big", "content", now)
+	writeFile(t, destination, path.Base(syncFile.PartialFile("big")), "cont", now)
+	writeFile(t, destination, ".gosync-other-1234.tmp", "", now)
+
+	j, err := loadJournal(journalFile, destination)
+	if err != nil {
+		t.Fatalf("loadJournal() unexpected error: %v", err)
+	}
+	if err := j.RecordCheckpoint(path.Join(destination, "big"), syncFile.Checkpoint{Offset: 4}); err != nil {
+		t.Fatalf("RecordCheckpoint() unexpected error: %v", err)
+	}
+	if err := j.finish(false); err != nil {
+		t.Fatalf("finish() unexpected error: %v", err)
+	}
+
+	p, err := NewSynchronizer(source, destination, Journal(journalFile)).Plan()
+	if err != nil {
+		t.Fatalf("Plan() unexpected error: %v", err)
+	}
+	deleted := make([]string, 0)
+	for _, a := range p {
+		if a.Type == DeleteEntry {
+			deleted = append(deleted, path.Base(a.Destination))
+		}
+	}
+	if len(deleted) != 1 || deleted[0] != ".gosync-other-1234.tmp" {
+		t.Errorf("Plan() deleted %v, want only the temporary file that is not resumed", deleted)
+	}
+}
+
+func Test_synchronizer_Sync_journalInsideFolder(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	_, err := NewSynchronizer(source, destination, Journal(path.Join(destination, "journal"))).Sync()
+	var inputErr *InputError
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Sync() error = %v, want an *InputError", err)
+	}
+}
+
+func Test_loadJournal_truncated(t *testing.T) {
+	journalFile := path.Join(t.TempDir(), "journal")
+	content := `{"op":"pending","path":"a"}` + "\n" + `{"op":"done","path":"b","source":{"type":1,"size":1}}` + "\n" + `{"op":"done","pa`
+	if err := os.WriteFile(journalFile, []byte(content), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+
+	j, err := loadJournal(journalFile, "destination")
+	if err != nil {
+		t.Fatalf("loadJournal() unexpected error: %v", err)
+	}
+	if !j.pending["a"] || len(j.done) != 1 {
+		t.Errorf("loadJournal() pending = %v, done = %v", j.pending, j.done)
+	}
+}
@@ -0,0 +1,138 @@
+package directory
+
+import (
+	"bytes"
+	syncFile "gosync/pkg/file"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// movedFile is a destination file deleted by a plan, which a new file of the source may have been moved from.
+type movedFile struct {
+	name string
+	info os.FileInfo
+	// deleted is the index in the plan of the DeleteEntry action removing the file or the folder containing it.
+	deleted int
+	// hash is the content hash of the file, computed when a new file of the same size is met.
+	hash []byte
+	used bool
+}
+
+// planMoves replaces the copies of the new files of the source that match a file deleted from the destination
+// with a move of the deleted file. The files match if they have the same size and either are the same file,
+// when the source and the destination are on the same file system, or have the same hash. The deleted file must be
+// up to date with the new file for the change detection too, so it is not copied again by the next synchronization.
+// The folders deleted by the plan are deleted after the moves of the files they contain.
+func (s *synchronizer) planMoves(r *run, p Plan) Plan {
+	deleted := make(map[int64][]*movedFile)
+	for i, a := range p {
+		if a.Type != DeleteEntry || syncFile.IsTempFile(filepath.Base(a.Destination)) {
+			continue
+		}
+		s.walkDestination(a.Destination, func(name string, info os.FileInfo) {
+			if info.Mode().IsRegular() && !syncFile.IsTempFile(info.Name()) {
+				deleted[info.Size()] = append(deleted[info.Size()], &movedFile{name: name, info: info, deleted: i})
+			}
+		})
+	}
+	if len(deleted) == 0 {
+		return p
+	}
+
+	// moves replace the copies by index in the plan, from are the indexes of the deletions that files are moved from
+	moves := make(map[int]Action)
+	from := make(map[int]bool)
+	moved := make(map[string]bool)
+	for i, a := range p {
+		if r.ctx.Err() != nil {
+			break
+		}
+		if a.Type != CopyFile {
+			continue
+		}
+		if m := s.movedFrom(r, a, deleted); m != nil {
+			m.used = true
+			moves[i] = Action{Type: MoveEntry, Source: m.name, Destination: a.Destination}
+			from[m.deleted] = true
+			moved[m.name] = true
+		}
+	}
+	if len(moves) == 0 {
+		return p
+	}
+
+	planned := make(Plan, 0, len(p))
+	var deletions Plan
+	for i, a := range p {
+		switch {
+		case moves[i].Type == MoveEntry:
+			planned = append(planned, moves[i])
+		case from[i] && moved[a.Destination]:
+			// the deleted file is moved, there is nothing left to delete
+		case from[i]:
+			deletions = append(deletions, a)
+		default:
+			planned = append(planned, a)
+		}
+	}
+	return append(planned, deletions...)
+}
+
+// movedFrom returns the deleted file the new file of the copy a was moved from, nil if it is a new file.
+func (s *synchronizer) movedFrom(r *run, a Action, deleted map[int64][]*movedFile) *movedFile {
+	if _, err := s.destinationFS.Lstat(a.Destination); err == nil {
+		return nil
+	}
+	info, err := s.sourceFS.Stat(a.Source)
+	if err != nil {
+		return nil
+	}
+
+	var hash []byte
+	for _, m := range deleted[info.Size()] {
+		if m.used {
+			continue
+		}
+		if changed, err := s.changed(r, a.Source, m.name, file); err != nil || changed {
+			continue
+		}
+		if syncFile.SameFile(info, m.info) {
+			return m
+		}
+		if hash == nil {
+			if hash, err = syncFile.HashFS(s.sourceFS, a.Source, syncFile.SHA256); err != nil {
+				return nil
+			}
+		}
+		if m.hash == nil {
+			if m.hash, err = syncFile.HashFS(s.destinationFS, m.name, syncFile.SHA256); err != nil {
+				continue
+			}
+		}
+		if bytes.Equal(hash, m.hash) {
+			return m
+		}
+	}
+	return nil
+}
+
+// walkDestination calls walk with the stats of the destination entry name and of all the entries it contains.
+// The entries that cannot be read are skipped.
+func (s *synchronizer) walkDestination(name string, walk func(name string, info os.FileInfo)) {
+	info, err := s.destinationFS.Lstat(name)
+	if err != nil {
+		return
+	}
+	walk(name, info)
+	if !info.IsDir() {
+		return
+	}
+	entries, err := s.destinationFS.ReadDir(name)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		s.walkDestination(path.Join(name, entry.Name()), walk)
+	}
+}
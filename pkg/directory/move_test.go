@@ -0,0 +1,104 @@
+package directory
+
+import (
+	syncFile "gosync/pkg/file"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_synchronizer_Sync_detectMoves(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name string
+		// moves renames the source entries after the first synchronization
+		moves map[string]string
+		// content replaces the content of a moved file, keeping its size and its modification time
+		content     map[string]string
+		disabled    bool
+		want        func(destination string) Plan
+		wantMoved   int
+		wantCopied  int
+		wantDeleted int
+	}{
+		{"renamed file", map[string]string{"a": "b"}, nil, false, func(d string) Plan {
+			return Plan{{Type: MoveEntry, Source: path.Join(d, "a"), Destination: path.Join(d, "b")}}
+		}, 1, 0, 0},
+		{"file moved to a new folder", map[string]string{"a": "new/a"}, nil, false, func(d string) Plan {
+			return Plan{
+				{Type: CreateDir, Source: "new", Destination: path.Join(d, "new")},
+				{Type: MoveEntry, Source: path.Join(d, "a"), Destination: path.Join(d, "new/a")},
+			}
+		}, 1, 0, 0},
+		{"renamed folder", map[string]string{"dir": "other"}, nil, false, func(d string) Plan {
+			return Plan{
+				{Type: CreateDir, Source: "other", Destination: path.Join(d, "other")},
+				{Type: MoveEntry, Source: path.Join(d, "dir/c"), Destination: path.Join(d, "other/c")},
+				{Type: MoveEntry, Source: path.Join(d, "dir/d"), Destination: path.Join(d, "other/d")},
+				{Type: DeleteEntry, Destination: path.Join(d, "dir")},
+			}
+		}, 2, 0, 1},
+		{"renamed and modified file", map[string]string{"a": "b"}, map[string]string{"b": "content of z"}, false, func(d string) Plan {
+			return Plan{
+				{Type: CopyFile, Source: "b", Destination: path.Join(d, "b")},
+				{Type: DeleteEntry, Destination: path.Join(d, "a")},
+			}
+		}, 0, 1, 1},
+		{"disabled", map[string]string{"a": "b"}, nil, true, func(d string) Plan {
+			return Plan{
+				{Type: CopyFile, Source: "b", Destination: path.Join(d, "b")},
+				{Type: DeleteEntry, Destination: path.Join(d, "a")},
+			}
+		}, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, destination := t.TempDir(), t.TempDir()
+			files := map[string]string{"a": "content of a", "dir/c": "content of c", "dir/d": "content of d"}
+			for name, content := range files {
+				writeFile(t, source, name, content, modTime)
+			}
+			if _, err := NewSynchronizer(source, destination).Sync(); err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			for from, to := range tt.moves {
+				os.MkdirAll(path.Dir(path.Join(source, to)), 0755)
+				if err := os.Rename(path.Join(source, from), path.Join(source, to)); err != nil {
+					t.Fatalf("cannot move entry for test: %v", err)
+				}
+			}
+			for name, content := range tt.content {
+				writeFile(t, source, name, content, modTime)
+			}
+
+			s := NewSynchronizer(source, destination, DetectMoves(!tt.disabled))
+			got, err := s.Plan()
+			if err != nil {
+				t.Fatalf("Plan() unexpected error: %v", err)
+			}
+			want := tt.want(destination)
+			for i := range want {
+				if want[i].Source != "" && !path.IsAbs(want[i].Source) {
+					want[i].Source = path.Join(source, want[i].Source)
+				}
+			}
+			if got = got.Changes(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Plan() = %v, want %v", got, want)
+			}
+
+			report, err := s.Sync()
+			if err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if report.EntriesMoved != tt.wantMoved || report.FilesCopied != tt.wantCopied || report.EntriesDeleted != tt.wantDeleted {
+				t.Errorf("Sync() report = %+v, want %d moved, %d copied and %d deleted", report, tt.wantMoved, tt.wantCopied, tt.wantDeleted)
+			}
+			if diffs, err := Compare(source, destination, ChangeDetection(&syncFile.HashCheck{})); err != nil || len(diffs) != 0 {
+				t.Errorf("Sync() left differences %v, %v", diffs, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+// inotifyNotifier is a notifier based on the Linux inotify API, it watches each directory of the tree.
+type inotifyNotifier struct {
+	// ctx ends the watch, the events are no longer sent once it is done.
+	ctx  context.Context
+	root string
+	fd   int
+	file *os.File
+
+	mu sync.Mutex
+	// watches maps the watch descriptors to the directories relative to root
+	watches map[int32]string
+
+	changeC chan change
+	errorC  chan error
+}
+
+func newNotifier(ctx context.Context, root string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize inotify: %w", err)
+	}
+
+	n := &inotifyNotifier{
+		ctx:     ctx,
+		root:    root,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int32]string),
+		changeC: make(chan change, 1024),
+		errorC:  make(chan error, 1),
+	}
+	go n.readEvents()
+
+	return n, nil
+}
+
+func (n *inotifyNotifier) addTree(rel string) error {
+	return filepath.WalkDir(path.Join(n.root, rel), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the directory may be removed while it is walked
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		wd, err := syscall.InotifyAddWatch(n.fd, name, inotifyMask)
+		if err != nil {
+			if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) {
+				return nil
+			}
+			return fmt.Errorf("cannot watch directory %s: %w", name, err)
+		}
+
+		n.mu.Lock()
+		n.watches[int32(wd)] = strings.Trim(strings.TrimPrefix(filepath.ToSlash(name), filepath.ToSlash(n.root)), "/")
+		n.mu.Unlock()
+		return nil
+	})
+}
+
+func (n *inotifyNotifier) changes() <-chan change {
+	return n.changeC
+}
+
+func (n *inotifyNotifier) errors() <-chan error {
+	return n.errorC
+}
+
+func (n *inotifyNotifier) close() error {
+	return n.file.Close()
+}
+
+// readEvents reads the inotify events until the notifier is closed.
+func (n *inotifyNotifier) readEvents() {
+	defer close(n.changeC)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				n.fail(fmt.Errorf("cannot read inotify events: %w", err))
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= size; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+			name := strings.TrimRight(string(buf[nameStart:offset]), "\x00")
+
+			if err := n.handle(event.Wd, event.Mask, name); err != nil {
+				n.fail(err)
+				return
+			}
+		}
+	}
+}
+
+func (n *inotifyNotifier) handle(wd int32, mask uint32, name string) error {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// events were lost, the whole tree must be synchronized again
+		return n.send(change{})
+	}
+
+	n.mu.Lock()
+	dir, ok := n.watches[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.watches, wd)
+	}
+	n.mu.Unlock()
+	if !ok || name == "" {
+		return nil
+	}
+
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		if err := n.addTree(path.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return n.send(change{dir: dir, name: name})
+}
+
+// send sends the change c, unless the watch ends first.
+func (n *inotifyNotifier) send(c change) error {
+	select {
+	case n.changeC <- c:
+		return nil
+	case <-n.ctx.Done():
+		return n.ctx.Err()
+	}
+}
+
+// fail sends the failure err of the notifier, unless the watch ends first.
+func (n *inotifyNotifier) fail(err error) {
+	select {
+	case n.errorC <- err:
+	case <-n.ctx.Done():
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package directory
+
+import (
+	"context"
+	"errors"
+)
+
+func newNotifier(context.Context, string) (notifier, error) {
+	return nil, errors.New("watch mode is only supported on Linux")
+}
@@ -1,10 +1,15 @@
 package directory
 
-import syncFile "gosync/pkg/file"
+import (
+	syncFile "gosync/pkg/file"
+	"gosync/pkg/filter"
+	"time"
+)
 
 const (
 	defaultMaxGoroutine   = 20
 	defaultCopyBufferSize = 20
+	defaultWatchDebounce  = 500 * time.Millisecond
 )
 
 // SynchronizerOption sets options such as  MaxGoroutine and CopyBufferSize
@@ -15,8 +20,10 @@ type SynchronizerOption interface {
 var defaultSynchronizer = synchronizer{
 	maxGoroutine:   defaultMaxGoroutine,
 	copyBufferSize: defaultCopyBufferSize,
-	fileCopier:     &syncFile.BasicCopy{},
-	entryLister:    &basicDirEntryLister{},
+	preserve:       syncFile.DefaultAttributes,
+	atomic:         true,
+	watchDebounce:  defaultWatchDebounce,
+	changeDetector: &syncFile.QuickCheck{},
 }
 
 type funcSynchronizerOption struct {
@@ -52,6 +59,257 @@ func CopyBufferSize(size int) SynchronizerOption {
 	})
 }
 
+// ChangeDetection lets you set the strategy used to decide if a file already present at the destination must be copied again.
+func ChangeDetection(cd syncFile.ChangeDetector) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		if cd != nil {
+			s.changeDetector = cd
+		}
+	})
+}
+
+// PreserveAttributes lets you set the attributes of the source entries kept on the files and the directories created at the destination.
+// It is ignored when a custom syncFile.Copier is used for the files. Without syncFile.Times the default QuickCheck
+// compares the sizes of the files only, their modification times differ.
+func PreserveAttributes(attrs syncFile.Attributes) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.preserve = attrs
+	})
+}
+
+// AtomicCopy lets you enable or disable the copy of files through a temporary file renamed over the destination file.
+// It is enabled by default and ignored when a custom syncFile.Copier is used for the files.
+func AtomicCopy(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.atomic = enabled
+	})
+}
+
+// SparseFiles lets you skip the blocks of zeros of the copied files, so they become holes at the destination even if
+// they are written in the source. The holes of the sparse source files are always kept.
+// It is ignored when a custom syncFile.Copier is used for the files.
+func SparseFiles(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.sparse = enabled
+	})
+}
+
+// FastCopy lets you copy the files with a syncFile.FastCopy using the method, which relies on the copy paths of the kernel:
+// reflinks, copy_file_range and sendfile. AutoCopy chooses the method per destination file system.
+// It is ignored when DeltaTransfer is enabled, when a Journal resumes the copies or when a custom syncFile.Copier is used.
+func FastCopy(method syncFile.CopyMethod) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.fastCopy = true
+		s.copyMethod = method
+	})
+}
+
+// DeltaTransfer lets you enable the copy of the modified files with a syncFile.DeltaCopy, which reuses the unchanged blocks
+// of the destination files. It is ignored when a custom syncFile.Copier is used for the files.
+func DeltaTransfer(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.delta = enabled
+	})
+}
+
+// VerifyCopies lets you hash every copied file and its source with the algorithm, a difference is a failed copy
+// whose error is a *syncFile.MismatchError. An empty algorithm disables the verification.
+func VerifyCopies(algorithm syncFile.HashAlgorithm) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.verify = algorithm
+	})
+}
+
+// Filter lets you set the rules selecting the entries to synchronize.
+// Excluded entries are neither copied nor deleted from the destination unless DeleteExcluded is enabled.
+func Filter(f *filter.Filter) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.filter = f
+	})
+}
+
+// DeleteExcluded lets you delete the destination entries excluded by the Filter.
+func DeleteExcluded(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.deleteExcluded = enabled
+	})
+}
+
+// ContinueOnError lets the synchronization continue past the failure of a directory: the error is recorded,
+// the directory is skipped and the rest of the tree is synchronized.
+// By default the synchronization stops at the first failure that is not a copy failure.
+func ContinueOnError(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.continueOnError = enabled
+	})
+}
+
+// MaxErrors lets you set the number of failures after which the synchronization stops, 0 means no limit.
+func MaxErrors(m int) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		if m >= 0 {
+			s.maxErrors = m
+		}
+	})
+}
+
+// WatchDebounce lets you set how long a Watcher waits without any new change before synchronizing a burst of changes.
+func WatchDebounce(d time.Duration) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		if d > 0 {
+			s.watchDebounce = d
+		}
+	})
+}
+
+// OnConflict lets you set how a TwoWaySynchronizer resolves the entries changed on both sides, NewerWins by default.
+func OnConflict(p ConflictPolicy) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.conflictPolicy = p
+	})
+}
+
+// BackupDir lets you move the entries deleted or overwritten at the destination into dir instead of removing them.
+// Each synchronization backs up its entries in a new generation, a sub directory named after its start time,
+// with the paths relative to the destination. dir cannot be inside the source or the destination.
+func BackupDir(dir string) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.backupDir = dir
+	})
+}
+
+// KeepBackups lets you set the number of backup generations kept, the older ones are pruned. 0 keeps them all.
+func KeepBackups(n int) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		if n >= 0 {
+			s.keepBackups = n
+		}
+	})
+}
+
+// BackupMaxAge lets you set the age after which the backup generations are pruned. 0 keeps them all.
+func BackupMaxAge(d time.Duration) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		if d >= 0 {
+			s.backupMaxAge = d
+		}
+	})
+}
+
+// NoDelete lets you keep the destination entries that don't exist in the source instead of deleting them.
+// The entries whose type differs from the source are still replaced, except the folders that are not empty:
+// they are kept and the source entry is skipped with a warning.
+func NoDelete(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.noDelete = enabled
+	})
+}
+
+// MaxDelete lets you set the number of entries above which a synchronization refuses to delete anything,
+// the content of a deleted folder counts. 0 means no limit.
+func MaxDelete(n int) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		if n >= 0 {
+			s.maxDelete = n
+		}
+	})
+}
+
+// MaxDeletePercent lets you set the percentage of the destination entries above which a synchronization
+// refuses to delete anything. 0 means no limit.
+func MaxDeletePercent(p float64) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		if p >= 0 && p <= 100 {
+			s.maxDeletePercent = p
+		}
+	})
+}
+
+// DestinationIndex lets you keep the state of the destination folder in the index file name between synchronizations.
+// The destination entries are then listed and compared from the index instead of being read, only the source is read.
+// The index is saved by the synchronizations without any failure, the first synchronization scans the destination.
+// It is ignored by a TwoWaySynchronizer and it cannot be inside the source.
+func DestinationIndex(name string) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.indexFile = name
+	})
+}
+
+// RescanIndex lets you scan the destination folder instead of trusting the destination index, the entries modified
+// outside of the synchronizations are reported as drifted and the index is rebuilt.
+func RescanIndex(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.rescan = enabled
+	})
+}
+
+// PreserveHardLinks lets you recreate the groups of hard links of the source at the destination: the first file of a group
+// is copied and the other ones are linked to it instead of being copied. The groups are detected by device and inode
+// on Unix systems, a group is only recreated within a synchronized tree. It is ignored by a TwoWaySynchronizer.
+func PreserveHardLinks(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.hardLinks = enabled
+	})
+}
+
+// Symlinks lets you set how the symlinks of the source are synchronized, PreserveLinks by default.
+// It is ignored by a TwoWaySynchronizer, which preserves the symlinks.
+func Symlinks(p SymlinkPolicy) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.symlinks = p
+	})
+}
+
+// SpecialFiles lets you set how the special files of type t are synchronized, SkipSpecial by default.
+// A TwoWaySynchronizer always leaves the special files out.
+func SpecialFiles(t SpecialFileType, p SpecialFilePolicy) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		if t >= 0 && int(t) < len(s.specialFiles) {
+			s.specialFiles[t] = p
+		}
+	})
+}
+
+// DetectMoves lets you move the files renamed or moved in the source at the destination instead of copying them again:
+// a new file of the source that matches a file deleted from the destination by its size and its content, or that is the same
+// file when the folders are on the same file system, is moved from the deleted file. The matching files must be up to date
+// for the change detection too. It is ignored by a TwoWaySynchronizer and when NoDelete is enabled.
+func DetectMoves(enabled bool) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.detectMoves = enabled
+	})
+}
+
+// Journal lets you record the copies in progress and done in the journal file name, so a synchronization interrupted
+// by the end of the process is resumed by the next one: the files that were being copied are copied again, the files already
+// copied are not compared again unless their source changed, and the copies of large files resume from their last checkpoint.
+// The journal file is removed once a synchronization completes without error. The copies are only resumed by the default
+// copier, when DeltaTransfer is disabled. The journal file cannot be inside the folders, it is ignored by a TwoWaySynchronizer.
+func Journal(name string) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.journalFile = name
+	})
+}
+
+// SourceFS lets you synchronize the source folder from f instead of the local disk, and DestinationFS the destination
+// folder to f. The ignore files are read from the source file system and the backups are kept on the destination one,
+// the files of DestinationIndex and Journal stay on the local disk. The extended attributes need both file systems
+// to be syncFile.XattrFS and the recreated special files a syncFile.SpecialFS destination, they are rejected otherwise.
+// The kernel copy methods of FastCopy and the detection of the holes of the sparse files only apply to the local disk.
+// A TwoWaySynchronizer needs both folders on the same file system, a Watcher only watches a source folder on the local disk.
+func SourceFS(f syncFile.FS) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.sourceFS = f
+	})
+}
+
+// DestinationFS lets you synchronize the destination folder to f instead of the local disk, see SourceFS.
+func DestinationFS(f syncFile.FS) SynchronizerOption {
+	return newFuncSynchronizerOption(func(s *synchronizer) {
+		s.destinationFS = f
+	})
+}
+
 // fileCopier lets you set up the syncFile.Copier for testing purpose.
 func fileCopier(fc syncFile.Copier) SynchronizerOption {
 	return newFuncSynchronizerOption(func(s *synchronizer) {
@@ -1,7 +1,9 @@
 package directory
 
 import (
+	syncFile "gosync/pkg/file"
 	"testing"
+	"time"
 )
 
 func Test_copyBufferSize(t *testing.T) {
@@ -57,3 +59,108 @@ func Test_fileCopier(t *testing.T) {
 	}
 
 }
+
+func Test_changeDetection(t *testing.T) {
+	s := defaultSynchronizer
+	cd := &fakeChangeDetector{}
+	ChangeDetection(cd).apply(&s)
+	if s.changeDetector != cd {
+		t.Errorf("ChangeDetection() = %v, want %v", s.changeDetector, cd)
+	}
+
+	ChangeDetection(nil).apply(&s)
+	if s.changeDetector != cd {
+		t.Errorf("ChangeDetection(nil) = %v, want %v", s.changeDetector, cd)
+	}
+}
+
+func Test_preserveAttributes(t *testing.T) {
+	s := defaultSynchronizer
+	if s.preserve != syncFile.DefaultAttributes {
+		t.Errorf("default preserve = %v, want %v", s.preserve, syncFile.DefaultAttributes)
+	}
+
+	PreserveAttributes(syncFile.Mode | syncFile.Owner).apply(&s)
+	if s.preserve != syncFile.Mode|syncFile.Owner {
+		t.Errorf("PreserveAttributes() = %v, want %v", s.preserve, syncFile.Mode|syncFile.Owner)
+	}
+}
+
+func Test_atomicCopy(t *testing.T) {
+	s := defaultSynchronizer
+	if !s.atomic {
+		t.Errorf("default atomic = %v, want true", s.atomic)
+	}
+
+	AtomicCopy(false).apply(&s)
+	if s.atomic {
+		t.Errorf("AtomicCopy(false) = %v, want false", s.atomic)
+	}
+}
+
+func Test_maxErrors(t *testing.T) {
+	s := defaultSynchronizer
+
+	tests := []struct {
+		name string
+		max  int
+		want int
+	}{
+		{"negative", -1, 0},
+		{"zero", 0, 0},
+		{"10", 10, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			MaxErrors(tt.max).apply(&s)
+			if s.maxErrors != tt.want {
+				t.Errorf("MaxErrors() = %v, want %v", s.maxErrors, tt.want)
+			}
+		})
+	}
+}
+
+func Test_watchDebounce(t *testing.T) {
+	s := defaultSynchronizer
+
+	tests := []struct {
+		name     string
+		debounce time.Duration
+		want     time.Duration
+	}{
+		{"negative", -time.Second, defaultWatchDebounce},
+		{"zero", 0, defaultWatchDebounce},
+		{"1s", time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			WatchDebounce(tt.debounce).apply(&s)
+			if s.watchDebounce != tt.want {
+				t.Errorf("WatchDebounce() = %v, want %v", s.watchDebounce, tt.want)
+			}
+		})
+	}
+}
+
+func Test_deltaTransfer(t *testing.T) {
+	s := newSynchronizer("a", "b", DeltaTransfer(true))
+	if _, ok := s.fileCopier.(*syncFile.DeltaCopy); !ok {
+		t.Errorf("DeltaTransfer(true) file copier = %T, want *syncFile.DeltaCopy", s.fileCopier)
+	}
+	s = newSynchronizer("a", "b")
+	if _, ok := s.fileCopier.(*syncFile.BasicCopy); !ok {
+		t.Errorf("default file copier = %T, want *syncFile.BasicCopy", s.fileCopier)
+	}
+}
+
+func TestParseSpecialFilePolicy(t *testing.T) {
+	for _, p := range []SpecialFilePolicy{SkipSpecial, RecreateSpecial, FailSpecial} {
+		got, err := ParseSpecialFilePolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseSpecialFilePolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseSpecialFilePolicy("ignore"); err == nil {
+		t.Errorf("ParseSpecialFilePolicy() expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,103 @@
+package directory
+
+import "fmt"
+
+// ActionType is the kind of operation performed on the destination during a synchronization.
+type ActionType int
+
+const (
+	// CopyFile copies a regular file from the source to the destination.
+	CopyFile = ActionType(iota)
+	// CopySymlink recreates a symlink of the source at the destination.
+	CopySymlink
+	// CreateDir creates a directory at the destination.
+	CreateDir
+	// ReplaceType removes a destination entry whose type differs from the source entry with the same name.
+	ReplaceType
+	// DeleteEntry removes a destination entry that doesn't exist in the source.
+	DeleteEntry
+	// UpToDate leaves a destination file or symlink that is already up to date untouched.
+	UpToDate
+	// Scan reads the entries of a source and a destination folder, it is never part of a plan
+	// and only identifies the failures of the planning.
+	Scan
+	// MoveEntry renames the Source entry to the Destination, both on the same side of the synchronization.
+	MoveEntry
+	// LinkFile replaces the Destination with a hard link to the destination file Link, copied from another link
+	// to the same source file.
+	LinkFile
+	// CreateSpecial recreates a named pipe, a socket or a device node of the source at the destination.
+	CreateSpecial
+	// SkipEntry leaves a source entry out of the synchronization, such as a skipped special file or symlink.
+	// The destination entry with the same name is kept.
+	SkipEntry
+)
+
+func (t ActionType) String() string {
+	switch t {
+	case CopyFile:
+		return "copy file"
+	case CopySymlink:
+		return "copy symlink"
+	case CreateDir:
+		return "create dir"
+	case ReplaceType:
+		return "replace type"
+	case DeleteEntry:
+		return "delete entry"
+	case UpToDate:
+		return "up to date"
+	case Scan:
+		return "scan"
+	case MoveEntry:
+		return "move entry"
+	case LinkFile:
+		return "link file"
+	case CreateSpecial:
+		return "create special file"
+	case SkipEntry:
+		return "skip entry"
+	default:
+		return fmt.Sprintf("unknown action %d", int(t))
+	}
+}
+
+// Action is a single operation of a synchronization plan.
+type Action struct {
+	Type ActionType
+	// Source is the source entry of the action, it is empty for DeleteEntry.
+	Source string
+	// Destination is the destination entry modified by the action.
+	Destination string
+	// Link is the destination file a LinkFile action links the Destination to,
+	// or the target of the symlink created by a CopySymlink action when it differs from the target of the Source.
+	Link string
+}
+
+func (a Action) String() string {
+	if a.Link != "" && a.Type == CopySymlink {
+		return fmt.Sprintf("%s %s -> %s (target %s)", a.Type, a.Source, a.Destination, a.Link)
+	}
+	if a.Link != "" {
+		return fmt.Sprintf("%s %s -> %s (linked to %s)", a.Type, a.Source, a.Destination, a.Link)
+	}
+	if a.Source == "" {
+		return fmt.Sprintf("%s %s", a.Type, a.Destination)
+	}
+	return fmt.Sprintf("%s %s -> %s", a.Type, a.Source, a.Destination)
+}
+
+// Plan is the ordered list of actions that synchronizes the destination with the source.
+// A directory is always created before the entries it contains.
+type Plan []Action
+
+// Changes returns the actions of the plan that modify the destination.
+func (p Plan) Changes() Plan {
+	changes := make(Plan, 0, len(p))
+	for _, a := range p {
+		if a.Type != UpToDate {
+			changes = append(changes, a)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,208 @@
+package directory
+
+import (
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Report describes the work done by a synchronization.
+type Report struct {
+	FilesCopied int   `json:"files_copied"`
+	BytesCopied int64 `json:"bytes_copied"`
+	// AllocatedBytes is the disk space allocated to the copied files, which is less than their apparent size,
+	// BytesCopied, when they are sparse.
+	AllocatedBytes int64 `json:"allocated_bytes,omitempty"`
+	// LiteralBytes and MatchedBytes split the bytes copied by a delta transfer between the data written from the source
+	// and the data reused from the blocks of the previous destination files.
+	LiteralBytes int64 `json:"literal_bytes,omitempty"`
+	MatchedBytes int64 `json:"matched_bytes,omitempty"`
+	// ResumedBytes is the number of bytes of the partial files of interrupted copies reused by resumed copies.
+	ResumedBytes    int64 `json:"resumed_bytes,omitempty"`
+	SymlinksCreated int   `json:"symlinks_created"`
+	DirsCreated     int   `json:"dirs_created"`
+	// HardLinksCreated is the number of files linked to another copied file instead of being copied.
+	HardLinksCreated int `json:"hard_links_created,omitempty"`
+	// SpecialFilesCreated is the number of named pipes, sockets and device nodes recreated at the destination.
+	SpecialFilesCreated int `json:"special_files_created,omitempty"`
+	// FilesVerified is the number of copied files whose content is verified against their source.
+	FilesVerified  int `json:"files_verified,omitempty"`
+	EntriesDeleted int `json:"entries_deleted"`
+	// EntriesMoved is the number of destination entries renamed instead of being copied again, such as the files moved
+	// in the source.
+	EntriesMoved int `json:"entries_moved,omitempty"`
+	// EntriesBackedUp is the number of deleted or overwritten entries moved to the backup directory.
+	EntriesBackedUp int `json:"entries_backed_up"`
+	// UpToDate is the number of files and symlinks skipped because they are up to date.
+	UpToDate int `json:"up_to_date"`
+	// Drifted is the number of destination entries found different from the destination index by a rescan.
+	Drifted int `json:"drifted,omitempty"`
+	// Conflicts are the entries changed on both sides of a two-way synchronization.
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+	// Warnings are the source entries left out of the synchronization, such as the skipped special files.
+	Warnings []string `json:"warnings,omitempty"`
+	// Errors is the number of failed actions by ErrorKind.
+	Errors  map[string]int `json:"errors"`
+	Elapsed time.Duration  `json:"elapsed_ns"`
+
+	mu sync.Mutex
+}
+
+func newReport() *Report {
+	return &Report{Errors: make(map[string]int)}
+}
+
+// record adds a successful action to the report, size is the number of bytes copied by the action.
+func (r *Report) record(a Action, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch a.Type {
+	case CopyFile:
+		r.FilesCopied++
+		r.BytesCopied += size
+	case CopySymlink:
+		r.SymlinksCreated++
+	case CreateDir:
+		r.DirsCreated++
+	case LinkFile:
+		r.HardLinksCreated++
+	case CreateSpecial:
+		r.SpecialFilesCreated++
+	case MoveEntry:
+		r.EntriesMoved++
+	case ReplaceType, DeleteEntry:
+		r.EntriesDeleted++
+	case UpToDate:
+		r.UpToDate++
+	}
+}
+
+// recordBackup adds an entry backed up before its deletion or its replacement to the report.
+func (r *Report) recordBackup() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.EntriesBackedUp++
+}
+
+// recordDelta adds the data written by the delta copies between the stats before and after.
+func (r *Report) recordDelta(after, before syncFile.DeltaStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.LiteralBytes += after.LiteralBytes - before.LiteralBytes
+	r.MatchedBytes += after.MatchedBytes - before.MatchedBytes
+}
+
+// recordResumed adds the bytes of partial files reused by resumed copies.
+func (r *Report) recordResumed(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ResumedBytes += n
+}
+
+// recordWarning adds a warning to the report.
+func (r *Report) recordWarning(w string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Warnings = append(r.Warnings, w)
+}
+
+// recordAllocated adds the disk space allocated to a copied file.
+func (r *Report) recordAllocated(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.AllocatedBytes += n
+}
+
+// recordVerified adds a copied file verified against its source to the report.
+func (r *Report) recordVerified() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FilesVerified++
+}
+
+// recordError adds a failed action to the report.
+func (r *Report) recordError(err *EntryError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Errors[string(err.Kind())]++
+}
+
+// ErrorCount returns the total number of failed actions.
+func (r *Report) ErrorCount() int {
+	n := 0
+	for _, count := range r.Errors {
+		n += count
+	}
+	return n
+}
+
+func (r *Report) String() string {
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "files copied: %d (%d bytes)\n", r.FilesCopied, r.BytesCopied)
+	if r.LiteralBytes > 0 || r.MatchedBytes > 0 {
+		fmt.Fprintf(&b, "  delta transfer: %d literal bytes, %d matched bytes\n", r.LiteralBytes, r.MatchedBytes)
+	}
+	if r.AllocatedBytes > 0 && r.AllocatedBytes < r.BytesCopied {
+		fmt.Fprintf(&b, "  sparse files: %d bytes allocated\n", r.AllocatedBytes)
+	}
+	if r.ResumedBytes > 0 {
+		fmt.Fprintf(&b, "  resumed copies: %d bytes reused\n", r.ResumedBytes)
+	}
+	if r.FilesVerified > 0 {
+		fmt.Fprintf(&b, "files verified: %d\n", r.FilesVerified)
+	}
+	fmt.Fprintf(&b, "symlinks created: %d\n", r.SymlinksCreated)
+	fmt.Fprintf(&b, "directories created: %d\n", r.DirsCreated)
+	if r.HardLinksCreated > 0 {
+		fmt.Fprintf(&b, "hard links created: %d\n", r.HardLinksCreated)
+	}
+	if r.SpecialFilesCreated > 0 {
+		fmt.Fprintf(&b, "special files created: %d\n", r.SpecialFilesCreated)
+	}
+	if r.EntriesMoved > 0 {
+		fmt.Fprintf(&b, "entries moved: %d\n", r.EntriesMoved)
+	}
+	fmt.Fprintf(&b, "entries deleted: %d\n", r.EntriesDeleted)
+	if r.EntriesBackedUp > 0 {
+		fmt.Fprintf(&b, "entries backed up: %d\n", r.EntriesBackedUp)
+	}
+	fmt.Fprintf(&b, "entries up to date: %d\n", r.UpToDate)
+	if r.Drifted > 0 {
+		fmt.Fprintf(&b, "entries drifted from the index: %d\n", r.Drifted)
+	}
+	if len(r.Conflicts) > 0 {
+		fmt.Fprintf(&b, "conflicts: %d\n", len(r.Conflicts))
+		for _, c := range r.Conflicts {
+			fmt.Fprintf(&b, "  %s\n", c)
+		}
+	}
+	if len(r.Warnings) > 0 {
+		fmt.Fprintf(&b, "warnings: %d\n", len(r.Warnings))
+		for _, w := range r.Warnings {
+			fmt.Fprintf(&b, "  %s\n", w)
+		}
+	}
+	fmt.Fprintf(&b, "errors: %d\n", r.ErrorCount())
+
+	categories := make([]string, 0, len(r.Errors))
+	for category := range r.Errors {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		fmt.Fprintf(&b, "  %s: %d\n", category, r.Errors[category])
+	}
+	fmt.Fprintf(&b, "elapsed time: %s", r.Elapsed)
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package directory
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestReport_record(t *testing.T) {
+	r := newReport()
+	r.record(Action{Type: CopyFile}, 10)
+	r.record(Action{Type: CopyFile}, 5)
+	r.recordError(newEntryError(Action{Type: CopyFile}, fs.ErrPermission))
+	r.record(Action{Type: CopySymlink}, 0)
+	r.record(Action{Type: CreateDir}, 0)
+	r.record(Action{Type: ReplaceType}, 0)
+	r.record(Action{Type: DeleteEntry}, 0)
+	r.recordError(newEntryError(Action{Type: DeleteEntry}, errors.New("delete failed")))
+	r.record(Action{Type: UpToDate}, 0)
+
+	if r.FilesCopied != 2 || r.BytesCopied != 15 {
+		t.Errorf("record() files copied = %v (%v bytes), want 2 (15 bytes)", r.FilesCopied, r.BytesCopied)
+	}
+	if r.SymlinksCreated != 1 || r.DirsCreated != 1 || r.EntriesDeleted != 2 || r.UpToDate != 1 {
+		t.Errorf("record() report = %+v", r)
+	}
+	if r.ErrorCount() != 2 || r.Errors[string(PermissionError)] != 1 || r.Errors[string(OtherError)] != 1 {
+		t.Errorf("recordError() errors = %v", r.Errors)
+	}
+	if !strings.Contains(r.String(), "files copied: 2 (15 bytes)") {
+		t.Errorf("String() = %v", r.String())
+	}
+}
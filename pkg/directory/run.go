@@ -0,0 +1,90 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"sync"
+	"time"
+)
+
+// ErrMaxErrors is wrapped by the error returned when a synchronization stops because it reached its maximum number of errors.
+var ErrMaxErrors = errors.New("maximum number of errors reached")
+
+// run is the state of a single planning or synchronization.
+type run struct {
+	// parent is the context given by the caller, ctx is canceled when the parent is or when the error budget is exhausted.
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	report *Report
+	// started is the start time of the run, it names its backup generation.
+	started time.Time
+	// copier copies the files, it is the copier of the synchronizer unless the run resumes copies with its journal.
+	copier syncFile.Copier
+	// journal is the journal of the run, nil if the synchronizer has no journal file.
+	journal *journal
+	// index is the destination index of the run, nil if the synchronizer has no index file.
+	index *destinationIndex
+
+	maxErrors int
+	mu        sync.Mutex
+	errs      []*EntryError
+	// indexFailed is true when an entry of the destination cannot be recorded in the index, which is then not saved.
+	indexFailed bool
+	// batch is true when the run applies several plans, its index is then invalidated and saved once by the caller
+	// instead of by each of them.
+	batch bool
+}
+
+func (s *synchronizer) newRun(parent context.Context) *run {
+	ctx, cancel := context.WithCancel(parent)
+	return &run{
+		parent:    parent,
+		ctx:       ctx,
+		cancel:    cancel,
+		report:    newReport(),
+		started:   time.Now(),
+		copier:    s.fileCopier,
+		maxErrors: s.maxErrors,
+		errs:      make([]*EntryError, 0),
+	}
+}
+
+// fail records the failure of an action and stops the run when there are more errors than maxErrors.
+func (r *run) fail(err *EntryError) {
+	r.report.recordError(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err)
+	if r.maxErrors > 0 && len(r.errs) > r.maxErrors {
+		r.cancel()
+	}
+}
+
+// aborted returns true if err is caused by the end of the run.
+func (r *run) aborted(err error) bool {
+	return r.ctx.Err() != nil && errors.Is(err, r.ctx.Err())
+}
+
+// result returns the error of the run given abortErr, the error that stopped it early if any.
+func (r *run) result(abortErr error) error {
+	if err := r.parent.Err(); err != nil {
+		return &CanceledError{Err: err}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxErrors > 0 && len(r.errs) > r.maxErrors {
+		return fmt.Errorf("%w: %w", ErrMaxErrors, &CopyError{Errors: r.errs})
+	}
+	if abortErr != nil {
+		return abortErr
+	}
+	if len(r.errs) > 0 {
+		return &CopyError{Errors: r.errs}
+	}
+	return nil
+}
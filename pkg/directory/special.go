@@ -0,0 +1,79 @@
+package directory
+
+import "fmt"
+
+// SpecialFileType is a kind of special file, whose content cannot be copied.
+type SpecialFileType int
+
+const (
+	// NamedPipe is a FIFO.
+	NamedPipe = SpecialFileType(iota)
+	// Socket is a Unix domain socket.
+	Socket
+	// Device is a character or a block device node.
+	Device
+)
+
+func (t SpecialFileType) String() string {
+	switch t {
+	case NamedPipe:
+		return "named pipe"
+	case Socket:
+		return "socket"
+	case Device:
+		return "device"
+	default:
+		return fmt.Sprintf("unknown special file type %d", int(t))
+	}
+}
+
+// specialFileType returns the kind of special file of the entry type t, ok is false if t is not a special file.
+func specialFileType(t entryType) (SpecialFileType, bool) {
+	switch t {
+	case fifo:
+		return NamedPipe, true
+	case socket:
+		return Socket, true
+	case device:
+		return Device, true
+	default:
+		return 0, false
+	}
+}
+
+// SpecialFilePolicy decides how the special files of the source are synchronized.
+type SpecialFilePolicy int
+
+const (
+	// SkipSpecial leaves the special files out of the synchronization with a warning in the report,
+	// the destination entries with the same names are kept.
+	SkipSpecial = SpecialFilePolicy(iota)
+	// RecreateSpecial recreates the special files at the destination with mknod. Recreating a device node
+	// usually requires the privileges of root, its failure is recorded as a failed action.
+	RecreateSpecial
+	// FailSpecial fails the planning of the special files.
+	FailSpecial
+)
+
+// ParseSpecialFilePolicy parses the name of a policy: skip, recreate or error.
+func ParseSpecialFilePolicy(name string) (SpecialFilePolicy, error) {
+	for _, p := range []SpecialFilePolicy{SkipSpecial, RecreateSpecial, FailSpecial} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown special file policy %q", name)
+}
+
+func (p SpecialFilePolicy) String() string {
+	switch p {
+	case SkipSpecial:
+		return "skip"
+	case RecreateSpecial:
+		return "recreate"
+	case FailSpecial:
+		return "error"
+	default:
+		return fmt.Sprintf("unknown policy %d", int(p))
+	}
+}
@@ -0,0 +1,83 @@
+//go:build linux || darwin
+
+package directory
+
+import (
+	"errors"
+	syncFile "gosync/pkg/file"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_synchronizer_Sync_specialFiles(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name         string
+		policy       SpecialFilePolicy
+		wantCreated  int
+		wantWarnings int
+		wantErr      bool
+		// wantMode is the type of the destination entry named after the fifo
+		wantMode os.FileMode
+	}{
+		{"skipped", SkipSpecial, 0, 1, false, 0},
+		{"recreated", RecreateSpecial, 1, 0, false, os.ModeNamedPipe},
+		{"rejected", FailSpecial, 0, 0, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, destination := t.TempDir(), t.TempDir()
+			writeFile(t, source, "file_a", "a", now)
+			if err := syscall.Mkfifo(path.Join(source, "fifo"), 0644); err != nil {
+				t.Fatalf("cannot create fifo for test: %v", err)
+			}
+			// the destination entry of a skipped special file is kept
+			writeFile(t, destination, "fifo", "previous", now)
+
+			s := NewSynchronizer(source, destination, SpecialFiles(NamedPipe, tt.policy), ContinueOnError(true))
+			report, err := s.Sync()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, syncFile.ErrSpecialFile) {
+				t.Errorf("Sync() error = %v, want syncFile.ErrSpecialFile", err)
+			}
+			if report.FilesCopied != 1 || report.SpecialFilesCreated != tt.wantCreated || len(report.Warnings) != tt.wantWarnings {
+				t.Errorf("Sync() report = %+v", report)
+			}
+			info, err := os.Lstat(path.Join(destination, "fifo"))
+			if err != nil || info.Mode().Type() != tt.wantMode {
+				t.Errorf("Sync() destination fifo mode = %v, %v, want %v", info.Mode().Type(), err, tt.wantMode)
+			}
+
+			// a recreated special file is up to date afterwards
+			if tt.policy == RecreateSpecial {
+				report, err := s.Sync()
+				if err != nil || report.UpToDate != 2 || report.SpecialFilesCreated != 0 {
+					t.Errorf("Sync() again report = %+v, error = %v", report, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_getEntryType_specialFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := syscall.Mkfifo(path.Join(dir, "fifo"), 0644); err != nil {
+		t.Fatalf("cannot create fifo for test: %v", err)
+	}
+	entries, err := ListEntries(dir)
+	if err != nil {
+		t.Fatalf("ListEntries() unexpected error: %v", err)
+	}
+	if entries["fifo"] != fifo {
+		t.Errorf("ListEntries() fifo type = %v, want %v", entries["fifo"], fifo)
+	}
+	if got := getEntryType(os.ModeDevice | os.ModeCharDevice); got != device {
+		t.Errorf("getEntryType() = %v, want %v", got, device)
+	}
+}
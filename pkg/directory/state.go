@@ -0,0 +1,111 @@
+package directory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"io/fs"
+	"path/filepath"
+)
+
+// DefaultStateFile is the name of the state database of a two-way synchronization in the destination folder.
+const DefaultStateFile = ".gosync-state.json"
+
+const stateVersion = 1
+
+// entryState describes an entry of a folder as seen by a two-way synchronization.
+type entryState struct {
+	Type    entryType `json:"type"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime int64     `json:"mtime,omitempty"`
+	Target  string    `json:"target,omitempty"`
+}
+
+// same returns true if both states describe the same entry. The content of the folders is not compared.
+func (e entryState) same(o entryState) bool {
+	if e.Type != o.Type {
+		return false
+	}
+	switch e.Type {
+	case file:
+		return e.Size == o.Size && e.ModTime == o.ModTime
+	case symlink:
+		return e.Target == o.Target
+	default:
+		return true
+	}
+}
+
+// tree maps the entries of a folder by slash separated path relative to the folder.
+type tree map[string]entryState
+
+// syncState is the state of both folders at the end of the last two-way synchronization.
+type syncState struct {
+	Version     int  `json:"version"`
+	Source      tree `json:"source"`
+	Destination tree `json:"destination"`
+}
+
+// loadState reads the state file name of fsys, the state is empty if the file doesn't exist yet.
+func loadState(fsys syncFile.FS, name string) (*syncState, error) {
+	st := &syncState{Version: stateVersion}
+	b, err := syncFile.ReadFile(fsys, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("cannot read state file %s: %w", name, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, st); err != nil {
+			return nil, fmt.Errorf("cannot parse state file %s: %w", name, err)
+		}
+		if st.Version != stateVersion {
+			return nil, fmt.Errorf("unsupported version %d of state file %s", st.Version, name)
+		}
+	}
+
+	if st.Source == nil {
+		st.Source = make(tree)
+	}
+	if st.Destination == nil {
+		st.Destination = make(tree)
+	}
+	return st, nil
+}
+
+// save writes the state in a temporary file renamed over the state file name of fsys, so a previous state is never lost.
+func (st *syncState) save(fsys syncFile.FS, name string) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("cannot encode state: %w", err)
+	}
+	return writeFileAtomic(fsys, name, b)
+}
+
+// writeFileAtomic writes b in a temporary file of fsys renamed over the file name, so its previous content is never lost.
+func writeFileAtomic(fsys syncFile.FS, name string, b []byte) (err error) {
+	temp, err := syncFile.CreateTemp(fsys, filepath.Dir(name), syncFile.TempFilePattern(filepath.Base(name)))
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file for %s: %w", name, err)
+	}
+	defer func() {
+		if err != nil {
+			fsys.Remove(temp.Name())
+		}
+	}()
+
+	_, err = temp.Write(b)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write file %s: %w", name, err)
+	}
+
+	if err = fsys.Rename(temp.Name(), name); err != nil {
+		return fmt.Errorf("cannot rename temporary file %s to %s: %w", temp.Name(), name, err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SymlinkPolicy decides how the symlinks of the source are synchronized.
+type SymlinkPolicy int
+
+const (
+	// PreserveLinks recreates the symlinks with the same target.
+	PreserveLinks = SymlinkPolicy(iota)
+	// FollowLinks synchronizes the entries the symlinks point to instead of the symlinks, the folders included.
+	// A symlink to a folder containing it is a loop that fails, a symlink whose target doesn't exist or cannot be read
+	// is skipped like with SkipLinks.
+	FollowLinks
+	// SkipLinks leaves the symlinks out of the synchronization with a warning in the report,
+	// the destination entries with the same names are kept.
+	SkipLinks
+	// RewriteLinks recreates the symlinks so they point to the same entries at the destination: an absolute target
+	// inside the source folder is made relative, and a relative target outside of it is made absolute.
+	RewriteLinks
+	// SafeLinks recreates the symlinks with a relative target inside the source folder and skips the other ones
+	// like SkipLinks, the absolute targets included.
+	SafeLinks
+)
+
+// ErrSymlinkLoop is the error of a followed symlink to a folder containing it.
+var ErrSymlinkLoop = errors.New("symlink loop")
+
+// ParseSymlinkPolicy parses the name of a policy: preserve, follow (or copy-target), skip, rewrite-relative or safe-links.
+func ParseSymlinkPolicy(name string) (SymlinkPolicy, error) {
+	if name == "copy-target" {
+		return FollowLinks, nil
+	}
+	for _, p := range []SymlinkPolicy{PreserveLinks, FollowLinks, SkipLinks, RewriteLinks, SafeLinks} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown symlink policy %q", name)
+}
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case PreserveLinks:
+		return "preserve"
+	case FollowLinks:
+		return "follow"
+	case SkipLinks:
+		return "skip"
+	case RewriteLinks:
+		return "rewrite-relative"
+	case SafeLinks:
+		return "safe-links"
+	default:
+		return fmt.Sprintf("unknown policy %d", int(p))
+	}
+}
+
+// planSymlink applies the symlink policy to the source symlink. It returns the type of the entry the symlink
+// is synchronized as, the target of the destination symlink when it is rewritten, and skip is true if the symlink is left out.
+// ancestors are the source folders containing the symlink, a followed symlink to one of them is a loop.
+func (s *synchronizer) planSymlink(source string, ancestors []os.FileInfo) (t entryType, target string, skip bool, err error) {
+	switch s.symlinks {
+	case FollowLinks:
+		info, err := s.sourceFS.Stat(source)
+		if err != nil {
+			// a broken symlink must not stop the synchronization of the other entries
+			return symlink, "", true, nil
+		}
+		if info.IsDir() {
+			for _, ancestor := range ancestors {
+				if syncFile.SameFile(info, ancestor) {
+					return symlink, "", false, fmt.Errorf("cannot follow symlink %s: %w", source, ErrSymlinkLoop)
+				}
+			}
+		}
+		return getEntryType(info.Mode().Type()), "", false, nil
+	case SkipLinks:
+		return symlink, "", true, nil
+	case SafeLinks:
+		target, err := s.sourceFS.Readlink(source)
+		if err != nil {
+			return symlink, "", false, fmt.Errorf("cannot read symlink %s: %w", source, err)
+		}
+		if filepath.IsAbs(target) {
+			return symlink, "", true, nil
+		}
+		inside, err := s.insideSource(source, target)
+		return symlink, "", !inside, err
+	case RewriteLinks:
+		original, err := s.sourceFS.Readlink(source)
+		if err != nil {
+			return symlink, "", false, fmt.Errorf("cannot read symlink %s: %w", source, err)
+		}
+		if target, err = s.rewriteTarget(source, original); err != nil || target == original {
+			return symlink, "", false, err
+		}
+		return symlink, target, false, nil
+	default:
+		return symlink, "", false, nil
+	}
+}
+
+// symlinkTarget returns the target of the destination symlink of the source symlink, rewritten by the RewriteLinks policy.
+func (s *synchronizer) symlinkTarget(source string) (string, error) {
+	target, err := s.sourceFS.Readlink(source)
+	if err != nil {
+		return "", fmt.Errorf("cannot read symlink %s: %w", source, err)
+	}
+	if s.symlinks != RewriteLinks {
+		return target, nil
+	}
+	return s.rewriteTarget(source, target)
+}
+
+// symlinkChanged returns true if the destination symlink doesn't point to the target of its source symlink.
+func (s *synchronizer) symlinkChanged(source, destination string) (bool, error) {
+	target, err := s.symlinkTarget(source)
+	if err != nil {
+		return false, err
+	}
+	destinationTarget, err := s.destinationFS.Readlink(destination)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot read symlink %s: %w", destination, err)
+	}
+	return target != destinationTarget, nil
+}
+
+// rewriteTarget returns the target of the source symlink that points to the same entry from the destination:
+// an absolute target inside the source folder is made relative, a relative target outside of it is made absolute.
+func (s *synchronizer) rewriteTarget(source, target string) (string, error) {
+	resolved, err := resolveTarget(source, target)
+	if err != nil {
+		return "", err
+	}
+	inside, err := s.insideSource(source, target)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case filepath.IsAbs(target) && inside:
+		dir, err := filepath.Abs(filepath.Dir(source))
+		if err != nil {
+			return "", err
+		}
+		return filepath.Rel(dir, resolved)
+	case !filepath.IsAbs(target) && !inside:
+		return resolved, nil
+	default:
+		return target, nil
+	}
+}
+
+// insideSource returns true if the target of the source symlink is inside the source folder.
+// The target is resolved lexically, the symlinks on its path are not followed.
+func (s *synchronizer) insideSource(source, target string) (bool, error) {
+	resolved, err := resolveTarget(source, target)
+	if err != nil {
+		return false, err
+	}
+	return isInsideDir(resolved, s.Source)
+}
+
+// resolveTarget returns the absolute path of the target of the symlink source.
+func resolveTarget(source, target string) (string, error) {
+	if filepath.IsAbs(target) {
+		return filepath.Clean(target), nil
+	}
+	return filepath.Abs(filepath.Join(filepath.Dir(source), target))
+}
@@ -0,0 +1,145 @@
+package directory
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_synchronizer_Sync_symlinks(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name   string
+		policy SymlinkPolicy
+		// want maps the destination entries to their symlink target, or to "" for a regular file and "dir" for a folder.
+		// The target "<source>" stands for the absolute path of the source folder.
+		want         map[string]string
+		wantWarnings int
+	}{
+		{"preserve", PreserveLinks, map[string]string{
+			"abs_in": "<source>/file_a", "rel_in": "file_a", "rel_out": "../outside", "dir_link": "dir",
+		}, 0},
+		{"follow", FollowLinks, map[string]string{
+			"abs_in": "", "rel_in": "", "rel_out": "", "dir_link": "dir", "dir_link/file_b": "",
+		}, 0},
+		{"skip", SkipLinks, map[string]string{}, 4},
+		{"rewrite relative", RewriteLinks, map[string]string{
+			"abs_in": "file_a", "rel_in": "file_a", "rel_out": "<outside>", "dir_link": "dir",
+		}, 0},
+		{"safe links", SafeLinks, map[string]string{
+			"rel_in": "file_a", "dir_link": "dir",
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			source, destination := path.Join(root, "source"), path.Join(root, "destination")
+			writeFile(t, source, "file_a", "a", now)
+			writeFile(t, source, "dir/file_b", "b", now)
+			writeFile(t, root, "outside", "outside", now)
+			links := map[string]string{"abs_in": path.Join(source, "file_a"), "rel_in": "file_a", "rel_out": "../outside", "dir_link": "dir"}
+			for name, target := range links {
+				if err := os.Symlink(target, path.Join(source, name)); err != nil {
+					t.Fatalf("cannot create symlink for test: %v", err)
+				}
+			}
+
+			s := NewSynchronizer(source, destination, Symlinks(tt.policy))
+			report, err := s.Sync()
+			if err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if len(report.Warnings) != tt.wantWarnings {
+				t.Errorf("Sync() warnings = %v, want %d", report.Warnings, tt.wantWarnings)
+			}
+			for name, want := range tt.want {
+				switch want {
+				case "<source>/file_a":
+					want = path.Join(source, "file_a")
+				case "<outside>":
+					want = filepath.Join(root, "outside")
+				}
+				info, err := os.Lstat(path.Join(destination, name))
+				switch {
+				case err != nil:
+					t.Errorf("Sync() destination %s: %v", name, err)
+				case want == "" && !info.Mode().IsRegular():
+					t.Errorf("Sync() destination %s mode = %v, want a file", name, info.Mode())
+				case want == "dir" && info.Mode()&os.ModeSymlink == 0 && !info.IsDir():
+					t.Errorf("Sync() destination %s mode = %v, want a folder", name, info.Mode())
+				case want != "" && want != "dir":
+					if target, _ := os.Readlink(path.Join(destination, name)); target != want {
+						t.Errorf("Sync() destination %s target = %q, want %q", name, target, want)
+					}
+				}
+			}
+			for name := range links {
+				if _, ok := tt.want[name]; !ok {
+					if _, err := os.Lstat(path.Join(destination, name)); !os.IsNotExist(err) {
+						t.Errorf("Sync() created the skipped symlink %s: %v", name, err)
+					}
+				}
+			}
+
+			// the symlinks are up to date afterwards
+			p, err := s.Plan()
+			if err != nil || len(p.Changes()) != tt.wantWarnings {
+				t.Errorf("Plan() again = %v, error = %v", p.Changes(), err)
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Plan_symlinkLoop(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFile(t, source, "dir/file_a", "a", time.Now())
+	if err := os.Symlink("..", path.Join(source, "dir", "parent")); err != nil {
+		t.Fatalf("cannot create symlink for test: %v", err)
+	}
+
+	p, err := NewSynchronizer(source, destination, Symlinks(FollowLinks), ContinueOnError(true)).Plan()
+	if !errors.Is(err, ErrSymlinkLoop) {
+		t.Fatalf("Plan() error = %v, want ErrSymlinkLoop", err)
+	}
+	if len(p) != 2 {
+		t.Errorf("Plan() = %v, want the folder and its file", p)
+	}
+}
+
+func Test_synchronizer_Sync_danglingSymlink(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	writeFile(t, source, "file_a", "a", time.Now())
+	if err := os.Symlink("missing", path.Join(source, "dangling")); err != nil {
+		t.Fatalf("cannot create symlink for test: %v", err)
+	}
+
+	report, err := NewSynchronizer(source, destination, Symlinks(FollowLinks)).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 1 || len(report.Warnings) != 1 {
+		t.Errorf("Sync() report = %v, want the file copied and the symlink skipped", report)
+	}
+	if _, err := os.Lstat(path.Join(destination, "dangling")); !os.IsNotExist(err) {
+		t.Errorf("Sync() created the dangling symlink: %v", err)
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	for _, p := range []SymlinkPolicy{PreserveLinks, FollowLinks, SkipLinks, RewriteLinks, SafeLinks} {
+		got, err := ParseSymlinkPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseSymlinkPolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if got, err := ParseSymlinkPolicy("copy-target"); err != nil || got != FollowLinks {
+		t.Errorf("ParseSymlinkPolicy(copy-target) = %v, %v, want %v", got, err, FollowLinks)
+	}
+	if _, err := ParseSymlinkPolicy("dereference"); err == nil {
+		t.Errorf("ParseSymlinkPolicy() expected an error for an unknown policy")
+	}
+}
@@ -1,45 +1,101 @@
 package directory
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	syncFile "gosync/pkg/file"
+	"gosync/pkg/filter"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
-type CopyError struct {
-	errors []string
+// CanceledError is returned when the synchronization is stopped by the cancellation of its context.
+type CanceledError struct {
+	Err error
 }
 
-func (e *CopyError) Error() string {
-	return strings.Join(e.errors, "\n")
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("synchronization canceled: %v", e.Err)
 }
 
-// fileSync is a pair of file paths or symlink paths to synchronize.
-type fileSync struct {
-	source, destination string
-	fileType            entryType
+func (e *CanceledError) Unwrap() error {
+	return e.Err
 }
 
 // Synchronizer is a directory synchronizer between a source and a destination folder.
 type Synchronizer interface {
-	//Sync launches the syncing operation between the two folders.
-	Sync() error
+	//Sync launches the syncing operation between the two folders and reports the work done.
+	//The report is returned even when the synchronization fails.
+	Sync() (*Report, error)
+	//SyncContext launches the syncing operation between the two folders, it stops when ctx is done
+	//and returns a *CanceledError once the copies in progress are aborted or finished.
+	SyncContext(ctx context.Context) (*Report, error)
+	//Plan computes the actions needed to synchronize the two folders without modifying the destination.
+	//When the synchronizer continues on errors, the plan of the readable entries is returned with a *CopyError.
+	Plan() (Plan, error)
+	//Apply executes the actions of a plan on the destination folder and reports the work done.
+	Apply(p Plan) (*Report, error)
+	//ApplyContext executes the actions of a plan on the destination folder, it stops when ctx is done
+	//and returns a *CanceledError once the copies in progress are aborted or finished.
+	ApplyContext(ctx context.Context, p Plan) (*Report, error)
 }
 
 type synchronizer struct {
 	Source, Destination string
-	copyC               chan fileSync
 	maxGoroutine        int
 	copyBufferSize      int
 	fileCopier          syncFile.Copier
 	entryLister         dirEntryLister
+	changeDetector      syncFile.ChangeDetector
+	preserve            syncFile.Attributes
+	atomic              bool
+	sparse              bool
+	filter              *filter.Filter
+	deleteExcluded      bool
+	continueOnError     bool
+	maxErrors           int
+	watchDebounce       time.Duration
+	conflictPolicy      ConflictPolicy
+	backupDir           string
+	keepBackups         int
+	backupMaxAge        time.Duration
+	delta               bool
+	verify              syncFile.HashAlgorithm
+	noDelete            bool
+	maxDelete           int
+	maxDeletePercent    float64
+	indexFile           string
+	rescan              bool
+	journalFile         string
+	hardLinks           bool
+	symlinks            SymlinkPolicy
+	// specialFiles are the policies of the special files by SpecialFileType.
+	specialFiles [3]SpecialFilePolicy
+	// sourceFS and destinationFS are the file systems of the folders, the local disk by default.
+	sourceFS      syncFile.FS
+	destinationFS syncFile.FS
+	// detectMoves is true when the new files of the source are moved from the deleted destination files they match.
+	detectMoves bool
+	// fastCopy is true when the files are copied by a syncFile.FastCopy with copyMethod.
+	fastCopy   bool
+	copyMethod syncFile.CopyMethod
+	// resumable is true when the files are copied by a syncFile.ResumableCopy recording its progress in the journal.
+	resumable bool
+	// twoWay is true for the synchronizer of a TwoWaySynchronizer, whose source entries are modified too.
+	twoWay bool
 }
 
 // NewSynchronizer initializes a directory synchronizer.
 func NewSynchronizer(source, destination string, opts ...SynchronizerOption) Synchronizer {
+	return newSynchronizer(source, destination, opts...)
+}
+
+func newSynchronizer(source, destination string, opts ...SynchronizerOption) *synchronizer {
 	s := defaultSynchronizer
 	if opts != nil {
 		for _, opt := range opts {
@@ -48,131 +104,678 @@ func NewSynchronizer(source, destination string, opts ...SynchronizerOption) Syn
 	}
 	s.Source = source
 	s.Destination = destination
-	s.copyC = make(chan fileSync, s.copyBufferSize)
+	if s.sourceFS == nil {
+		s.sourceFS = syncFile.OSFS{}
+	}
+	if s.destinationFS == nil {
+		s.destinationFS = syncFile.OSFS{}
+	}
+	if s.entryLister == nil {
+		s.entryLister = &basicDirEntryLister{fs: s.destinationFS}
+	}
+	// the destination files never get the modification time of their source
+	if _, ok := s.changeDetector.(*syncFile.QuickCheck); ok && !s.preserve.Has(syncFile.Times) {
+		s.changeDetector = &syncFile.QuickCheck{SizeOnly: true}
+	}
+	s.resumable = s.journalFile != "" && s.fileCopier == nil && !s.delta
+	if s.fileCopier == nil && s.delta {
+		s.fileCopier = &syncFile.DeltaCopy{BasicCopy: s.basicCopy()}
+	}
+	if s.fileCopier == nil && s.fastCopy {
+		s.fileCopier = &syncFile.FastCopy{BasicCopy: s.basicCopy(), Method: s.copyMethod}
+	}
+	if s.fileCopier == nil {
+		c := s.basicCopy()
+		s.fileCopier = &c
+	}
 
 	return &s
 }
 
-func (s *synchronizer) Sync() error {
-	if err := IsValid(s.Source); err != nil {
+func (s *synchronizer) Sync() (*Report, error) {
+	return s.SyncContext(context.Background())
+}
+
+func (s *synchronizer) SyncContext(ctx context.Context) (*Report, error) {
+	start := time.Now()
+	r := s.newRun(ctx)
+	defer r.cancel()
+
+	if err := s.validate(); err != nil {
+		return r.report, err
+	}
+	if err := s.openIndex(r); err != nil {
+		return r.report, err
+	}
+	if err := s.openJournal(r); err != nil {
+		return r.report, err
+	}
+
+	p, err := s.planFolder(r)
+	if err == nil {
+		err = s.checkDeletions(r, p)
+	}
+	if err == nil {
+		err = s.apply(r, p)
+	}
+	r.report.Elapsed = time.Since(start)
+	return r.report, r.result(err)
+}
+
+func (s *synchronizer) Plan() (Plan, error) {
+	r := s.newRun(context.Background())
+	defer r.cancel()
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.openIndex(r); err != nil {
+		return nil, err
+	}
+	if err := s.openJournal(r); err != nil {
+		return nil, err
+	}
+
+	p, err := s.planFolder(r)
+	err = r.result(err)
+	var cpErr *CopyError
+	if err != nil && !errors.As(err, &cpErr) {
+		return nil, err
+	}
+	return p, err
+}
+
+// validate returns an *InputError if the source and the destination folders cannot be synchronized.
+func (s *synchronizer) validate() error {
+	if err := isValidFS(s.sourceFS, s.Source); err != nil {
+		return err
+	}
+	if err := s.validateFS(); err != nil {
 		return err
 	}
 
-	if s.Source == s.Destination {
+	if s.Source == s.Destination && sameFS(s.sourceFS, s.destinationFS) {
 		return &InputError{msg: "error: Source and Destination are the same directory"}
 	}
+	if s.backupDir != "" {
+		for _, dir := range []string{s.Source, s.Destination} {
+			if inside, err := isInsideDir(s.backupDir, dir); err != nil || inside {
+				return &InputError{msg: fmt.Sprintf("the backup directory %s cannot be inside %s", s.backupDir, dir)}
+			}
+		}
+	}
+	if s.journalFile != "" {
+		for _, dir := range []string{s.Source, s.Destination} {
+			if inside, err := isInsideDir(s.journalFile, dir); err != nil || inside {
+				return &InputError{msg: fmt.Sprintf("the journal file %s cannot be inside %s", s.journalFile, dir)}
+			}
+		}
+	}
+	if s.indexFile != "" {
+		if inside, err := isInsideDir(s.indexFile, s.Source); err != nil || inside {
+			return &InputError{msg: fmt.Sprintf("the index file %s cannot be inside %s", s.indexFile, s.Source)}
+		}
+	}
+	return nil
+}
 
-	doneC, errorC := s.copyListener(s.maxGoroutine)
+func (s *synchronizer) Apply(p Plan) (*Report, error) {
+	return s.ApplyContext(context.Background(), p)
+}
 
-	errs := make([]string, 0)
+func (s *synchronizer) ApplyContext(ctx context.Context, p Plan) (*Report, error) {
+	start := time.Now()
+	r := s.newRun(ctx)
+	defer r.cancel()
+
+	err := s.openIndex(r)
+	if err == nil {
+		err = s.openJournal(r)
+	}
+	if err == nil {
+		err = s.checkDeletions(r, p)
+	}
+	if err == nil {
+		err = s.apply(r, p)
+	}
+	r.report.Elapsed = time.Since(start)
+	return r.report, r.result(err)
+}
+
+// apply executes the actions of the plan and returns the error that stopped it early, if any.
+// The failures the synchronization continues past are recorded in the run.
+// The index of the run, if any, is saved once all the actions succeeded, unless the run is a batch.
+func (s *synchronizer) apply(r *run, p Plan) error {
+	if r.index != nil && !r.batch {
+		if err := s.invalidateIndex(); err != nil {
+			return err
+		}
+	}
+	if dc, ok := s.fileCopier.(*syncFile.DeltaCopy); ok {
+		before := dc.Stats()
+		defer func() {
+			r.report.recordDelta(dc.Stats(), before)
+		}()
+	}
+	if rc, ok := r.copier.(*syncFile.ResumableCopy); ok {
+		before := rc.ResumedBytes()
+		defer func() {
+			r.report.recordResumed(rc.ResumedBytes() - before)
+		}()
+	}
+
+	copyC := make(chan Action, s.copyBufferSize)
+	resultC := s.copyListener(r, copyC, s.maxGoroutine)
+
+	doneC := make(chan struct{})
 	go func() {
-		for err := range errorC {
-			errs = append(errs, err.Error())
+		for res := range resultC {
+			switch {
+			case res.err == nil:
+				r.report.record(res.action, res.size)
+				s.indexAction(r, res.action, res.hash)
+			case !r.aborted(res.err):
+				r.fail(newEntryError(res.action, res.err))
+			}
 		}
+		close(doneC)
 	}()
 
-	err := s.synchronizeFolder()
-	if err != nil {
-		return fmt.Errorf("cannot perform the synchronization: %w", err)
+	var abortErr error
+	createdDirs := make([]Action, 0)
+	// links are applied once the files they link to are copied
+	links := make([]Action, 0)
+	// failedDirs are the destination entries whose failure is recorded, the actions inside them are skipped
+	failedDirs := make([]string, 0)
+	for _, a := range p {
+		if r.ctx.Err() != nil {
+			break
+		}
+		if isInside(a.Destination, failedDirs) {
+			continue
+		}
+		if a.Type == LinkFile {
+			links = append(links, a)
+			continue
+		}
+		if err := s.applyAction(r, a, copyC); err != nil {
+			if r.aborted(err) {
+				break
+			}
+			if !s.continueOnError {
+				abortErr = fmt.Errorf("cannot perform the synchronization: %w", err)
+				break
+			}
+			failedDirs = append(failedDirs, a.Destination)
+			continue
+		}
+		if a.Type == CreateDir {
+			createdDirs = append(createdDirs, a)
+		}
 	}
-	close(s.copyC)
+	close(copyC)
 	<-doneC
+	s.applyLinks(r, links)
 
-	if len(errs) > 0 {
-		return &CopyError{errors: errs}
+	if abortErr == nil && r.ctx.Err() == nil {
+		abortErr = s.preserveDirAttributes(r, createdDirs)
 	}
+	if abortErr == nil && r.ctx.Err() == nil && s.backupDir != "" {
+		if err := s.pruneBackups(r); err != nil {
+			r.fail(newEntryError(Action{Type: DeleteEntry, Destination: s.backupDir}, err))
+		}
+	}
+	if abortErr == nil && r.index != nil && !r.batch {
+		_, abortErr = s.saveIndex(r)
+	}
+	if r.journal != nil {
+		r.mu.Lock()
+		completed := abortErr == nil && r.ctx.Err() == nil && len(r.errs) == 0
+		r.mu.Unlock()
+		if err := r.journal.finish(completed); err != nil && abortErr == nil {
+			abortErr = err
+		}
+	}
+	return abortErr
+}
+
+// isInside returns true if entry is one of the dirs or inside one of them.
+func isInside(entry string, dirs []string) bool {
+	for _, dir := range dirs {
+		if entry == dir || strings.HasPrefix(entry, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAction executes an action, copies are sent to the copyC channel and performed asynchronously.
+// The outcome of the other actions is recorded in the run.
+func (s *synchronizer) applyAction(r *run, a Action, copyC chan<- Action) error {
+	var err error
+	switch a.Type {
+	case CopyFile, CopySymlink:
+		select {
+		case copyC <- a:
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		}
+		return nil
+	case CreateDir:
+		err = s.destinationFS.MkdirAll(a.Destination, os.ModePerm)
+	case ReplaceType, DeleteEntry:
+		// the temporary files of interrupted copies are not worth a backup
+		if s.backupDir != "" && !syncFile.IsTempFile(path.Base(a.Destination)) {
+			err = s.backup(r, a.Destination)
+		} else {
+			err = s.destinationFS.RemoveAll(a.Destination)
+		}
+	case MoveEntry:
+		err = s.destinationFS.Rename(a.Source, a.Destination)
+	case CreateSpecial:
+		if s.backupDir != "" {
+			err = s.backupCopy(r, a.Destination)
+		}
+		if err == nil {
+			err = syncFile.CreateSpecialFS(s.sourceFS, a.Source, s.destinationFS, a.Destination, s.preserve)
+		}
+	case SkipEntry:
+		r.report.recordWarning(fmt.Sprintf("%s %s skipped", entryKind(s.sourceFS, a.Source), a.Source))
+	case UpToDate:
+	default:
+		return fmt.Errorf("cannot apply %s", a)
+	}
+
+	if err != nil {
+		entryErr := newEntryError(a, err)
+		r.fail(entryErr)
+		return entryErr
+	}
+	r.report.record(a, 0)
+	s.indexAction(r, a, "")
 	return nil
 }
 
-func (s *synchronizer) copyListener(maxGoroutine int) (<-chan interface{}, <-chan error) {
-	doneC := make(chan interface{})
-	errorC := make(chan error)
+// preserveDirAttributes applies the attributes of the source directories to the created directories.
+// It runs once the content is copied, deepest directories first, so the modification times
+// are not updated afterwards and read-only directories can still be filled.
+func (s *synchronizer) preserveDirAttributes(r *run, createdDirs []Action) error {
+	for i := len(createdDirs) - 1; i >= 0; i-- {
+		a := createdDirs[i]
+		dirStat, err := s.sourceFS.Stat(a.Source)
+		if err == nil {
+			err = s.copyMetadata(a.Source, a.Destination, dirStat)
+		}
+		if err != nil {
+			entryErr := newEntryError(a, err)
+			r.fail(entryErr)
+			if !s.continueOnError {
+				return fmt.Errorf("cannot perform the synchronization: %w", entryErr)
+			}
+		}
+	}
+	return nil
+}
+
+// copyResult is the outcome of a copy, size is the number of bytes copied.
+type copyResult struct {
+	action Action
+	size   int64
+	// hash is the hash of the copied file recorded in the index, see indexHash.
+	hash string
+	err  error
+}
+
+// copyListener copies the files and symlinks received on copyC with at most maxGoroutine concurrent copies.
+// The returned result channel is closed once copyC is closed and all the copies are done.
+// The copies in progress are aborted when the run is done if the fileCopier is a syncFile.ContextCopier.
+func (s *synchronizer) copyListener(r *run, copyC <-chan Action, maxGoroutine int) <-chan copyResult {
+	resultC := make(chan copyResult)
 	go func() {
 		wg := sync.WaitGroup{}
 		semaphore := make(chan struct{}, maxGoroutine)
 
-		for f := range s.copyC {
+		for a := range copyC {
 			wg.Add(1)
 			semaphore <- struct{}{}
-			go func(fi fileSync) {
+			go func(a Action) {
 				defer func() {
 					wg.Done()
 					<-semaphore
 				}()
-				err := s.fileCopier.Copy(fi.source, fi.destination, fi.fileType == symlink)
-				if err != nil {
-					errorC <- err
+				res := copyResult{action: a}
+				if res.size, res.err = s.copy(r, a); res.err == nil {
+					res.hash = s.indexHash(r, a)
 				}
-			}(f)
+				resultC <- res
+			}(a)
 
 		}
 
 		wg.Wait()
-		doneC <- struct{}{}
-		close(doneC)
+		close(resultC)
 	}()
 
-	return doneC, errorC
+	return resultC
 }
 
-func (s *synchronizer) synchronizeFolder() error {
+// copy copies a file or a symlink with the copier of the run, through its context aware method if it has one,
+// and returns the size of the copied file. The overwritten destination is backed up first if a backup directory is set,
+// and the copied file is verified afterwards if a hash algorithm is set. The copy is recorded in the journal if any.
+func (s *synchronizer) copy(r *run, a Action) (int64, error) {
+	symlink := a.Type == CopySymlink
+	if s.backupDir != "" {
+		if err := s.backupCopy(r, a.Destination); err != nil {
+			return 0, err
+		}
+	}
+	if r.journal != nil {
+		if err := r.journal.begin(a); err != nil {
+			return 0, err
+		}
+	}
+
+	var err error
+	cc, isContextCopier := r.copier.(syncFile.ContextCopier)
+	switch {
+	case symlink && a.Link != "":
+		// the target of the symlink is rewritten
+		err = syncFile.SymlinkFS(s.sourceFS, a.Source, a.Link, s.destinationFS, a.Destination, s.preserve)
+	case isContextCopier:
+		err = cc.CopyContext(r.ctx, a.Source, a.Destination, symlink)
+	default:
+		err = r.copier.Copy(a.Source, a.Destination, symlink)
+	}
+	if err == nil && s.verify != "" && !symlink {
+		if err = syncFile.VerifyFS(s.sourceFS, a.Source, s.destinationFS, a.Destination, s.verify); err == nil {
+			r.report.recordVerified()
+		}
+	}
+	if err == nil && r.journal != nil {
+		err = r.journal.complete(a)
+	}
+	if err != nil || symlink {
+		return 0, err
+	}
+
+	if info, err := s.destinationFS.Lstat(a.Destination); err == nil {
+		if allocated, ok := syncFile.AllocatedSize(info); ok {
+			r.report.recordAllocated(allocated)
+		}
+	}
+	// the source of a copied file may be a followed symlink
+	info, err := s.sourceFS.Stat(a.Source)
+	if err != nil {
+		return 0, nil
+	}
+	return info.Size(), nil
+}
+
+// planFolder computes the actions of the synchronization and returns the error that stopped it early, if any.
+// The failures the planning continues past are recorded in the run.
+func (s *synchronizer) planFolder(r *run) (Plan, error) {
+	return s.planTree(r, "", true)
+}
+
+// planTree computes the actions synchronizing the folder rel, a slash separated path relative to the source and destination folders.
+// The sub folders that already exist at the destination are only planned if recursive is true.
+func (s *synchronizer) planTree(r *run, rel string, recursive bool) (Plan, error) {
 
 	type syncFolders struct {
 		source, destination string
+		scope               *filter.Scope
+		// ancestors are the source folders containing the folder when the symlinks are followed
+		ancestors []os.FileInfo
+	}
+
+	p := make(Plan, 0)
+	// fail records the failure of the planning of an entry and returns it if the planning must stop
+	fail := func(source, destination string, err error) error {
+		entryErr := newEntryError(Action{Type: Scan, Source: source, Destination: destination}, err)
+		r.fail(entryErr)
+		if s.continueOnError {
+			return nil
+		}
+		return fmt.Errorf("cannot plan the synchronization: %w", entryErr)
+	}
+
+	source := path.Join(s.Source, rel)
+	destination := path.Join(s.Destination, rel)
+	scope, excluded, err := s.scopeOf(rel)
+	if err != nil {
+		return p, fail(source, destination, fmt.Errorf("cannot load filter rules: %w", err))
+	}
+	if excluded {
+		return p, nil
 	}
 
+	links := make(linkGroups)
 	folderQueue := make([]syncFolders, 1)
-	folderQueue[0] = syncFolders{source: s.Source, destination: s.Destination}
+	folderQueue[0] = syncFolders{source: source, destination: destination, scope: scope}
 
 	for len(folderQueue) > 0 {
+		if err := r.ctx.Err(); err != nil {
+			return p, err
+		}
 		folders := folderQueue[0]
 		folderQueue = folderQueue[1:]
 
-		existingEntries, err := s.entryLister.listEntries(folders.destination)
+		existingEntries, err := s.listDestination(r, folders.destination)
 		if err != nil {
-			return fmt.Errorf("cannot load entries from %s: %w", folders.destination, err)
+			if err = fail(folders.source, folders.destination, err); err != nil {
+				return p, err
+			}
+			continue
 		}
 
-		entries, err := os.ReadDir(folders.source)
+		entries, err := s.sourceFS.ReadDir(folders.source)
 		if err != nil {
-			return fmt.Errorf("cannot read directory %s: %w", folders.source, err)
+			if err = fail(folders.source, folders.destination, err); err != nil {
+				return p, err
+			}
+			continue
+		}
+
+		// a followed symlink to a folder containing it would be planned endlessly
+		var ancestors []os.FileInfo
+		if s.symlinks == FollowLinks {
+			if info, err := s.sourceFS.Stat(folders.source); err == nil {
+				ancestors = append(folders.ancestors[:len(folders.ancestors):len(folders.ancestors)], info)
+			}
 		}
+
+		// temporary files are left at the destination by interrupted atomic copies
+		for _, name := range sortedNames(existingEntries) {
+			if syncFile.IsTempFile(name) && existingEntries[name] == file {
+				// except the partial files of the copies the journal resumes
+				if temp := path.Join(folders.destination, name); r.journal == nil || !r.journal.keeps(temp) {
+					p = append(p, Action{Type: DeleteEntry, Destination: temp})
+				}
+				delete(existingEntries, name)
+			}
+		}
+
 		for _, entry := range entries {
-			destEntryType, exists := existingEntries[entry.Name()]
 			sourceEntryType := getEntryType(entry.Type())
+			if folders.scope.Excluded(entry.Name(), sourceEntryType == folder) {
+				continue
+			}
+			destEntryType, exists := existingEntries[entry.Name()]
 
 			source := path.Join(folders.source, entry.Name())
 			destination := path.Join(folders.destination, entry.Name())
 
-			if !exists {
-				if sourceEntryType == file || sourceEntryType == symlink {
-					s.copyC <- fileSync{source: source, destination: destination, fileType: sourceEntryType}
-				}
-			} else {
-				if destEntryType != sourceEntryType {
-					err = os.RemoveAll(destination)
-					if err != nil {
-						return fmt.Errorf("cannot delete entry %s: %w", entry.Name(), err)
+			// target is the target of the destination symlink when the symlink policy rewrites it
+			var target string
+			skip := false
+			if sourceEntryType == symlink {
+				if sourceEntryType, target, skip, err = s.planSymlink(source, ancestors); err != nil {
+					delete(existingEntries, entry.Name())
+					if err = fail(source, destination, err); err != nil {
+						return p, err
 					}
+					continue
+				}
+			}
+			if t, ok := specialFileType(sourceEntryType); ok && s.specialFiles[t] == FailSpecial {
+				delete(existingEntries, entry.Name())
+				if err := fail(source, destination, fmt.Errorf("%s is a %s: %w", source, t, syncFile.ErrSpecialFile)); err != nil {
+					return p, err
+				}
+				continue
+			} else if ok && s.specialFiles[t] == SkipSpecial {
+				skip = true
+			}
+			// the skipped entries keep their destination entry, like the excluded entries
+			if skip {
+				delete(existingEntries, entry.Name())
+				p = append(p, Action{Type: SkipEntry, Source: source, Destination: destination})
+				continue
+			}
 
-					if sourceEntryType == file || sourceEntryType == symlink {
-						s.copyC <- fileSync{source: source, destination: destination, fileType: sourceEntryType}
+			id, linked := s.sourceLinkID(entry)
+			if g, ok := links[id]; linked && ok {
+				delete(existingEntries, entry.Name())
+				p = append(p, g.actions(s.destinationFS, source, destination, exists, destEntryType)...)
+				continue
+			}
+
+			if exists {
+				delete(existingEntries, entry.Name())
+				if destEntryType == sourceEntryType {
+					if sourceEntryType != folder {
+						changed, err := s.changed(r, source, destination, sourceEntryType)
+						if err != nil {
+							if err = fail(source, destination, err); err != nil {
+								return p, err
+							}
+							continue
+						}
+						if changed {
+							p = append(p, Action{Type: copyActionType(sourceEntryType), Source: source, Destination: destination, Link: target})
+						} else {
+							p = append(p, Action{Type: UpToDate, Source: source, Destination: destination})
+						}
 					}
+				} else if s.noDelete && destEntryType == folder && s.nonEmptyDestination(r, destination) {
+					// the content of the destination folder is kept, the source entry is left out
+					p = append(p, Action{Type: SkipEntry, Source: source, Destination: destination})
+					continue
+				} else {
+					p = append(p, Action{Type: ReplaceType, Source: source, Destination: destination})
+					exists = false
 				}
-				delete(existingEntries, entry.Name())
 			}
 
-			if sourceEntryType == folder {
-				folderQueue = append(folderQueue, syncFolders{source: source, destination: destination})
+			if !exists {
+				p = append(p, Action{Type: copyActionType(sourceEntryType), Source: source, Destination: destination, Link: target})
+			}
+			if linked {
+				links[id] = &linkGroup{destination: destination, copied: p[len(p)-1].Type == CopyFile}
+			}
+
+			if sourceEntryType == folder && (recursive || !exists) {
+				scope, err := folders.scope.Child(entry.Name(), source)
+				if err != nil {
+					if err = fail(source, destination, fmt.Errorf("cannot load filter rules: %w", err)); err != nil {
+						return p, err
+					}
+					continue
+				}
+				folderQueue = append(folderQueue, syncFolders{source: source, destination: destination, scope: scope, ancestors: ancestors})
 			}
 		}
-		for name := range existingEntries {
-			err = os.RemoveAll(path.Join(folders.destination, name))
-			if err != nil {
-				return fmt.Errorf("cannot delete entry %s: %w", name, err)
+		for _, name := range sortedNames(existingEntries) {
+			// excluded entries of the destination are protected
+			if s.noDelete || (!s.deleteExcluded && folders.scope.Excluded(name, existingEntries[name] == folder)) {
+				continue
 			}
+			p = append(p, Action{Type: DeleteEntry, Destination: path.Join(folders.destination, name)})
 		}
 	}
 
-	return nil
+	if s.detectMoves {
+		p = s.planMoves(r, p)
+	}
+	return p, nil
+}
+
+// scopeOf returns the filter scope of the folder rel, excluded is true if the folder or one of its parents is excluded.
+func (s *synchronizer) scopeOf(rel string) (scope *filter.Scope, excluded bool, err error) {
+	scope, err = s.filter.RootFS(s.Source, openFunc(s.sourceFS))
+	if err != nil || rel == "" {
+		return scope, false, err
+	}
+
+	dir := s.Source
+	for _, name := range strings.Split(rel, "/") {
+		if scope.Excluded(name, true) {
+			return nil, true, nil
+		}
+		dir = path.Join(dir, name)
+		if scope, err = scope.Child(name, dir); err != nil {
+			return nil, false, err
+		}
+	}
+	return scope, false, nil
+}
+
+// sortedNames returns the names of the entries in alphabetical order.
+func sortedNames(entries map[string]entryType) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// copyActionType returns the action that creates an entry of type t at the destination.
+func copyActionType(t entryType) ActionType {
+	switch t {
+	case folder:
+		return CreateDir
+	case symlink:
+		return CopySymlink
+	case fifo, socket, device:
+		return CreateSpecial
+	default:
+		return CopyFile
+	}
+}
+
+// changed returns true if the destination file, symlink or special file is out of date with its source,
+// the preserved extended attributes that differ make it out of date too.
+func (s *synchronizer) changed(r *run, source, destination string, fileType entryType) (bool, error) {
+	changed, err := s.contentChanged(r, source, destination, fileType)
+	if err != nil || changed || s.preserve&syncFile.ExtendedAttributes == 0 {
+		return changed, err
+	}
+	return syncFile.XattrsChangedFS(s.sourceFS, source, s.destinationFS, destination, s.preserve)
+}
+
+// contentChanged returns true if the destination entry differs from the source by its content or its stats.
+// The journal of an interrupted synchronization decides first, then the destination entry is described
+// by the index of the run if it has one.
+func (s *synchronizer) contentChanged(r *run, source, destination string, fileType entryType) (bool, error) {
+	if _, ok := specialFileType(fileType); ok {
+		return syncFile.SpecialChangedFS(s.sourceFS, source, s.destinationFS, destination)
+	}
+	if r.journal != nil {
+		if changed, ok := r.journal.changed(source, destination); ok {
+			return changed, nil
+		}
+	}
+	if rel, ok := s.indexRel(r, destination); ok {
+		if e, ok := r.index.get(rel); ok && e.Type == fileType {
+			return s.indexChanged(r, rel, source, destination, e)
+		}
+	}
+	if fileType == symlink {
+		return s.symlinkChanged(source, destination)
+	}
+	if cd, ok := s.changeDetector.(syncFile.FSChangeDetector); ok {
+		return cd.ChangedFS(s.sourceFS, source, s.destinationFS, destination)
+	}
+	return s.changeDetector.Changed(source, destination)
 }
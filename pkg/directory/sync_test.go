@@ -1,18 +1,32 @@
 package directory
 
 import (
+	"context"
+	"errors"
+	syncFile "gosync/pkg/file"
+	"gosync/pkg/filter"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type fakeCopier struct {
 	fileCopied int
+	err        error
 	mu         sync.Mutex
 }
 
 func (c *fakeCopier) Copy(source, destination string, symlink bool) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
 	c.fileCopied++
 	return nil
 }
@@ -20,8 +34,8 @@ func (c *fakeCopier) Copy(source, destination string, symlink bool) error {
 func Test_synchronizer_Sync(t *testing.T) {
 
 	type fields struct {
-		Source      string
-		Destination string
+		// Source is the destination folder if it is empty
+		Source string
 	}
 	tests := []struct {
 		name           string
@@ -29,15 +43,20 @@ func Test_synchronizer_Sync(t *testing.T) {
 		wantFileCopied int
 		wantErr        bool
 	}{
-		{"same directory", fields{"a", "a"}, 0, true},
-		{"folder_a", fields{"../../tests/source_folder_a", "a"}, 3, false},
-		{"folder_a", fields{"../../tests/source_folder_c", "a"}, 4, false},
+		{"same directory", fields{""}, 0, true},
+		{"folder_a", fields{"../../tests/source_folder_a"}, 3, false},
+		{"folder_c", fields{"../../tests/source_folder_c"}, 4, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			destination := t.TempDir()
+			source := tt.fields.Source
+			if source == "" {
+				source = destination
+			}
 			fc := &fakeCopier{mu: sync.Mutex{}}
-			s := NewSynchronizer(tt.fields.Source, tt.fields.Destination, fileCopier(fc))
-			if err := s.Sync(); (err != nil) != tt.wantErr {
+			s := NewSynchronizer(source, destination, fileCopier(fc))
+			if _, err := s.Sync(); (err != nil) != tt.wantErr {
 				t.Errorf("Sync() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			if tt.wantFileCopied != fc.fileCopied {
@@ -47,6 +66,14 @@ func Test_synchronizer_Sync(t *testing.T) {
 	}
 }
 
+type fakeChangeDetector struct {
+	changed bool
+}
+
+func (d *fakeChangeDetector) Changed(source, destination string) (bool, error) {
+	return d.changed, nil
+}
+
 type fakeEntryLister struct {
 	result map[string]entryType
 }
@@ -63,6 +90,7 @@ func Test_synchronizer_Sync_withExistingFiles(t *testing.T) {
 		Source      string
 		Destination string
 		files       map[string]entryType
+		changed     bool
 	}
 	tests := []struct {
 		name           string
@@ -70,20 +98,354 @@ func Test_synchronizer_Sync_withExistingFiles(t *testing.T) {
 		wantFileCopied int
 		wantErr        bool
 	}{
-		{"one file already on dest", fields{"../../tests/source_folder_a", "a", map[string]entryType{"file_a": file}}, 2, false},
-		{"all files already on dest", fields{"../../tests/source_folder_a", "a", map[string]entryType{"file_a": file, "file_b": file, "file_c": file}}, 0, false},
+		{"one file already on dest", fields{"../../tests/source_folder_a", "a", map[string]entryType{"file_a": file}, false}, 2, false},
+		{"all files already on dest", fields{"../../tests/source_folder_a", "a", map[string]entryType{"file_a": file, "file_b": file, "file_c": file}, false}, 0, false},
+		{"one changed file already on dest", fields{"../../tests/source_folder_a", "a", map[string]entryType{"file_a": file}, true}, 3, false},
+		{"all changed files already on dest", fields{"../../tests/source_folder_a", "a", map[string]entryType{"file_a": file, "file_b": file, "file_c": file}, true}, 3, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			el.result = tt.fields.files
 			fc := &fakeCopier{mu: sync.Mutex{}}
-			s2 := NewSynchronizer(tt.fields.Source, tt.fields.Destination, fileCopier(fc), entryLister(el))
-			if err := s2.Sync(); (err != nil) != tt.wantErr {
+			cd := &fakeChangeDetector{changed: tt.fields.changed}
+			s2 := NewSynchronizer(tt.fields.Source, tt.fields.Destination, fileCopier(fc), entryLister(el), ChangeDetection(cd))
+			report, err := s2.Sync()
+			if (err != nil) != tt.wantErr {
 				t.Errorf("Sync() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			if tt.wantFileCopied != fc.fileCopied {
 				t.Errorf("Sync() file copied = %v, want %v", fc.fileCopied, tt.wantFileCopied)
 			}
+			if report.FilesCopied != fc.fileCopied || report.UpToDate != 3-fc.fileCopied {
+				t.Errorf("Sync() report = %+v, want %v files copied and %v up to date", report, fc.fileCopied, 3-fc.fileCopied)
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Plan(t *testing.T) {
+	el := &fakeEntryLister{}
+
+	tests := []struct {
+		name    string
+		source  string
+		files   map[string]entryType
+		changed bool
+		want    Plan
+	}{
+		{"empty destination", "../../tests/source_folder_a", map[string]entryType{}, false, Plan{
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_a", Destination: "a/file_a"},
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_b", Destination: "a/file_b"},
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_c", Destination: "a/file_c"},
+		}},
+		{"extraneous and changed entries", "../../tests/source_folder_a", map[string]entryType{"file_a": file, "file_b": folder, "file_z": file, "dir_z": folder}, true, Plan{
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_a", Destination: "a/file_a"},
+			{Type: ReplaceType, Source: "../../tests/source_folder_a/file_b", Destination: "a/file_b"},
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_b", Destination: "a/file_b"},
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_c", Destination: "a/file_c"},
+			{Type: DeleteEntry, Destination: "a/dir_z"},
+			{Type: DeleteEntry, Destination: "a/file_z"},
+		}},
+		{"orphaned temporary file", "../../tests/source_folder_a", map[string]entryType{"file_a": file, "file_b": file, "file_c": file, ".gosync-file_a-42.tmp": file}, false, Plan{
+			{Type: DeleteEntry, Destination: "a/.gosync-file_a-42.tmp"},
+			{Type: UpToDate, Source: "../../tests/source_folder_a/file_a", Destination: "a/file_a"},
+			{Type: UpToDate, Source: "../../tests/source_folder_a/file_b", Destination: "a/file_b"},
+			{Type: UpToDate, Source: "../../tests/source_folder_a/file_c", Destination: "a/file_c"},
+		}},
+		{"sub folder", "../../tests/source_folder_c", map[string]entryType{}, false, Plan{
+			{Type: CreateDir, Source: "../../tests/source_folder_c/dir_a", Destination: "a/dir_a"},
+			{Type: CopyFile, Source: "../../tests/source_folder_c/file_a", Destination: "a/file_a"},
+			{Type: CopyFile, Source: "../../tests/source_folder_c/file_d", Destination: "a/file_d"},
+			{Type: CopyFile, Source: "../../tests/source_folder_c/file_e", Destination: "a/file_e"},
+			{Type: CopyFile, Source: "../../tests/source_folder_c/dir_a/file_a_a", Destination: "a/dir_a/file_a_a"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el.result = tt.files
+			fc := &fakeCopier{mu: sync.Mutex{}}
+			cd := &fakeChangeDetector{changed: tt.changed}
+			s := NewSynchronizer(tt.source, "a", fileCopier(fc), entryLister(el), ChangeDetection(cd))
+			got, err := s.Plan()
+			if err != nil {
+				t.Fatalf("Plan() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan() got = %v, want %v", got, tt.want)
+			}
+			if fc.fileCopied != 0 {
+				t.Errorf("Plan() file copied = %v, want 0", fc.fileCopied)
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Plan_withFilter(t *testing.T) {
+	el := &fakeEntryLister{}
+	excludeB, _ := filter.Exclude("file_b")
+	excludeZ, _ := filter.Exclude("file_z")
+	f := filter.New("", excludeB, excludeZ)
+
+	tests := []struct {
+		name           string
+		deleteExcluded bool
+		want           Plan
+	}{
+		{"excluded entries protected", false, Plan{
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_a", Destination: "a/file_a"},
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_c", Destination: "a/file_c"},
+			{Type: DeleteEntry, Destination: "a/file_y"},
+		}},
+		{"excluded entries deleted", true, Plan{
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_a", Destination: "a/file_a"},
+			{Type: CopyFile, Source: "../../tests/source_folder_a/file_c", Destination: "a/file_c"},
+			{Type: DeleteEntry, Destination: "a/file_b"},
+			{Type: DeleteEntry, Destination: "a/file_y"},
+			{Type: DeleteEntry, Destination: "a/file_z"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el.result = map[string]entryType{"file_b": file, "file_y": file, "file_z": file}
+			s := NewSynchronizer("../../tests/source_folder_a", "a", fileCopier(&fakeCopier{}), entryLister(el), Filter(f), DeleteExcluded(tt.deleteExcluded))
+			got, err := s.Plan()
+			if err != nil {
+				t.Fatalf("Plan() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan() got = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
+
+func Test_synchronizer_SyncContext_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fc := &fakeCopier{mu: sync.Mutex{}}
+	s := NewSynchronizer("../../tests/source_folder_a", t.TempDir(), fileCopier(fc))
+	_, err := s.SyncContext(ctx)
+
+	var cancelErr *CanceledError
+	if !errors.As(err, &cancelErr) {
+		t.Fatalf("SyncContext() error = %v, want a *CanceledError", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SyncContext() error = %v, want context.Canceled", err)
+	}
+	if fc.fileCopied != 0 {
+		t.Errorf("SyncContext() file copied = %v, want 0", fc.fileCopied)
+	}
+}
+
+func Test_synchronizer_ApplyContext_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fc := &fakeCopier{mu: sync.Mutex{}}
+	s := NewSynchronizer("../../tests/source_folder_a", t.TempDir(), fileCopier(fc), MaxGoroutine(1), CopyBufferSize(1))
+	p := Plan{
+		{Type: CopyFile, Source: "../../tests/source_folder_a/file_a", Destination: "a/file_a"},
+	}
+	cancel()
+	_, err := s.ApplyContext(ctx, p)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ApplyContext() error = %v, want context.Canceled", err)
+	}
+	if fc.fileCopied != 0 {
+		t.Errorf("ApplyContext() file copied = %v, want 0", fc.fileCopied)
+	}
+}
+
+type failingEntryLister struct {
+	failing string
+}
+
+func (el *failingEntryLister) listEntries(folder string) (map[string]entryType, error) {
+	if strings.HasSuffix(folder, el.failing) {
+		return nil, &fs.PathError{Op: "open", Path: folder, Err: fs.ErrPermission}
+	}
+	return map[string]entryType{}, nil
+}
+
+func Test_synchronizer_Sync_continueOnError(t *testing.T) {
+	tests := []struct {
+		name            string
+		continueOnError bool
+		wantFileCopied  int
+		wantCopyError   bool
+	}{
+		{"stop on directory failure", false, 0, false},
+		{"continue on directory failure", true, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := &fakeCopier{mu: sync.Mutex{}}
+			el := &failingEntryLister{failing: "dir_a"}
+			s := NewSynchronizer("../../tests/source_folder_c", t.TempDir(), fileCopier(fc), entryLister(el), ContinueOnError(tt.continueOnError))
+			report, err := s.Sync()
+			if err == nil {
+				t.Fatalf("Sync() expected an error")
+			}
+			if !errors.Is(err, fs.ErrPermission) {
+				t.Errorf("Sync() error = %v, want fs.ErrPermission", err)
+			}
+			var cpErr *CopyError
+			if errors.As(err, &cpErr) != tt.wantCopyError {
+				t.Errorf("Sync() error = %v, want a *CopyError %v", err, tt.wantCopyError)
+			}
+			if fc.fileCopied != tt.wantFileCopied {
+				t.Errorf("Sync() file copied = %v, want %v", fc.fileCopied, tt.wantFileCopied)
+			}
+			if report.Errors[string(PermissionError)] != 1 {
+				t.Errorf("Sync() report errors = %v, want 1 permission error", report.Errors)
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Sync_maxErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxErrors    int
+		wantMaxError bool
+	}{
+		{"no limit", 0, false},
+		{"limit not reached", 3, false},
+		{"limit reached", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := &fakeCopier{mu: sync.Mutex{}, err: errors.New("copy failed")}
+			s := NewSynchronizer("../../tests/source_folder_a", t.TempDir(), fileCopier(fc), entryLister(&fakeEntryLister{map[string]entryType{}}), MaxGoroutine(1), CopyBufferSize(1), MaxErrors(tt.maxErrors))
+			_, err := s.Sync()
+			var cpErr *CopyError
+			if !errors.As(err, &cpErr) {
+				t.Fatalf("Sync() error = %v, want a *CopyError", err)
+			}
+			if errors.Is(err, ErrMaxErrors) != tt.wantMaxError {
+				t.Errorf("Sync() error = %v, want ErrMaxErrors %v", err, tt.wantMaxError)
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Sync_olderSource(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name string
+		opts func(t *testing.T) []SynchronizerOption
+	}{
+		{"quick check", func(*testing.T) []SynchronizerOption { return nil }},
+		{"destination index", func(t *testing.T) []SynchronizerOption {
+			return []SynchronizerOption{DestinationIndex(path.Join(t.TempDir(), "index.json"))}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, destination := t.TempDir(), t.TempDir()
+			opts := tt.opts(t)
+			writeFile(t, source, "a", "aaaa", modTime)
+			if _, err := NewSynchronizer(source, destination, opts...).Sync(); err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+
+			// the source is restored to an older version of the same size
+			writeFile(t, source, "a", "bbbb", modTime.Add(-time.Hour))
+			report, err := NewSynchronizer(source, destination, opts...).Sync()
+			if err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if report.FilesCopied != 1 {
+				t.Errorf("Sync() copied %d files, want 1", report.FilesCopied)
+			}
+			if got, err := os.ReadFile(path.Join(destination, "a")); err != nil || string(got) != "bbbb" {
+				t.Errorf("Sync() a = %q, %v, want %q", got, err, "bbbb")
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Sync_withoutTimes(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		opts func(t *testing.T) []SynchronizerOption
+	}{
+		{"quick check", func(*testing.T) []SynchronizerOption { return nil }},
+		{"destination index", func(t *testing.T) []SynchronizerOption {
+			return []SynchronizerOption{DestinationIndex(path.Join(t.TempDir(), "index.json"))}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, destination := t.TempDir(), t.TempDir()
+			opts := append(tt.opts(t), PreserveAttributes(syncFile.Mode))
+			writeFile(t, source, "a", "aaaa", modTime)
+			writeFile(t, source, "dir/b", "bbbb", modTime)
+			if _, err := NewSynchronizer(source, destination, opts...).Sync(); err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+
+			report, err := NewSynchronizer(source, destination, opts...).Sync()
+			if err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if report.FilesCopied != 0 {
+				t.Errorf("second Sync() copied %d files, want 0", report.FilesCopied)
+			}
+		})
+	}
+}
+
+func Test_synchronizer_Sync_sparseFiles(t *testing.T) {
+	const size = 1024 * 1024
+	source, destination := t.TempDir(), t.TempDir()
+	// the zeros are written, only SparseFiles makes them holes
+	content := make([]byte, size)
+	copy(content[size/2:], "data")
+	if err := os.WriteFile(path.Join(source, "image"), content, 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+
+	report, err := NewSynchronizer(source, destination, SparseFiles(true)).Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.AllocatedBytes == 0 {
+		t.Skip("the allocated size is unknown on this platform")
+	}
+	if report.BytesCopied != size || report.AllocatedBytes >= size {
+		t.Errorf("Sync() report = %+v, want %d bytes copied and less allocated", report, size)
+	}
+}
+
+func Test_synchronizer_Sync_fastCopy(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	files := map[string]string{"a": "content of a", "dir/b": "content of b"}
+	for name, content := range files {
+		os.MkdirAll(path.Dir(path.Join(source, name)), 0755)
+		if err := os.WriteFile(path.Join(source, name), []byte(content), 0644); err != nil {
+			t.Fatalf("cannot create file for test: %v", err)
+		}
+	}
+
+	s := newSynchronizer(source, destination, FastCopy(syncFile.AutoCopy))
+	if _, ok := s.fileCopier.(*syncFile.FastCopy); !ok {
+		t.Fatalf("FastCopy() copier = %T, want *syncFile.FastCopy", s.fileCopier)
+	}
+	report, err := s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != len(files) {
+		t.Errorf("Sync() copied %d files, want %d", report.FilesCopied, len(files))
+	}
+	for name, content := range files {
+		if got, err := os.ReadFile(path.Join(destination, name)); err != nil || string(got) != content {
+			t.Errorf("Sync() %s = %q, %v, want %q", name, got, err, content)
+		}
+	}
+}
@@ -0,0 +1,577 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	syncFile "gosync/pkg/file"
+	"gosync/pkg/filter"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy decides how an entry changed on both sides of a two-way synchronization is resolved.
+type ConflictPolicy int
+
+const (
+	// NewerWins keeps the most recently modified version, a modification wins over a deletion.
+	NewerWins = ConflictPolicy(iota)
+	// SourceWins keeps the version of the source folder, even when it is a deletion.
+	SourceWins
+	// KeepBoth keeps the newer version and a renamed copy of the other one on both sides.
+	KeepBoth
+)
+
+// ParseConflictPolicy parses the name of a policy: newer, source or keep-both.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	for _, p := range []ConflictPolicy{NewerWins, SourceWins, KeepBoth} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown conflict policy %q", name)
+}
+
+func (p ConflictPolicy) String() string {
+	switch p {
+	case NewerWins:
+		return "newer"
+	case SourceWins:
+		return "source"
+	case KeepBoth:
+		return "keep-both"
+	default:
+		return fmt.Sprintf("unknown policy %d", int(p))
+	}
+}
+
+// Conflict is an entry changed on both sides of a two-way synchronization since the last one.
+type Conflict struct {
+	// Path is the slash separated path of the entry relative to the folders.
+	Path string `json:"path"`
+	// Winner is the side whose version is kept at Path: source or destination.
+	Winner string `json:"winner"`
+	// Copy is the path the other version is renamed to, it is only set by the KeepBoth policy.
+	Copy string `json:"copy,omitempty"`
+}
+
+func (c Conflict) String() string {
+	if c.Copy != "" {
+		return fmt.Sprintf("%s: %s version kept, other version kept as %s", c.Path, c.Winner, c.Copy)
+	}
+	return fmt.Sprintf("%s: %s version kept", c.Path, c.Winner)
+}
+
+// TwoWaySynchronizer synchronizes two folders in both directions: the changes made on each side
+// since the last synchronization, recorded in a state file, are propagated to the other side.
+type TwoWaySynchronizer struct {
+	s         *synchronizer
+	stateFile string
+}
+
+// NewTwoWaySynchronizer initializes a two-way synchronizer with the same options as a Synchronizer.
+// stateFile is the state database of the synchronization, it is ignored if it is inside one of the folders.
+func NewTwoWaySynchronizer(source, destination, stateFile string, opts ...SynchronizerOption) *TwoWaySynchronizer {
+	s := newSynchronizer(source, destination, opts...)
+	s.twoWay = true
+	return &TwoWaySynchronizer{s: s, stateFile: stateFile}
+}
+
+func (t *TwoWaySynchronizer) Sync() (*Report, error) {
+	return t.SyncContext(context.Background())
+}
+
+// SyncContext propagates the changes of both folders and records their new state, it stops when ctx is done
+// and returns a *CanceledError once the copies in progress are aborted or finished.
+// The state is only recorded when all the actions are performed, the entries whose actions failed keep their previous state
+// so they are synchronized again the next time.
+func (t *TwoWaySynchronizer) SyncContext(ctx context.Context) (*Report, error) {
+	start := time.Now()
+	r := t.s.newRun(ctx)
+	defer r.cancel()
+
+	if err := t.validate(); err != nil {
+		return r.report, err
+	}
+	st, err := loadState(t.s.destinationFS, t.stateFile)
+	if err != nil {
+		return r.report, err
+	}
+
+	p, err := t.plan(r, st, start)
+	if err == nil {
+		r.report.Conflicts = p.conflicts
+		err = t.s.checkDeletions(r, p.actions)
+	}
+	if err == nil {
+		err = t.s.apply(r, p.actions)
+	}
+	if err == nil && r.ctx.Err() == nil {
+		err = t.saveState(r, st)
+	}
+	r.report.Elapsed = time.Since(start)
+	return r.report, r.result(err)
+}
+
+// Plan computes the actions of the synchronization without modifying the folders.
+func (t *TwoWaySynchronizer) Plan() (Plan, error) {
+	r := t.s.newRun(context.Background())
+	defer r.cancel()
+
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	st, err := loadState(t.s.destinationFS, t.stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := t.plan(r, st, time.Now())
+	err = r.result(err)
+	var cpErr *CopyError
+	if err != nil && !errors.As(err, &cpErr) {
+		return nil, err
+	}
+	return p.actions, err
+}
+
+func (t *TwoWaySynchronizer) validate() error {
+	if err := t.s.validate(); err != nil {
+		return err
+	}
+	return isValidFS(t.s.destinationFS, t.s.Destination)
+}
+
+// side is one of the folders of a two-way synchronization.
+type side struct {
+	name, root string
+	// current are the entries of the folder, last are its entries at the end of the last synchronization.
+	current, last tree
+	// paths are the paths of the current entries in alphabetical order.
+	paths []string
+	// dirty are the folders containing changes since the last synchronization, or excluded entries that are protected.
+	dirty map[string]bool
+}
+
+func (sd *side) path(rel string) string {
+	return path.Join(sd.root, rel)
+}
+
+// changed returns true if the entry rel was created, modified or deleted since the last synchronization.
+func (sd *side) changed(rel string) bool {
+	cur, exists := sd.current[rel]
+	last, existed := sd.last[rel]
+	if exists != existed {
+		return true
+	}
+	return exists && !cur.same(last)
+}
+
+// markDirty marks the parent folders of the entries changed since the last synchronization.
+func (sd *side) markDirty() {
+	for rel := range sd.current {
+		if sd.changed(rel) {
+			markParents(sd.dirty, rel)
+		}
+	}
+	for rel := range sd.last {
+		if _, exists := sd.current[rel]; !exists {
+			markParents(sd.dirty, rel)
+		}
+	}
+}
+
+// markParents adds the parent folders of rel to dirs.
+func markParents(dirs map[string]bool, rel string) {
+	for rel != "" {
+		rel = path.Dir(rel)
+		if rel == "." {
+			rel = ""
+		}
+		dirs[rel] = true
+	}
+}
+
+// twoWayPlan is the planning of a two-way synchronization.
+type twoWayPlan struct {
+	source, destination *side
+	policy              ConflictPolicy
+	// fsys is the file system of both folders.
+	fsys syncFile.FS
+	// noDelete drops the deletions, the deleted entries stay on the other side.
+	noDelete bool
+	// started is the time the renamed copies of the conflicts are named after.
+	started time.Time
+
+	actions   Plan
+	conflicts []Conflict
+	// resolved are the entries whose whole tree is already planned, failed are the folders that cannot be read.
+	resolved, failed []string
+}
+
+// plan compares both folders with their last state and plans the propagation of their changes.
+func (t *TwoWaySynchronizer) plan(r *run, st *syncState, started time.Time) (*twoWayPlan, error) {
+	p := &twoWayPlan{
+		source:      &side{name: "source", root: t.s.Source, last: st.Source, dirty: make(map[string]bool)},
+		destination: &side{name: "destination", root: t.s.Destination, last: st.Destination, dirty: make(map[string]bool)},
+		policy:      t.s.conflictPolicy,
+		fsys:        t.s.destinationFS,
+		noDelete:    t.s.noDelete,
+		started:     started,
+		actions:     make(Plan, 0),
+		conflicts:   make([]Conflict, 0),
+	}
+
+	for _, sd := range []*side{p.source, p.destination} {
+		entries, protected, failed, err := t.scan(r, sd.root)
+		if err != nil {
+			return p, err
+		}
+		sd.current = entries
+		sd.paths = sortedPaths(entries)
+		sd.markDirty()
+		for _, rel := range append(protected, failed...) {
+			markParents(sd.dirty, rel)
+		}
+		p.failed = append(p.failed, failed...)
+	}
+
+	all := make(tree)
+	for _, entries := range []tree{p.source.current, p.source.last, p.destination.current, p.destination.last} {
+		for rel, e := range entries {
+			all[rel] = e
+		}
+	}
+
+	for _, rel := range sortedPaths(all) {
+		if err := r.ctx.Err(); err != nil {
+			return p, err
+		}
+		// the entries of an unreadable folder are unknown and must not be seen as deleted
+		if insideAny(rel, p.failed) || insideAny(rel, p.resolved) {
+			continue
+		}
+
+		sourceChanged, destinationChanged := p.source.changed(rel), p.destination.changed(rel)
+		switch {
+		case !sourceChanged && !destinationChanged:
+		case !destinationChanged:
+			p.propagate(rel, p.source, p.destination)
+		case !sourceChanged:
+			p.propagate(rel, p.destination, p.source)
+		case p.identical(rel):
+		default:
+			p.resolve(rel)
+		}
+	}
+	return p, nil
+}
+
+// identical returns true if an entry changed on both sides is the same on both sides.
+func (p *twoWayPlan) identical(rel string) bool {
+	s, sourceExists := p.source.current[rel]
+	d, destinationExists := p.destination.current[rel]
+	if !sourceExists || !destinationExists {
+		return sourceExists == destinationExists
+	}
+	if s.Type != d.Type {
+		return false
+	}
+	switch s.Type {
+	case file:
+		changed, err := (&syncFile.HashCheck{}).ChangedFS(p.fsys, p.source.path(rel), p.fsys, p.destination.path(rel))
+		return err == nil && !changed
+	case symlink:
+		return s.Target == d.Target
+	default:
+		return true
+	}
+}
+
+// propagate plans the actions applying the change of the entry rel from one side to the other side, where it didn't change.
+func (p *twoWayPlan) propagate(rel string, from, to *side) {
+	e, exists := from.current[rel]
+	old, toExists := to.current[rel]
+
+	if !exists {
+		if !toExists {
+			return
+		}
+		// a folder deleted on one side is kept if its content changed on the other side
+		if old.Type == folder && to.dirty[rel] {
+			p.add(Action{Type: CreateDir, Source: to.path(rel), Destination: from.path(rel)})
+			return
+		}
+		p.add(Action{Type: DeleteEntry, Destination: to.path(rel)})
+		p.resolved = append(p.resolved, rel)
+		return
+	}
+
+	if toExists && old.Type != e.Type {
+		// a folder replaced on one side while its content changed on the other side is a conflict
+		if old.Type == folder && to.dirty[rel] {
+			p.resolve(rel)
+			return
+		}
+		p.add(Action{Type: ReplaceType, Source: from.path(rel), Destination: to.path(rel)})
+		if e.Type != folder {
+			p.resolved = append(p.resolved, rel)
+		}
+		toExists = false
+	}
+	if e.Type == folder && toExists {
+		return
+	}
+	p.add(Action{Type: copyActionType(e.Type), Source: from.path(rel), Destination: to.path(rel)})
+}
+
+// resolve plans the replacement of the entry rel of one side with the tree of the other side according to the policy.
+// With the KeepBoth policy, the replaced tree is renamed and copied to the other side.
+func (p *twoWayPlan) resolve(rel string) {
+	winner, loser := p.source, p.destination
+	if p.policy != SourceWins {
+		s, sourceExists := p.source.current[rel]
+		d, destinationExists := p.destination.current[rel]
+		if !sourceExists || (destinationExists && d.ModTime > s.ModTime) {
+			winner, loser = p.destination, p.source
+		}
+	}
+
+	c := Conflict{Path: rel, Winner: winner.name}
+	w, winnerExists := winner.current[rel]
+	l, loserExists := loser.current[rel]
+
+	if p.policy == KeepBoth && winnerExists && loserExists {
+		c.Copy = conflictName(rel, p.started)
+		p.add(Action{Type: MoveEntry, Source: loser.path(rel), Destination: loser.path(c.Copy)})
+		p.copyTree(loser, winner, rel, c.Copy, c.Copy)
+		loserExists = false
+	}
+
+	switch {
+	case !winnerExists:
+		p.add(Action{Type: DeleteEntry, Destination: loser.path(rel)})
+	case loserExists && l.Type != w.Type:
+		p.add(Action{Type: ReplaceType, Source: winner.path(rel), Destination: loser.path(rel)})
+	}
+	if winnerExists {
+		p.copyTree(winner, loser, rel, rel, rel)
+	}
+	p.resolved = append(p.resolved, rel)
+	p.conflicts = append(p.conflicts, c)
+}
+
+// copyTree plans the copy of the entry rel of the from side and of its content, read at the path fromRel
+// of the from side and written at the path toRel of the to side.
+func (p *twoWayPlan) copyTree(from, to *side, rel, fromRel, toRel string) {
+	for i := sort.SearchStrings(from.paths, rel); i < len(from.paths); i++ {
+		name := from.paths[i]
+		if name != rel && !strings.HasPrefix(name, rel+"/") {
+			// the content of rel is sorted right after it, except the names starting with rel followed by a character lower than "/"
+			if name > rel+"/" {
+				break
+			}
+			continue
+		}
+		suffix := name[len(rel):]
+		p.add(Action{
+			Type:        copyActionType(from.current[name].Type),
+			Source:      from.path(fromRel + suffix),
+			Destination: to.path(toRel + suffix),
+		})
+	}
+}
+
+func (p *twoWayPlan) add(a Action) {
+	if p.noDelete && a.Type == DeleteEntry {
+		return
+	}
+	p.actions = append(p.actions, a)
+}
+
+// sortedPaths returns the paths of the entries in alphabetical order, the folders before their content.
+func sortedPaths(entries tree) []string {
+	paths := make([]string, 0, len(entries))
+	for rel := range entries {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// conflictName returns the path of the renamed copy of the entry rel, stamped with the time t.
+func conflictName(rel string, t time.Time) string {
+	dir, name := path.Split(rel)
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base, ext = name, ""
+	}
+	return dir + base + ".conflict-" + t.Format("20060102-150405") + ext
+}
+
+// scan records the entries of the folder root that are not excluded by the filter, except the temporary files
+// and the state file. protected are the excluded entries when they are not deleted, failed are the folders
+// that cannot be read.
+func (t *TwoWaySynchronizer) scan(r *run, root string) (entries tree, protected, failed []string, err error) {
+	entries = make(tree)
+	// both folders are on the same file system, validateFS refuses the others
+	fsys := t.s.destinationFS
+	stateInfo, _ := fsys.Lstat(t.stateFile)
+
+	scanError := func(dir string, err error) *EntryError {
+		if root == t.s.Destination {
+			return newEntryError(Action{Type: Scan, Destination: dir}, err)
+		}
+		return newEntryError(Action{Type: Scan, Source: dir}, err)
+	}
+	fail := func(dir string, err error) error {
+		entryErr := scanError(dir, err)
+		r.fail(entryErr)
+		if t.s.continueOnError {
+			return nil
+		}
+		return fmt.Errorf("cannot plan the synchronization: %w", entryErr)
+	}
+
+	type scanFolder struct {
+		rel   string
+		scope *filter.Scope
+	}
+
+	// the content of a folder whose root cannot be read would be seen as deleted, so the scan always stops
+	scope, err := t.s.filter.RootFS(root, openFunc(fsys))
+	if err != nil {
+		return entries, protected, failed, fmt.Errorf("cannot plan the synchronization: %w", scanError(root, fmt.Errorf("cannot load filter rules: %w", err)))
+	}
+	folderQueue := []scanFolder{{rel: "", scope: scope}}
+
+	for len(folderQueue) > 0 {
+		if err := r.ctx.Err(); err != nil {
+			return entries, protected, failed, err
+		}
+		current := folderQueue[0]
+		folderQueue = folderQueue[1:]
+		dir := path.Join(root, current.rel)
+
+		dirEntries, err := fsys.ReadDir(dir)
+		if err != nil && current.rel == "" {
+			return entries, protected, failed, fmt.Errorf("cannot plan the synchronization: %w", scanError(dir, err))
+		}
+		if err != nil {
+			failed = append(failed, current.rel)
+			if err = fail(dir, err); err != nil {
+				return entries, protected, failed, err
+			}
+			continue
+		}
+
+		for _, entry := range dirEntries {
+			rel := path.Join(current.rel, entry.Name())
+			entryPath := path.Join(dir, entry.Name())
+			entryType := getEntryType(entry.Type())
+			if entryType == file && syncFile.IsTempFile(entry.Name()) {
+				continue
+			}
+			// the special files are left out, their counterparts on the other side are kept
+			if _, ok := specialFileType(entryType); ok {
+				protected = append(protected, rel)
+				continue
+			}
+			if current.scope.Excluded(entry.Name(), entryType == folder) {
+				if !t.s.deleteExcluded {
+					protected = append(protected, rel)
+				}
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				failed = append(failed, rel)
+				if err = fail(entryPath, err); err != nil {
+					return entries, protected, failed, err
+				}
+				continue
+			}
+			if stateInfo != nil && syncFile.SameFile(info, stateInfo) {
+				continue
+			}
+
+			e := entryState{Type: entryType, ModTime: info.ModTime().UnixNano()}
+			switch entryType {
+			case file:
+				e.Size = info.Size()
+			case symlink:
+				e.Target, err = fsys.Readlink(entryPath)
+			case folder:
+				var child *filter.Scope
+				if child, err = current.scope.Child(entry.Name(), entryPath); err != nil {
+					err = fmt.Errorf("cannot load filter rules: %w", err)
+				} else {
+					folderQueue = append(folderQueue, scanFolder{rel: rel, scope: child})
+				}
+			}
+			if err != nil {
+				failed = append(failed, rel)
+				if err = fail(entryPath, err); err != nil {
+					return entries, protected, failed, err
+				}
+				continue
+			}
+			entries[rel] = e
+		}
+	}
+	return entries, protected, failed, nil
+}
+
+// saveState records the new state of both folders. The entries whose actions failed keep their previous state.
+func (t *TwoWaySynchronizer) saveState(r *run, st *syncState) error {
+	failed := make([]string, 0)
+	for _, err := range r.errs {
+		for _, entry := range []string{err.Source, err.Destination} {
+			for _, root := range []string{t.s.Source, t.s.Destination} {
+				if rel, ok := relativePath(root, entry); ok {
+					failed = append(failed, rel)
+				}
+			}
+		}
+	}
+
+	for _, sd := range []struct {
+		root string
+		last *tree
+	}{{t.s.Source, &st.Source}, {t.s.Destination, &st.Destination}} {
+		current, _, scanFailed, err := t.scan(r, sd.root)
+		if err != nil {
+			return err
+		}
+		failed = append(failed, scanFailed...)
+
+		next := make(tree, len(current))
+		for rel, e := range current {
+			if !insideAny(rel, failed) {
+				next[rel] = e
+			}
+		}
+		for rel, e := range *sd.last {
+			if insideAny(rel, failed) {
+				next[rel] = e
+			}
+		}
+		*sd.last = next
+	}
+
+	return st.save(t.s.destinationFS, t.stateFile)
+}
+
+// insideAny returns true if the entry rel is one of the entries dirs or inside one of them, all relative to the same folder.
+func insideAny(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
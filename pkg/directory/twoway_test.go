@@ -0,0 +1,211 @@
+package directory
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// writeFile creates the file rel of dir with content and modification time mtime.
+func writeFile(t *testing.T, dir, rel, content string, mtime time.Time) {
+	t.Helper()
+	name := path.Join(dir, rel)
+	if err := os.MkdirAll(path.Dir(name), os.ModePerm); err != nil {
+		t.Fatalf("cannot create directory for test: %v", err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatalf("cannot change times for test: %v", err)
+	}
+}
+
+// wantContent checks the content of the file rel of dir, an empty content means the file doesn't exist.
+func wantContent(t *testing.T, dir, rel, want string) {
+	t.Helper()
+	b, err := os.ReadFile(path.Join(dir, rel))
+	if want == "" {
+		if err == nil {
+			t.Errorf("%s exists, want it deleted", path.Join(dir, rel))
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("cannot read %s: %v", path.Join(dir, rel), err)
+	} else if string(b) != want {
+		t.Errorf("%s content = %q, want %q", path.Join(dir, rel), b, want)
+	}
+}
+
+func TestTwoWaySynchronizer_Sync(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	stateFile := path.Join(destination, DefaultStateFile)
+	now := time.Now().Truncate(time.Second)
+
+	writeFile(t, source, "file_a", "a", now)
+	writeFile(t, destination, "file_b", "b", now)
+	s := NewTwoWaySynchronizer(source, destination, stateFile)
+
+	report, err := s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 2 {
+		t.Errorf("Sync() files copied = %v, want 2", report.FilesCopied)
+	}
+	wantContent(t, source, "file_b", "b")
+	wantContent(t, destination, "file_a", "a")
+	wantContent(t, source, DefaultStateFile, "")
+
+	writeFile(t, destination, "file_b", "b2", now.Add(time.Hour))
+	writeFile(t, source, "dir_a/file_c", "c", now)
+	if err := os.Remove(path.Join(source, "file_a")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report, err = s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 2 || report.DirsCreated != 1 || report.EntriesDeleted != 1 || len(report.Conflicts) != 0 {
+		t.Errorf("Sync() report = %+v", report)
+	}
+	wantContent(t, source, "file_b", "b2")
+	wantContent(t, destination, "file_a", "")
+	wantContent(t, destination, "dir_a/file_c", "c")
+
+	report, err = s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	if report.FilesCopied != 0 || report.EntriesDeleted != 0 {
+		t.Errorf("Sync() without changes report = %+v", report)
+	}
+}
+
+func TestTwoWaySynchronizer_Sync_deletedFolder(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	stateFile := path.Join(t.TempDir(), "state.json")
+	now := time.Now().Truncate(time.Second)
+
+	writeFile(t, source, "dir_a/file_a", "a", now)
+	writeFile(t, source, "dir_a/file_b", "b", now)
+	s := NewTwoWaySynchronizer(source, destination, stateFile)
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+
+	// the folder is deleted from the source while one of its files is modified at the destination
+	if err := os.RemoveAll(path.Join(source, "dir_a")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	writeFile(t, destination, "dir_a/file_b", "b2", now.Add(time.Hour))
+
+	if _, err := s.Sync(); err != nil {
+		t.Fatalf("Sync() unexpected error: %v", err)
+	}
+	wantContent(t, destination, "dir_a/file_a", "")
+	wantContent(t, destination, "dir_a/file_b", "b2")
+	wantContent(t, source, "dir_a/file_b", "b2")
+}
+
+func TestTwoWaySynchronizer_Sync_conflicts(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name            string
+		policy          ConflictPolicy
+		sourceDeleted   bool
+		wantSource      string
+		wantDestination string
+		wantWinner      string
+		wantCopy        string
+	}{
+		{"newer", NewerWins, false, "destination", "destination", "destination", ""},
+		{"source", SourceWins, false, "source", "source", "source", ""},
+		{"keep both", KeepBoth, false, "destination", "destination", "destination", "source"},
+		{"newer modified over deleted", NewerWins, true, "destination", "destination", "destination", ""},
+		{"source deleted", SourceWins, true, "", "", "source", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, destination := t.TempDir(), t.TempDir()
+			stateFile := path.Join(t.TempDir(), "state.json")
+			writeFile(t, source, "file.txt", "initial", now)
+
+			s := NewTwoWaySynchronizer(source, destination, stateFile, OnConflict(tt.policy))
+			if _, err := s.Sync(); err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+
+			if tt.sourceDeleted {
+				if err := os.Remove(path.Join(source, "file.txt")); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else {
+				writeFile(t, source, "file.txt", "source", now.Add(time.Hour))
+			}
+			writeFile(t, destination, "file.txt", "destination", now.Add(2*time.Hour))
+
+			report, err := s.Sync()
+			if err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if len(report.Conflicts) != 1 {
+				t.Fatalf("Sync() conflicts = %v, want 1 conflict", report.Conflicts)
+			}
+			c := report.Conflicts[0]
+			if c.Path != "file.txt" || c.Winner != tt.wantWinner {
+				t.Errorf("Sync() conflict = %v, want %s version kept", c, tt.wantWinner)
+			}
+			wantContent(t, source, "file.txt", tt.wantSource)
+			wantContent(t, destination, "file.txt", tt.wantDestination)
+			if tt.wantCopy != "" {
+				if c.Copy == "" {
+					t.Fatalf("Sync() conflict = %v, want a renamed copy", c)
+				}
+				wantContent(t, source, c.Copy, tt.wantCopy)
+				wantContent(t, destination, c.Copy, tt.wantCopy)
+			}
+
+			report, err = s.Sync()
+			if err != nil || len(report.Conflicts) != 0 || report.FilesCopied != 0 {
+				t.Errorf("Sync() after the resolution report = %+v, error = %v", report, err)
+			}
+		})
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, p := range []ConflictPolicy{NewerWins, SourceWins, KeepBoth} {
+		got, err := ParseConflictPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseConflictPolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseConflictPolicy("older"); err == nil {
+		t.Errorf("ParseConflictPolicy() expected an error for an unknown policy")
+	}
+}
+
+func Test_conflictName(t *testing.T) {
+	stamp := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{"file.txt", "file.conflict-20240301-102030.txt"},
+		{"dir/archive.tar.gz", "dir/archive.tar.conflict-20240301-102030.gz"},
+		{"dir/.profile", "dir/.profile.conflict-20240301-102030"},
+		{"dir", "dir.conflict-20240301-102030"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := conflictName(tt.rel, stamp); got != tt.want {
+				t.Errorf("conflictName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
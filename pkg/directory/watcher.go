@@ -0,0 +1,174 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	syncFile "gosync/pkg/file"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// change is a change notified in the directory dir of the source tree, dir is a slash separated path relative to the source folder.
+// name is the entry of dir that changed, it is empty when the whole tree must be synchronized again.
+type change struct {
+	dir, name string
+}
+
+// notifier watches the directories of a source tree.
+type notifier interface {
+	// addTree watches the directory rel of the source tree and all its sub directories.
+	addTree(rel string) error
+	// changes returns the channel of the notified changes, it is closed when the notifier is closed.
+	changes() <-chan change
+	// errors returns the channel of the failures of the notifier.
+	errors() <-chan error
+	close() error
+}
+
+// Watcher mirrors a source folder into a destination folder continuously:
+// after an initial synchronization, the changes of the source tree are applied to the destination incrementally.
+type Watcher struct {
+	s *synchronizer
+	// index is the destination index saved by the last synchronization of the changed directories,
+	// it is reused by the next one instead of being read again. It is nil if it must be read.
+	index *destinationIndex
+}
+
+// NewWatcher initializes a watcher with the same options as a Synchronizer.
+func NewWatcher(source, destination string, opts ...SynchronizerOption) *Watcher {
+	return &Watcher{s: newSynchronizer(source, destination, opts...)}
+}
+
+// Watch synchronizes the folders, then watches the source tree and synchronizes the changed directories
+// once no new change happened for the debounce delay. onSync, if not nil, receives the result of each synchronization.
+// Watch runs until ctx is done, it then returns a *CanceledError, or until the watch of the source tree fails.
+func (w *Watcher) Watch(ctx context.Context, onSync func(report *Report, err error)) error {
+	if err := w.s.validate(); err != nil {
+		return err
+	}
+	if !syncFile.IsLocal(w.s.sourceFS) {
+		return &InputError{msg: "the watch mode is only available for a source folder on the local disk"}
+	}
+	if onSync == nil {
+		onSync = func(*Report, error) {}
+	}
+
+	// the notifier stops sending the changes once Watch returns
+	notifyCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	n, err := newNotifier(notifyCtx, w.s.Source)
+	if err != nil {
+		return err
+	}
+	defer n.close()
+
+	// the tree is watched before the initial synchronization so no change is missed
+	if err := n.addTree(""); err != nil {
+		return err
+	}
+	w.index = nil
+	onSync(w.s.SyncContext(ctx))
+
+	// dirty are the directories to synchronize, mapped to true if their sub directories must be synchronized too
+	dirty := make(map[string]bool)
+	var debounceC <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return &CanceledError{Err: ctx.Err()}
+		case err := <-n.errors():
+			return err
+		case c, ok := <-n.changes():
+			if !ok {
+				return errors.New("the watch of the source folder stopped")
+			}
+			recursive := c.name == "" || c.name == w.s.filter.IgnoreFile()
+			dirty[c.dir] = dirty[c.dir] || recursive
+			debounceC = time.After(w.s.watchDebounce)
+		case <-debounceC:
+			debounceC = nil
+			if dirty[""] {
+				w.index = nil
+				onSync(w.s.SyncContext(ctx))
+			} else {
+				onSync(w.syncDirs(ctx, dirty))
+			}
+			dirty = make(map[string]bool)
+		}
+	}
+}
+
+// syncDirs synchronizes the dirty directories, parents first, so the content of a directory created by the
+// synchronization of its parent is up to date when the directory itself is synchronized.
+// The destination index is updated with the changed entries only and saved once all the directories are synchronized.
+func (w *Watcher) syncDirs(ctx context.Context, dirty map[string]bool) (*Report, error) {
+	start := time.Now()
+	r := w.s.newRun(ctx)
+	defer r.cancel()
+	r.batch = true
+
+	dirs := make([]string, 0, len(dirty))
+	for dir := range dirty {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var err error
+	if r.index = w.index; r.index == nil {
+		err = w.s.openIndex(r)
+	}
+	// the next synchronization reads the index again unless this one saves it
+	w.index = nil
+	if err == nil && r.index != nil {
+		err = w.s.invalidateIndex()
+	}
+	if err == nil {
+		err = w.s.openJournal(r)
+	}
+	for _, dir := range dirs {
+		if err != nil || r.ctx.Err() != nil {
+			break
+		}
+		if hasRecursiveParent(dir, dirty) {
+			continue
+		}
+		// a directory removed from the source is deleted by the synchronization of its parent
+		if _, statErr := w.s.sourceFS.Stat(path.Join(w.s.Source, dir)); errors.Is(statErr, fs.ErrNotExist) {
+			continue
+		}
+
+		var p Plan
+		p, err = w.s.planTree(r, dir, dirty[dir])
+		if err == nil {
+			err = w.s.checkDeletions(r, p)
+		}
+		if err == nil {
+			err = w.s.apply(r, p)
+		}
+	}
+	if err == nil && r.index != nil {
+		var saved bool
+		if saved, err = w.s.saveIndex(r); saved {
+			w.index = r.index
+		}
+	}
+
+	r.report.Elapsed = time.Since(start)
+	return r.report, r.result(err)
+}
+
+// hasRecursiveParent returns true if a parent of dir is synchronized with its sub directories.
+func hasRecursiveParent(dir string, dirty map[string]bool) bool {
+	for dir != "" {
+		dir = path.Dir(dir)
+		if dir == "." {
+			dir = ""
+		}
+		if dirty[dir] {
+			return true
+		}
+	}
+	return false
+}
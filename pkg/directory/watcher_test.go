@@ -0,0 +1,184 @@
+//go:build linux
+
+package directory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_hasRecursiveParent(t *testing.T) {
+	dirty := map[string]bool{"a": true, "b": false, "b/c": false}
+	tests := []struct {
+		dir  string
+		want bool
+	}{
+		{"a", false},
+		{"a/b", true},
+		{"a/b/c", true},
+		{"b", false},
+		{"b/c", false},
+		{"b/c/d", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			if got := hasRecursiveParent(tt.dir, dirty); got != tt.want {
+				t.Errorf("hasRecursiveParent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !hasRecursiveParent("a", map[string]bool{"": true}) {
+		t.Errorf("hasRecursiveParent() = false, want true for a dirty root")
+	}
+}
+
+func TestWatcher_Watch(t *testing.T) {
+	source, err := os.MkdirTemp(os.TempDir(), "")
+	if err != nil {
+		t.Fatal("cannot create temp dir for test")
+	}
+	defer os.RemoveAll(source)
+	destination, err := os.MkdirTemp(os.TempDir(), "")
+	if err != nil {
+		t.Fatal("cannot create temp dir for test")
+	}
+	defer os.RemoveAll(destination)
+
+	if err := os.WriteFile(path.Join(source, "file_a"), []byte("a"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	syncC := make(chan error, 10)
+	w := NewWatcher(source, destination, WatchDebounce(50*time.Millisecond))
+	watchC := make(chan error)
+	go func() {
+		watchC <- w.Watch(ctx, func(report *Report, err error) {
+			syncC <- err
+		})
+	}()
+
+	waitSync := func(step string) {
+		select {
+		case err := <-syncC:
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", step, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no synchronization", step)
+		}
+	}
+	mustExist := func(name string, exist bool) {
+		_, err := os.Stat(path.Join(destination, name))
+		if (err == nil) != exist {
+			t.Errorf("%s exists = %v, want %v", name, err == nil, exist)
+		}
+	}
+
+	waitSync("initial synchronization")
+	mustExist("file_a", true)
+
+	if err := os.MkdirAll(path.Join(source, "dir_a", "dir_b"), os.ModePerm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(path.Join(source, "dir_a", "dir_b", "file_b"), []byte("b"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.Remove(path.Join(source, "file_a")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitSync("changes")
+	mustExist("file_a", false)
+	mustExist("dir_a/dir_b/file_b", true)
+
+	cancel()
+	select {
+	case err := <-watchC:
+		var cancelErr *CanceledError
+		if !errors.As(err, &cancelErr) {
+			t.Errorf("Watch() error = %v, want a *CanceledError", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Watch() did not stop")
+	}
+}
+
+func TestWatcher_Watch_index(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	indexFile := path.Join(t.TempDir(), "index.json")
+	writeFile(t, source, "dir/file_a", "a", time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	syncC := make(chan error, 10)
+	w := NewWatcher(source, destination, WatchDebounce(50*time.Millisecond), DestinationIndex(indexFile))
+	go w.Watch(ctx, func(report *Report, err error) {
+		syncC <- err
+	})
+	waitSync := func(step string) {
+		select {
+		case err := <-syncC:
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", step, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no synchronization", step)
+		}
+	}
+	wantIndexed := func(rel string, want bool) {
+		ix, err := loadIndex(indexFile)
+		if err != nil || ix == nil {
+			t.Fatalf("loadIndex() = %v, %v, want the saved index", ix, err)
+		}
+		if _, ok := ix.Entries[rel]; ok != want {
+			t.Errorf("index entry %s = %v, want %v", rel, ok, want)
+		}
+	}
+
+	waitSync("initial synchronization")
+	wantIndexed("dir/file_a", true)
+
+	// the second change is applied to the index kept by the first one
+	for _, name := range []string{"dir/file_b", "dir/file_c"} {
+		writeFile(t, source, name, "content", time.Now())
+		waitSync(name)
+		wantIndexed(name, true)
+	}
+	wantIndexed("dir/file_a", true)
+	wantIndexed("dir/file_b", true)
+}
+
+func Test_inotifyNotifier_send_watchEnded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	n, err := newNotifier(ctx, t.TempDir())
+	if err != nil {
+		t.Fatalf("newNotifier() unexpected error: %v", err)
+	}
+	defer n.close()
+	cancel()
+
+	// the changes nobody receives fill the channel, then the sends stop
+	doneC := make(chan error)
+	go func() {
+		for i := 0; i < 2*cap(n.(*inotifyNotifier).changeC); i++ {
+			if err := n.(*inotifyNotifier).send(change{}); err != nil {
+				doneC <- err
+				return
+			}
+		}
+		doneC <- nil
+	}()
+	select {
+	case err := <-doneC:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("send() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("send() blocked after the end of the watch")
+	}
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+package directory
+
+import (
+	syncFile "gosync/pkg/file"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func Test_synchronizer_Sync_xattrs(t *testing.T) {
+	source, destination := t.TempDir(), t.TempDir()
+	name := path.Join(source, "dir", "file")
+	if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+		t.Fatalf("cannot create folder for test: %v", err)
+	}
+	if err := os.WriteFile(name, []byte("content"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+	for _, entry := range []string{name, path.Dir(name)} {
+		if err := syscall.Setxattr(entry, "user.origin", []byte("upload"), 0); err != nil {
+			t.Skipf("extended attributes not supported: %v", err)
+		}
+	}
+
+	preserve := syncFile.DefaultAttributes | syncFile.Xattrs
+	xattr := func(entry string) string {
+		buf := make([]byte, 64)
+		n, err := syscall.Getxattr(path.Join(destination, entry), "user.origin", buf)
+		if err != nil {
+			return ""
+		}
+		return string(buf[:n])
+	}
+	tests := []struct {
+		name       string
+		value      string
+		wantCopied int
+	}{
+		{"copied", "upload", 1},
+		{"up to date", "upload", 0},
+		// only the extended attribute of the source changed
+		{"changed", "import", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := syscall.Setxattr(name, "user.origin", []byte(tt.value), 0); err != nil {
+				t.Fatalf("cannot set extended attribute for test: %v", err)
+			}
+			report, err := NewSynchronizer(source, destination, PreserveAttributes(preserve)).Sync()
+			if err != nil {
+				t.Fatalf("Sync() unexpected error: %v", err)
+			}
+			if report.FilesCopied != tt.wantCopied {
+				t.Errorf("Sync() copied %d files, want %d", report.FilesCopied, tt.wantCopied)
+			}
+			if got := xattr("dir/file"); got != tt.value {
+				t.Errorf("Sync() file extended attribute = %q, want %q", got, tt.value)
+			}
+			if got := xattr("dir"); got != "upload" {
+				t.Errorf("Sync() directory extended attribute = %q, want %q", got, "upload")
+			}
+		})
+	}
+}
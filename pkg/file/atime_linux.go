@@ -0,0 +1,16 @@
+package file
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the last access time of the file described by info.
+func accessTime(info os.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+}
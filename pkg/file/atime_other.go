@@ -0,0 +1,14 @@
+//go:build !linux
+
+package file
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the last access time of the file described by info.
+// The modification time is used on platforms where the access time is not exposed.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
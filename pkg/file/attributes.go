@@ -0,0 +1,137 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Attributes is a set of file metadata preserved when copying.
+type Attributes int
+
+const (
+	// Mode preserves the permission bits, including setuid, setgid and sticky bits.
+	Mode Attributes = 1 << iota
+	// Times preserves the access and modification times.
+	Times
+	// Owner preserves the user and group owning the file, it is only applied when running as root.
+	Owner
+	// Xattrs preserves the extended attributes of the user namespace, user.*.
+	Xattrs
+	// TrustedXattrs preserves the extended attributes of the trusted namespace, trusted.*, only visible to root.
+	TrustedXattrs
+	// ACLs preserves the POSIX ACLs, system.posix_acl_access and system.posix_acl_default.
+	ACLs
+	// SecurityLabels preserves the extended attributes of the security namespace, security.*, such as the SELinux labels
+	// and the file capabilities. Setting them usually requires the privileges of root.
+	SecurityLabels
+)
+
+// DefaultAttributes are the attributes preserved unless configured otherwise.
+const DefaultAttributes = Mode | Times
+
+// ExtendedAttributes are the attributes stored as extended attributes, they are supported on Linux and by the XattrFS.
+const ExtendedAttributes = Xattrs | TrustedXattrs | ACLs | SecurityLabels
+
+var attributeNames = map[string]Attributes{
+	"mode":     Mode,
+	"times":    Times,
+	"owner":    Owner,
+	"xattrs":   Xattrs,
+	"trusted":  TrustedXattrs,
+	"acls":     ACLs,
+	"security": SecurityLabels,
+}
+
+// Has returns true if all the attributes of attr are in a.
+func (a Attributes) Has(attr Attributes) bool {
+	return a&attr == attr
+}
+
+func (a Attributes) String() string {
+	names := make([]string, 0, len(attributeNames))
+	for _, name := range []string{"mode", "times", "owner", "xattrs", "trusted", "acls", "security"} {
+		if a.Has(attributeNames[name]) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseAttributes parses a comma separated list of attributes such as "mode,times,owner,xattrs,acls", "none" is the empty set.
+func ParseAttributes(s string) (Attributes, error) {
+	var attrs Attributes
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "none" {
+			continue
+		}
+		attr, ok := attributeNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown attribute %q", name)
+		}
+		attrs |= attr
+	}
+	return attrs, nil
+}
+
+// CopyMetadata applies the extended attributes of the sourceFile and the attributes of info, its stats, to the destination entry.
+func CopyMetadata(sourceFile, destination string, info os.FileInfo, attrs Attributes) error {
+	return CopyMetadataFS(OSFS{}, sourceFile, OSFS{}, destination, info, attrs)
+}
+
+// CopyMetadataFS applies the metadata of the sourceFile of sourceFS to the destination entry of destinationFS like CopyMetadata.
+func CopyMetadataFS(sourceFS FS, sourceFile string, destinationFS FS, destination string, info os.FileInfo, attrs Attributes) error {
+	if err := CopyXattrsFS(sourceFS, sourceFile, destinationFS, destination, attrs); err != nil {
+		return err
+	}
+	return CopyAttributesFS(destinationFS, destination, info, attrs)
+}
+
+// CopyAttributes applies the attributes of info, the stats of the source entry, to the destination entry.
+// Only the owner is applied to symlinks, the extended attributes are applied by CopyMetadata.
+func CopyAttributes(destination string, info os.FileInfo, attrs Attributes) error {
+	return CopyAttributesFS(OSFS{}, destination, info, attrs)
+}
+
+// CopyAttributesFS applies the attributes of info to the destination entry of fsys like CopyAttributes.
+func CopyAttributesFS(fsys FS, destination string, info os.FileInfo, attrs Attributes) error {
+	isSymlink := info.Mode()&os.ModeSymlink != 0
+
+	if attrs.Has(Owner) && os.Geteuid() == 0 {
+		if uid, gid, ok := owner(info); ok {
+			if err := fsys.Lchown(destination, uid, gid); err != nil {
+				return fmt.Errorf("cannot change owner of %s: %w", destination, err)
+			}
+		}
+	}
+	if isSymlink {
+		return nil
+	}
+
+	if attrs.Has(Mode) {
+		mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := fsys.Chmod(destination, mode); err != nil {
+			return fmt.Errorf("cannot change mode of %s: %w", destination, err)
+		}
+	}
+
+	if attrs.Has(Times) {
+		if err := fsys.Chtimes(destination, accessTime(info), info.ModTime()); err != nil {
+			return fmt.Errorf("cannot change times of %s: %w", destination, err)
+		}
+	}
+
+	return nil
+}
+
+// owner returns the user and group owning the entry described by info.
+func owner(info os.FileInfo) (int, int, bool) {
+	if m, ok := info.(*memInfo); ok {
+		return m.uid, m.gid, true
+	}
+	return ownerOf(info)
+}
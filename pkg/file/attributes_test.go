@@ -0,0 +1,88 @@
+package file
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestParseAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Attributes
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"none", "none", 0, false},
+		{"mode", "mode", Mode, false},
+		{"all", "mode, times,owner", Mode | Times | Owner, false},
+		{"extended attributes", "xattrs,acls,security", Xattrs | ACLs | SecurityLabels, false},
+		{"unknown", "mode,size", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAttributes(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAttributes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicCopy_CopyPreserve(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "")
+	if err != nil {
+		t.Fatal("cannot create temp dir for test")
+	}
+	defer os.RemoveAll(dir)
+
+	source := path.Join(dir, "source")
+	if err := os.WriteFile(source, []byte("#!/bin/sh"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+	if err := os.Chmod(source, 0751); err != nil {
+		t.Fatalf("cannot change mode for test: %v", err)
+	}
+	modTime := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(source, modTime, modTime); err != nil {
+		t.Fatalf("cannot change times for test: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		preserve    Attributes
+		wantMode    bool
+		wantModTime bool
+	}{
+		{"nothing", 0, false, false},
+		{"mode", Mode, true, false},
+		{"times", Times, false, true},
+		{"default", DefaultAttributes, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination := path.Join(dir, tt.name, "destination")
+			c := BasicCopy{Preserve: tt.preserve}
+			if err := c.Copy(source, destination, false); err != nil {
+				t.Fatalf("Copy() unexpected error = %v", err)
+			}
+
+			info, err := os.Stat(destination)
+			if err != nil {
+				t.Fatalf("Copy() file %s should exists, %v", destination, err)
+			}
+			if got := info.Mode().Perm() == 0751; got != tt.wantMode {
+				t.Errorf("Copy() mode = %v, want preserved %v", info.Mode().Perm(), tt.wantMode)
+			}
+			if got := info.ModTime().Equal(modTime); got != tt.wantModTime {
+				t.Errorf("Copy() modification time = %v, want preserved %v", info.ModTime(), tt.wantModTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ChangeDetector decides if a file that already exists at the destination is out of date.
+type ChangeDetector interface {
+	//Changed returns true if the destinationFile differs from the sourceFile and must be copied again.
+	Changed(sourceFile, destinationFile string) (bool, error)
+}
+
+// FSChangeDetector is a ChangeDetector comparing files of any FS.
+type FSChangeDetector interface {
+	ChangeDetector
+	//ChangedFS returns true if the destinationFile of destinationFS differs from the sourceFile of sourceFS.
+	ChangedFS(sourceFS FS, sourceFile string, destinationFS FS, destinationFile string) (bool, error)
+}
+
+// QuickCheck considers a file changed when its size or its modification time differs, the source may be older
+// than the destination, such as a restored backup. The times are compared to the second when one of them has
+// no fraction of a second, as on the file systems storing coarser times.
+type QuickCheck struct {
+	// SizeOnly compares the sizes only, for the destination files whose modification time is not preserved.
+	SizeOnly bool
+}
+
+func (c *QuickCheck) Changed(sourceFile, destinationFile string) (bool, error) {
+	return c.ChangedFS(OSFS{}, sourceFile, OSFS{}, destinationFile)
+}
+
+func (c *QuickCheck) ChangedFS(sourceFS FS, sourceFile string, destinationFS FS, destinationFile string) (bool, error) {
+	srcInfo, dstInfo, err := statPair(sourceFS, sourceFile, destinationFS, destinationFile)
+	if err != nil || dstInfo == nil {
+		return true, err
+	}
+
+	return c.ChangedStats(srcInfo.Size(), srcInfo.ModTime(), dstInfo.Size(), dstInfo.ModTime()), nil
+}
+
+// ChangedStats returns true if a source file of size sourceSize modified at sourceTime differs from a destination file
+// of size destinationSize modified at destinationTime.
+func (c *QuickCheck) ChangedStats(sourceSize int64, sourceTime time.Time, destinationSize int64, destinationTime time.Time) bool {
+	if sourceSize != destinationSize {
+		return true
+	}
+	if c.SizeOnly || sourceTime.Equal(destinationTime) {
+		return false
+	}
+	if sourceTime.Nanosecond() == 0 || destinationTime.Nanosecond() == 0 {
+		return !sourceTime.Truncate(time.Second).Equal(destinationTime.Truncate(time.Second))
+	}
+	return true
+}
+
+// HashCheck considers a file changed when its size or its content hash differs.
+type HashCheck struct {
+	// Algorithm is the hash comparing the content, SHA256 if it is empty.
+	Algorithm HashAlgorithm
+}
+
+func (c *HashCheck) Changed(sourceFile, destinationFile string) (bool, error) {
+	return c.ChangedFS(OSFS{}, sourceFile, OSFS{}, destinationFile)
+}
+
+func (c *HashCheck) ChangedFS(sourceFS FS, sourceFile string, destinationFS FS, destinationFile string) (bool, error) {
+	srcInfo, dstInfo, err := statPair(sourceFS, sourceFile, destinationFS, destinationFile)
+	if err != nil || dstInfo == nil {
+		return true, err
+	}
+	if srcInfo.Size() != dstInfo.Size() {
+		return true, nil
+	}
+
+	srcHash, err := HashFS(sourceFS, sourceFile, c.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	dstHash, err := HashFS(destinationFS, destinationFile, c.Algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(srcHash, dstHash), nil
+}
+
+// AlwaysCopy considers every file changed.
+type AlwaysCopy struct{}
+
+func (*AlwaysCopy) Changed(string, string) (bool, error) {
+	return true, nil
+}
+
+func (*AlwaysCopy) ChangedFS(FS, string, FS, string) (bool, error) {
+	return true, nil
+}
+
+// SymlinkChanged returns true if the two symlinks don't point to the same target.
+func SymlinkChanged(sourceLink, destinationLink string) (bool, error) {
+	srcTarget, err := os.Readlink(sourceLink)
+	if err != nil {
+		return false, fmt.Errorf("cannot read symlink %s: %w", sourceLink, err)
+	}
+	dstTarget, err := os.Readlink(destinationLink)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("cannot read symlink %s: %w", destinationLink, err)
+	}
+
+	return srcTarget != dstTarget, nil
+}
+
+// statPair returns the stats of both files. The destination stats are nil if the destination doesn't exist.
+func statPair(sourceFS FS, sourceFile string, destinationFS FS, destinationFile string) (os.FileInfo, os.FileInfo, error) {
+	srcInfo, err := sourceFS.Stat(sourceFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting stats for file %s: %w", sourceFile, err)
+	}
+	dstInfo, err := destinationFS.Stat(destinationFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return srcInfo, nil, nil
+		}
+		return nil, nil, fmt.Errorf("error getting stats for file %s: %w", destinationFile, err)
+	}
+
+	return srcInfo, dstInfo, nil
+}
@@ -0,0 +1,65 @@
+package file
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestChangeDetector_Changed(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "")
+	if err != nil {
+		t.Fatal("cannot create temp dir for test")
+	}
+	defer os.RemoveAll(dir)
+
+	source := path.Join(dir, "source")
+	same := path.Join(dir, "same")
+	sameSizeOlder := path.Join(dir, "same_size_older")
+	sameSizeNewer := path.Join(dir, "same_size_newer")
+	bigger := path.Join(dir, "bigger")
+	truncated := path.Join(dir, "truncated")
+	for name, content := range map[string]string{source: "content", same: "content", sameSizeOlder: "CONTENT", sameSizeNewer: "CONTENT", bigger: "more content", truncated: "content"} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("cannot create file for test: %v", err)
+		}
+	}
+	now := time.Now().Truncate(time.Second).Add(500 * time.Millisecond)
+	_ = os.Chtimes(source, now, now)
+	_ = os.Chtimes(same, now, now)
+	_ = os.Chtimes(sameSizeOlder, now, now.Add(-time.Hour))
+	_ = os.Chtimes(sameSizeNewer, now, now.Add(time.Hour))
+	_ = os.Chtimes(truncated, now, now.Truncate(time.Second))
+
+	tests := []struct {
+		name        string
+		detector    ChangeDetector
+		destination string
+		want        bool
+	}{
+		{"quick same file", &QuickCheck{}, same, false},
+		{"quick older destination", &QuickCheck{}, sameSizeOlder, true},
+		{"quick older source", &QuickCheck{}, sameSizeNewer, true},
+		{"quick different size", &QuickCheck{}, bigger, true},
+		{"quick missing destination", &QuickCheck{}, path.Join(dir, "missing"), true},
+		{"quick time truncated to the second", &QuickCheck{}, truncated, false},
+		{"quick size only", &QuickCheck{SizeOnly: true}, sameSizeNewer, false},
+		{"quick size only, different size", &QuickCheck{SizeOnly: true}, bigger, true},
+		{"hash same file", &HashCheck{}, same, false},
+		{"hash newer destination", &HashCheck{}, sameSizeNewer, true},
+		{"hash different size", &HashCheck{}, bigger, true},
+		{"always same file", &AlwaysCopy{}, same, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.detector.Changed(source, tt.destination)
+			if err != nil {
+				t.Fatalf("Changed() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Changed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// DefaultBlockSize is the size of the blocks compared by a DeltaCopy unless configured otherwise.
+const DefaultBlockSize = 64 * 1024
+
+// DeltaStats describes the data written by delta copies.
+type DeltaStats struct {
+	// LiteralBytes is the number of bytes of the source files that don't match a block of the destination files.
+	LiteralBytes int64 `json:"literal_bytes"`
+	// MatchedBytes is the number of bytes of the source files found in a block of the destination files.
+	MatchedBytes int64 `json:"matched_bytes"`
+}
+
+// DeltaCopy is a Copier that reuses the blocks of an existing destination file, as rsync does:
+// the blocks of the destination file are indexed by a rolling checksum and a SHA-256 hash,
+// the source file is scanned for these blocks and only the data not found in the destination is literal.
+// An atomic copy builds the new file from the matched blocks and the literal data in a temporary file,
+// a copy in place only rewrites the regions of the destination file that changed.
+// New files and files smaller than a block are copied as by the embedded BasicCopy.
+type DeltaCopy struct {
+	BasicCopy
+	// BlockSize is the size of the compared blocks, DefaultBlockSize if it is 0.
+	BlockSize int
+
+	literal, matched atomic.Int64
+}
+
+func (c *DeltaCopy) Copy(sourceFile, destinationFile string, symlink bool) error {
+	return c.CopyContext(context.Background(), sourceFile, destinationFile, symlink)
+}
+
+// CopyContext aborts atomic copies when ctx is done. Copies in place always finish so the destinationFile is never left half updated.
+func (c *DeltaCopy) CopyContext(ctx context.Context, sourceFile, destinationFile string, symlink bool) error {
+	destinationInfo, err := c.destinationFS().Lstat(destinationFile)
+	if symlink || err != nil || !destinationInfo.Mode().IsRegular() || destinationInfo.Size() < int64(c.blockSize()) {
+		if err := c.BasicCopy.CopyContext(ctx, sourceFile, destinationFile, symlink); err != nil {
+			return err
+		}
+		if info, err := c.sourceFS().Lstat(sourceFile); err == nil && !symlink {
+			c.literal.Add(info.Size())
+		}
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("copy of %s aborted: %w", sourceFile, err)
+	}
+
+	source, err := c.sourceFS().Open(sourceFile)
+	if err != nil {
+		return fmt.Errorf("cannot open source file %s: %w", sourceFile, err)
+	}
+	defer source.Close()
+
+	sourceInfo, err := source.Stat()
+	if err != nil {
+		return fmt.Errorf("error getting stats for file %s: %w", sourceFile, err)
+	}
+
+	sigs, err := readSignatures(c.destinationFS(), destinationFile, c.blockSize())
+	if err != nil {
+		return err
+	}
+
+	var w *deltaWriter
+	if c.Atomic {
+		old, err := c.destinationFS().Open(destinationFile)
+		if err != nil {
+			return fmt.Errorf("cannot open destination file %s: %w", destinationFile, err)
+		}
+		defer old.Close()
+
+		err = c.writeAtomic(sourceFile, sourceInfo, destinationFile, func(temp File) error {
+			w = &deltaWriter{old: old, out: temp, blockSize: sigs.blockSize}
+			return delta(ctx, source, sigs, w)
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		if w, err = c.updateInPlace(source, sourceInfo, destinationFile, sigs); err != nil {
+			return err
+		}
+	}
+
+	c.literal.Add(w.literal)
+	c.matched.Add(w.matched)
+	return nil
+}
+
+// updateInPlace rewrites the regions of the destinationFile that differ from the source.
+func (c *DeltaCopy) updateInPlace(source File, sourceInfo os.FileInfo, destinationFile string, sigs *signatures) (*deltaWriter, error) {
+	destination, err := c.destinationFS().OpenFile(destinationFile, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open destination file %s: %w", destinationFile, err)
+	}
+
+	w := &deltaWriter{old: destination, out: destination, inPlace: true, blockSize: sigs.blockSize}
+	err = delta(context.Background(), source, sigs, w)
+	if err == nil {
+		if truncErr := destination.Truncate(sourceInfo.Size()); truncErr != nil {
+			err = fmt.Errorf("cannot truncate destination file %s: %w", destinationFile, truncErr)
+		}
+	}
+	if closeErr := destination.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("cannot close destination file %s: %w", destinationFile, closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return w, c.copyMetadata(source.Name(), destinationFile, sourceInfo)
+}
+
+// Stats returns the data written by all the copies since the DeltaCopy was created.
+func (c *DeltaCopy) Stats() DeltaStats {
+	return DeltaStats{LiteralBytes: c.literal.Load(), MatchedBytes: c.matched.Load()}
+}
+
+func (c *DeltaCopy) blockSize() int {
+	if c.BlockSize > 0 {
+		return c.BlockSize
+	}
+	return DefaultBlockSize
+}
+
+// rollingChecksum is the weak checksum of rsync, it is updated in constant time when its window moves by one byte.
+type rollingChecksum struct {
+	a, b, n uint32
+}
+
+func newRollingChecksum(window []byte) rollingChecksum {
+	r := rollingChecksum{n: uint32(len(window))}
+	for i, x := range window {
+		r.a += uint32(x)
+		r.b += (r.n - uint32(i)) * uint32(x)
+	}
+	return r
+}
+
+func (r *rollingChecksum) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+// roll moves the window by one byte: out leaves the window and in enters it.
+func (r *rollingChecksum) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+// blockSignature identifies a block of the destination file, the last block may be shorter than the others.
+type blockSignature struct {
+	index  int
+	length int
+	strong [sha256.Size]byte
+}
+
+// signatures indexes the blocks of a destination file by weak checksum.
+type signatures struct {
+	blockSize int
+	blocks    map[uint32][]blockSignature
+}
+
+func readSignatures(fsys FS, name string, blockSize int) (*signatures, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open destination file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	sigs := &signatures{blockSize: blockSize, blocks: make(map[uint32][]blockSignature)}
+	buf := make([]byte, blockSize)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			sum := newRollingChecksum(buf[:n])
+			sigs.blocks[sum.sum()] = append(sigs.blocks[sum.sum()], blockSignature{index: index, length: n, strong: sha256.Sum256(buf[:n])})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sigs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read destination file %s: %w", name, err)
+		}
+	}
+}
+
+// match returns the index of a block of the destination identical to window that the writer can still read.
+// The block already at the offset of the window is preferred since a copy in place doesn't write it.
+func (s *signatures) match(weak uint32, window []byte, w *deltaWriter, offset int64) (int, bool) {
+	candidates := s.blocks[weak]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+
+	strong := sha256.Sum256(window)
+	found := -1
+	for _, b := range candidates {
+		start := int64(b.index) * int64(s.blockSize)
+		if b.length != len(window) || b.strong != strong || (w.inPlace && start < offset) {
+			continue
+		}
+		if start == offset {
+			return b.index, true
+		}
+		if found < 0 {
+			found = b.index
+		}
+	}
+	return found, found >= 0
+}
+
+// deltaWriter writes the new content of a destination file from literal data and blocks of the old file.
+type deltaWriter struct {
+	old, out  File
+	inPlace   bool
+	blockSize int
+	// offset is the size of the content written so far. In place, the blocks of the old file before offset are overwritten.
+	offset           int64
+	literal, matched int64
+}
+
+func (w *deltaWriter) writeLiteral(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if _, err := w.out.WriteAt(data, w.offset); err != nil {
+		return fmt.Errorf("cannot write in file %s: %w", w.out.Name(), err)
+	}
+	w.offset += int64(len(data))
+	w.literal += int64(len(data))
+	return nil
+}
+
+func (w *deltaWriter) writeBlock(index, length int, buf []byte) error {
+	start := int64(index) * int64(w.blockSize)
+	if !w.inPlace || start != w.offset {
+		if _, err := w.old.ReadAt(buf[:length], start); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("cannot read from file %s: %w", w.old.Name(), err)
+		}
+		if _, err := w.out.WriteAt(buf[:length], w.offset); err != nil {
+			return fmt.Errorf("cannot write in file %s: %w", w.out.Name(), err)
+		}
+	}
+	w.offset += int64(length)
+	w.matched += int64(length)
+	return nil
+}
+
+// delta scans the source for the blocks of the signatures and writes the new content with w.
+func delta(ctx context.Context, source io.Reader, sigs *signatures, w *deltaWriter) error {
+	blockSize := sigs.blockSize
+	buf := make([]byte, 0, 4*blockSize)
+	blockBuf := make([]byte, blockSize)
+	// start is the start of the window in buf, the data between lit and start is literal
+	start, lit := 0, 0
+	eof := false
+	var sum rollingChecksum
+	rolling := false
+
+	for {
+		if len(buf)-start < blockSize && !eof {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("copy aborted: %w", err)
+			}
+			if err := w.writeLiteral(buf[lit:start]); err != nil {
+				return err
+			}
+			buf = buf[:copy(buf, buf[start:])]
+			start, lit = 0, 0
+
+			n, err := io.ReadFull(source, buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return fmt.Errorf("cannot read source file: %w", err)
+			}
+		}
+
+		end := start + blockSize
+		if end > len(buf) {
+			end = len(buf)
+		}
+		window := buf[start:end]
+		if len(window) == 0 {
+			break
+		}
+		if !rolling || len(window) < blockSize {
+			sum = newRollingChecksum(window)
+			rolling = true
+		}
+
+		if index, ok := sigs.match(sum.sum(), window, w, w.offset+int64(start-lit)); ok {
+			if err := w.writeLiteral(buf[lit:start]); err != nil {
+				return err
+			}
+			if err := w.writeBlock(index, len(window), blockBuf); err != nil {
+				return err
+			}
+			start = end
+			lit = start
+			rolling = false
+			continue
+		}
+		if len(window) < blockSize {
+			// the tail shorter than a block matches nothing
+			break
+		}
+
+		if end < len(buf) {
+			sum.roll(buf[start], buf[end])
+		} else {
+			rolling = false
+		}
+		start++
+		if start-lit >= blockSize {
+			if err := w.writeLiteral(buf[lit:start]); err != nil {
+				return err
+			}
+			lit = start
+		}
+	}
+	return w.writeLiteral(buf[lit:])
+}
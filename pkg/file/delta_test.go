@@ -0,0 +1,99 @@
+package file
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_rollingChecksum_roll(t *testing.T) {
+	data := make([]byte, 200)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	const window = 64
+	sum := newRollingChecksum(data[:window])
+	for start := 1; start+window <= len(data); start++ {
+		sum.roll(data[start-1], data[start+window-1])
+		want := newRollingChecksum(data[start : start+window])
+		if sum.sum() != want.sum() {
+			t.Fatalf("roll() at %d = %x, want %x", start, sum.sum(), want.sum())
+		}
+	}
+}
+
+func TestDeltaCopy_Copy(t *testing.T) {
+	const blockSize = 1024
+	old := make([]byte, 20*blockSize+100)
+	rand.New(rand.NewSource(2)).Read(old)
+
+	// the new content modifies a block, inserts data, deletes data and appends data
+	modified := append([]byte{}, old...)
+	copy(modified[3*blockSize+10:], []byte("modified"))
+	inserted := append(append(append([]byte{}, modified[:8*blockSize+7]...), bytes.Repeat([]byte("i"), 300)...), modified[8*blockSize+7:]...)
+	deleted := append(append([]byte{}, inserted[:14*blockSize]...), inserted[15*blockSize+50:]...)
+	content := append(deleted, bytes.Repeat([]byte("a"), 2000)...)
+
+	tests := []struct {
+		name        string
+		atomic      bool
+		wantMatched int64
+	}{
+		// the 17 unchanged blocks are matched
+		{"atomic", true, 16 * blockSize},
+		// in place, the blocks shifted by the insertion cannot be read once overwritten
+		{"in place", false, 8 * blockSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source, destination := path.Join(dir, "source"), path.Join(dir, "destination")
+			if err := os.WriteFile(source, content, 0644); err != nil {
+				t.Fatalf("cannot create file for test: %v", err)
+			}
+			if err := os.WriteFile(destination, old, 0644); err != nil {
+				t.Fatalf("cannot create file for test: %v", err)
+			}
+
+			c := &DeltaCopy{BasicCopy: BasicCopy{Atomic: tt.atomic}, BlockSize: blockSize}
+			if err := c.Copy(source, destination, false); err != nil {
+				t.Fatalf("Copy() unexpected error: %v", err)
+			}
+
+			got, err := os.ReadFile(destination)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Fatalf("Copy() destination differs from the source")
+			}
+			stats := c.Stats()
+			if stats.LiteralBytes+stats.MatchedBytes != int64(len(content)) {
+				t.Errorf("Stats() = %+v, want a total of %d bytes", stats, len(content))
+			}
+			if stats.MatchedBytes < tt.wantMatched {
+				t.Errorf("Stats() = %+v, want the unchanged blocks matched", stats)
+			}
+		})
+	}
+}
+
+func TestDeltaCopy_CopyNewFile(t *testing.T) {
+	dir := t.TempDir()
+	source, destination := path.Join(dir, "source"), path.Join(dir, "destination")
+	if err := os.WriteFile(source, []byte("new file"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+
+	c := &DeltaCopy{BasicCopy: BasicCopy{Atomic: true}}
+	if err := c.Copy(source, destination, false); err != nil {
+		t.Fatalf("Copy() unexpected error: %v", err)
+	}
+	if got, err := os.ReadFile(destination); err != nil || string(got) != "new file" {
+		t.Errorf("Copy() destination = %q, %v", got, err)
+	}
+	if stats := c.Stats(); stats.LiteralBytes != 8 || stats.MatchedBytes != 0 {
+		t.Errorf("Stats() = %+v, want 8 literal bytes", stats)
+	}
+}
@@ -0,0 +1,185 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// DefaultFastBufferSize is the size of the buffer of the BufferedCopy method of a FastCopy unless configured otherwise.
+const DefaultFastBufferSize = 1024 * 1024
+
+// CopyMethod is the way a FastCopy copies the content of the files.
+type CopyMethod int
+
+const (
+	// AutoCopy chooses the method per destination file system: a reflink on the file systems that support it,
+	// copy_file_range otherwise.
+	AutoCopy = CopyMethod(iota)
+	// Reflink clones the source file with the FICLONE ioctl, the files share their blocks until they are modified.
+	// It is supported by btrfs and XFS when both files are on the same file system.
+	Reflink
+	// CopyFileRange copies the content in the kernel with copy_file_range, which the file system may offload.
+	CopyFileRange
+	// Sendfile copies the content in the kernel with sendfile.
+	Sendfile
+	// BufferedCopy reads and writes the content through a large buffer.
+	BufferedCopy
+)
+
+// copyMethods are the methods in the order a FastCopy falls back through them.
+var copyMethods = []CopyMethod{Reflink, CopyFileRange, Sendfile, BufferedCopy}
+
+// ParseCopyMethod parses the name of a copy method: auto, reflink, copy-file-range, sendfile or buffered.
+func ParseCopyMethod(name string) (CopyMethod, error) {
+	for _, m := range append([]CopyMethod{AutoCopy}, copyMethods...) {
+		if m.String() == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown copy method %q", name)
+}
+
+func (m CopyMethod) String() string {
+	switch m {
+	case AutoCopy:
+		return "auto"
+	case Reflink:
+		return "reflink"
+	case CopyFileRange:
+		return "copy-file-range"
+	case Sendfile:
+		return "sendfile"
+	case BufferedCopy:
+		return "buffered"
+	default:
+		return fmt.Sprintf("unknown method %d", int(m))
+	}
+}
+
+// errMethodUnsupported is the error of a copy method that the platform, the kernel or the file systems don't support.
+var errMethodUnsupported = errors.New("copy method not supported")
+
+// FastCopy is a Copier that copies the content of the files in the kernel when it can. It starts with its Method
+// and falls back to the next ones, in the order reflink, copy_file_range, sendfile and buffered copy, when a method
+// is not supported, the kernel methods only copy between files of the local disk. The holes of sparse files are kept
+// by every method but the reflink clones the whole file. With Sparse, the automatic choice skips copy_file_range and sendfile,
+// which cannot skip the blocks of zeros. Symlinks are copied as by the embedded BasicCopy.
+type FastCopy struct {
+	BasicCopy
+	Method CopyMethod
+	// BufferSize is the size of the buffer of the BufferedCopy method, DefaultFastBufferSize if it is 0.
+	BufferSize int
+
+	copies [BufferedCopy + 1]atomic.Int64
+}
+
+func (c *FastCopy) Copy(sourceFile, destinationFile string, symlink bool) error {
+	return c.CopyContext(context.Background(), sourceFile, destinationFile, symlink)
+}
+
+// CopyContext aborts atomic copies when ctx is done. Copies in place always finish so the destinationFile is never truncated.
+func (c *FastCopy) CopyContext(ctx context.Context, sourceFile, destinationFile string, symlink bool) error {
+	if symlink {
+		return c.BasicCopy.CopyContext(ctx, sourceFile, destinationFile, symlink)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("copy of %s aborted: %w", sourceFile, err)
+	}
+	return c.copyFile(ctx, sourceFile, destinationFile, c.copyContent)
+}
+
+// Copies returns the number of files copied with the method m since the FastCopy was created.
+func (c *FastCopy) Copies(m CopyMethod) int64 {
+	if m < 0 || int(m) >= len(c.copies) {
+		return 0
+	}
+	return c.copies[m].Load()
+}
+
+// copyContent copies the content of source with the first method the destination supports.
+func (c *FastCopy) copyContent(ctx context.Context, source, destination File) error {
+	var err error
+	for _, m := range c.methods(destination) {
+		if err = c.copyWith(ctx, m, source, destination); !errors.Is(err, errMethodUnsupported) {
+			if err == nil {
+				c.copies[m].Add(1)
+			}
+			return err
+		}
+		// the next method starts over
+		if err := destination.Truncate(0); err != nil {
+			return fmt.Errorf("cannot truncate file %s: %w", destination.Name(), err)
+		}
+	}
+	return err
+}
+
+// methods returns the methods tried in order to copy to destination.
+func (c *FastCopy) methods(destination File) []CopyMethod {
+	if c.Method != AutoCopy {
+		for i, m := range copyMethods {
+			if m == c.Method {
+				return copyMethods[i:]
+			}
+		}
+		return copyMethods[len(copyMethods)-1:]
+	}
+
+	methods := make([]CopyMethod, 0, len(copyMethods))
+	if f, ok := destination.(*os.File); ok && supportsReflink(f) {
+		methods = append(methods, Reflink)
+	}
+	if !c.Sparse {
+		methods = append(methods, CopyFileRange, Sendfile)
+	}
+	return append(methods, BufferedCopy)
+}
+
+func (c *FastCopy) copyWith(ctx context.Context, m CopyMethod, source, destination File) error {
+	switch m {
+	case Reflink:
+		s, d, ok := osFiles(source, destination)
+		if !ok {
+			return fmt.Errorf("reflink: %w", errMethodUnsupported)
+		}
+		return reflink(s, d)
+	case CopyFileRange:
+		return copyRegions(ctx, source, destination, kernelRegion("copy_file_range", copyFileRangeRegion))
+	case Sendfile:
+		return copyRegions(ctx, source, destination, kernelRegion("sendfile", sendfileRegion))
+	default:
+		return copyRegions(ctx, source, destination, bufferedRegion(c.bufferSize(), c.Sparse))
+	}
+}
+
+// osFiles returns source and destination as files of the local disk, ok is false if one of them is on another FS.
+func osFiles(source, destination File) (s, d *os.File, ok bool) {
+	s, ok = source.(*os.File)
+	if !ok {
+		return nil, nil, false
+	}
+	d, ok = destination.(*os.File)
+	return s, d, ok
+}
+
+// kernelRegion returns a regionCopier calling copyRegion, a system call named name that copies between files
+// of the local disk. It is not supported out of the local disk.
+func kernelRegion(name string, copyRegion func(ctx context.Context, source, destination *os.File, start, end int64) (int64, error)) regionCopier {
+	return func(ctx context.Context, source, destination File, start, end int64) (int64, error) {
+		s, d, ok := osFiles(source, destination)
+		if !ok {
+			return 0, fmt.Errorf("%s: %w", name, errMethodUnsupported)
+		}
+		return copyRegion(ctx, s, d, start, end)
+	}
+}
+
+func (c *FastCopy) bufferSize() int {
+	if c.BufferSize > 0 {
+		return c.BufferSize
+	}
+	return DefaultFastBufferSize
+}
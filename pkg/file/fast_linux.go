@@ -0,0 +1,102 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernelChunkSize is the number of bytes copied by a system call between the checks of the context.
+const kernelChunkSize = 16 * 1024 * 1024
+
+// supportsReflink returns true if the file f is on a file system that supports reflinks.
+func supportsReflink(f *os.File) bool {
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(int(f.Fd()), &st); err != nil {
+		return false
+	}
+	return uint32(st.Type) == unix.BTRFS_SUPER_MAGIC || uint32(st.Type) == unix.XFS_SUPER_MAGIC
+}
+
+// unsupported wraps the error of a system call with errMethodUnsupported when the kernel or the file systems
+// don't support it.
+func unsupported(op string, errno syscall.Errno) error {
+	switch errno {
+	case syscall.ENOSYS, syscall.EXDEV, syscall.EOPNOTSUPP, syscall.EINVAL, syscall.ENOTTY:
+		return fmt.Errorf("%s: %w: %w", op, errMethodUnsupported, errno)
+	default:
+		return fmt.Errorf("%s: %w", op, errno)
+	}
+}
+
+// reflink clones source into destination.
+func reflink(source, destination *os.File) error {
+	err := unix.IoctlFileClone(int(destination.Fd()), int(source.Fd()))
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return unsupported("cannot clone "+source.Name(), errno)
+	}
+	return err
+}
+
+// copyFileRangeRegion is a regionCopier calling copy_file_range.
+func copyFileRangeRegion(ctx context.Context, source, destination *os.File, start, end int64) (int64, error) {
+	offset := start
+	for end < 0 || offset < end {
+		if err := ctx.Err(); err != nil {
+			return 0, fmt.Errorf("copy of %s aborted: %w", source.Name(), err)
+		}
+		in, out := offset, offset
+		n, err := unix.CopyFileRange(int(source.Fd()), &in, int(destination.Fd()), &out, int(chunk(offset, end)), 0)
+		var errno syscall.Errno
+		if errors.As(err, &errno) {
+			return 0, unsupported("cannot copy "+source.Name(), errno)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			break
+		}
+		offset += int64(n)
+	}
+	return offset, nil
+}
+
+// sendfileRegion is a regionCopier calling sendfile.
+func sendfileRegion(ctx context.Context, source, destination *os.File, start, end int64) (int64, error) {
+	if _, err := destination.Seek(start, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("cannot seek file %s: %w", destination.Name(), err)
+	}
+	offset := start
+	for end < 0 || offset < end {
+		if err := ctx.Err(); err != nil {
+			return 0, fmt.Errorf("copy of %s aborted: %w", source.Name(), err)
+		}
+		n, err := syscall.Sendfile(int(destination.Fd()), int(source.Fd()), &offset, int(chunk(offset, end)))
+		var errno syscall.Errno
+		if errors.As(err, &errno) {
+			return 0, unsupported("cannot copy "+source.Name(), errno)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return offset, nil
+}
+
+// chunk returns the number of bytes to copy from offset by a system call.
+func chunk(offset, end int64) int64 {
+	if end >= 0 && end-offset < kernelChunkSize {
+		return end - offset
+	}
+	return kernelChunkSize
+}
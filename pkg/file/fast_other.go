@@ -0,0 +1,29 @@
+//go:build !linux
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// supportsReflink returns true if the file f is on a file system that supports reflinks, they are not supported on this platform.
+func supportsReflink(*os.File) bool {
+	return false
+}
+
+// reflink clones source into destination, it is not supported on this platform.
+func reflink(*os.File, *os.File) error {
+	return fmt.Errorf("reflink: %w", errMethodUnsupported)
+}
+
+// copyFileRangeRegion is a regionCopier calling copy_file_range, it is not supported on this platform.
+func copyFileRangeRegion(context.Context, *os.File, *os.File, int64, int64) (int64, error) {
+	return 0, fmt.Errorf("copy_file_range: %w", errMethodUnsupported)
+}
+
+// sendfileRegion is a regionCopier calling sendfile, it is not supported on this platform.
+func sendfileRegion(context.Context, *os.File, *os.File, int64, int64) (int64, error) {
+	return 0, fmt.Errorf("sendfile: %w", errMethodUnsupported)
+}
@@ -0,0 +1,137 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+// writeSparseFile writes content in the file name of dir, the blocks of zeros of size blockSize are left as holes.
+func writeSparseFile(tb testing.TB, dir, name string, content []byte, blockSize int) string {
+	tb.Helper()
+	name = path.Join(dir, name)
+	f, err := os.Create(name)
+	if err != nil {
+		tb.Fatalf("cannot create file for test: %v", err)
+	}
+	defer f.Close()
+	for offset := 0; offset < len(content); offset += blockSize {
+		end := offset + blockSize
+		if end > len(content) {
+			end = len(content)
+		}
+		block := content[offset:end]
+		if isZero(block) {
+			continue
+		}
+		if _, err := f.WriteAt(block, int64(offset)); err != nil {
+			tb.Fatalf("cannot write file for test: %v", err)
+		}
+	}
+	if err := f.Truncate(int64(len(content))); err != nil {
+		tb.Fatalf("cannot write file for test: %v", err)
+	}
+	return name
+}
+
+func TestFastCopy_Copy(t *testing.T) {
+	const blockSize = 64 * 1024
+	content := make([]byte, 40*blockSize+123)
+	rng := rand.New(rand.NewSource(7))
+	// data, a hole, data and a trailing hole
+	rng.Read(content[:10*blockSize])
+	rng.Read(content[20*blockSize : 30*blockSize])
+
+	for _, method := range []CopyMethod{AutoCopy, Reflink, CopyFileRange, Sendfile, BufferedCopy} {
+		for _, atomic := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s, atomic %v", method, atomic), func(t *testing.T) {
+				dir := t.TempDir()
+				source := writeSparseFile(t, dir, "source", content, blockSize)
+				destination := path.Join(dir, "destination")
+				if err := os.WriteFile(destination, []byte("previous content"), 0644); err != nil {
+					t.Fatalf("cannot create file for test: %v", err)
+				}
+
+				c := &FastCopy{BasicCopy: BasicCopy{Preserve: DefaultAttributes, Atomic: atomic}, Method: method, BufferSize: 10000}
+				if err := c.Copy(source, destination, false); err != nil {
+					t.Fatalf("Copy() unexpected error: %v", err)
+				}
+				got, err := os.ReadFile(destination)
+				if err != nil || !bytes.Equal(got, content) {
+					t.Fatalf("Copy() destination differs from the source, error = %v", err)
+				}
+
+				// the copy is done by the method or one it falls back to
+				copies := int64(0)
+				for _, m := range copyMethods {
+					if m < method {
+						if c.Copies(m) != 0 {
+							t.Errorf("Copies(%s) = %d, want 0", m, c.Copies(m))
+						}
+						continue
+					}
+					copies += c.Copies(m)
+				}
+				if copies != 1 {
+					t.Errorf("Copy() counted %d copies, want 1", copies)
+				}
+
+				info, _ := os.Stat(destination)
+				sourceInfo, _ := os.Stat(source)
+				allocated, ok := AllocatedSize(info)
+				sourceAllocated, _ := AllocatedSize(sourceInfo)
+				if ok && sourceAllocated < int64(len(content)) && allocated > sourceAllocated+blockSize {
+					t.Errorf("Copy() destination allocated %d bytes, want about %d", allocated, sourceAllocated)
+				}
+			})
+		}
+	}
+}
+
+func TestParseCopyMethod(t *testing.T) {
+	for _, m := range []CopyMethod{AutoCopy, Reflink, CopyFileRange, Sendfile, BufferedCopy} {
+		got, err := ParseCopyMethod(m.String())
+		if err != nil || got != m {
+			t.Errorf("ParseCopyMethod(%q) = %v, %v, want %v", m.String(), got, err, m)
+		}
+	}
+	if _, err := ParseCopyMethod("splice"); err == nil {
+		t.Errorf("ParseCopyMethod() expected an error for an unknown method")
+	}
+}
+
+func BenchmarkCopy(b *testing.B) {
+	const size = 64 * 1024 * 1024
+	dir := b.TempDir()
+	content := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(content)
+	source := path.Join(dir, "source")
+	if err := os.WriteFile(source, content, 0644); err != nil {
+		b.Fatalf("cannot create file for benchmark: %v", err)
+	}
+	destination := path.Join(dir, "destination")
+
+	copiers := []struct {
+		name string
+		c    Copier
+	}{
+		{"basic", &BasicCopy{Atomic: true}},
+		{"buffered", &FastCopy{BasicCopy: BasicCopy{Atomic: true}, Method: BufferedCopy}},
+		{"sendfile", &FastCopy{BasicCopy: BasicCopy{Atomic: true}, Method: Sendfile}},
+		{"copy-file-range", &FastCopy{BasicCopy: BasicCopy{Atomic: true}, Method: CopyFileRange}},
+		{"auto", &FastCopy{BasicCopy: BasicCopy{Atomic: true}}},
+	}
+	for _, cp := range copiers {
+		b.Run(cp.name, func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				if err := cp.c.Copy(source, destination, false); err != nil {
+					b.Fatalf("Copy() unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -1,80 +1,266 @@
 package file
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const bufferSize = 4096
 
+const (
+	// TempFilePrefix is the prefix of the temporary files written by an atomic copy.
+	TempFilePrefix = ".gosync-"
+	tempFileSuffix = ".tmp"
+	// defaultFileMode is the mode of the temporary files when the mode is not preserved.
+	defaultFileMode = 0644
+)
+
+// TempFilePattern returns the os.CreateTemp pattern of the temporary files written in place of the file name.
+func TempFilePattern(name string) string {
+	return TempFilePrefix + name + "-*" + tempFileSuffix
+}
+
+// tempFileName returns the name of the temporary file tagged tag written in place of the file name.
+func tempFileName(name, tag string) string {
+	return filepath.Join(filepath.Dir(name), TempFilePrefix+filepath.Base(name)+"-"+tag+tempFileSuffix)
+}
+
+// IsTempFile returns true if name is the name of a temporary file written by an atomic copy.
+// Such a file left at the destination is the trace of an interrupted copy.
+func IsTempFile(name string) bool {
+	return strings.HasPrefix(name, TempFilePrefix) && strings.HasSuffix(name, tempFileSuffix)
+}
+
 type Copier interface {
 	//Copy copies a sourceFile to the destinationFile. If the parent folder doesn't exist it will be created.
 	Copy(sourceFile, destinationFile string, symlink bool) error
 }
 
-type BasicCopy struct{}
+// ContextCopier is a Copier whose copies can be aborted.
+type ContextCopier interface {
+	Copier
+	//CopyContext copies a sourceFile to the destinationFile like Copy. When ctx is done, a copy in progress either
+	//finishes or is aborted, leaving the destinationFile untouched, and the error wraps ctx.Err().
+	CopyContext(ctx context.Context, sourceFile, destinationFile string, symlink bool) error
+}
+
+type BasicCopy struct {
+	// Preserve is the set of attributes of the source copied to the destination file
+	// and to the parent folder when it is created.
+	Preserve Attributes
+	// Atomic writes the content in a temporary file of the destination folder that is synced to the disk
+	// and renamed over the destinationFile, so the destinationFile is never seen partially written.
+	Atomic bool
+	// Sparse skips the blocks of zeros when writing, so they become holes of the destinationFile
+	// even if they are written in the sourceFile. The holes of the sourceFile are always kept.
+	Sparse bool
+	// Source and Destination are the file systems of the sourceFile and of the destinationFile, the local disk if nil.
+	// The holes of the sparse files are only detected on the local disk.
+	Source, Destination FS
+}
+
+func (c *BasicCopy) sourceFS() FS {
+	if c.Source == nil {
+		return OSFS{}
+	}
+	return c.Source
+}
+
+func (c *BasicCopy) destinationFS() FS {
+	if c.Destination == nil {
+		return OSFS{}
+	}
+	return c.Destination
+}
+
+func (c *BasicCopy) Copy(sourceFile, destinationFile string, symlink bool) error {
+	return c.CopyContext(context.Background(), sourceFile, destinationFile, symlink)
+}
 
-func (*BasicCopy) Copy(sourceFile, destinationFile string, symlink bool) error {
+// CopyContext aborts atomic copies when ctx is done. Copies in place always finish so the destinationFile is never truncated.
+func (c *BasicCopy) CopyContext(ctx context.Context, sourceFile, destinationFile string, symlink bool) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("copy of %s aborted: %w", sourceFile, err)
+	}
 	if symlink {
-		return copySymlink(sourceFile, destinationFile)
+		return c.copySymlink(sourceFile, destinationFile)
 	}
+	return c.copyFile(ctx, sourceFile, destinationFile, c.copyContent)
+}
 
-	source, err := os.Open(sourceFile)
+// contentCopier copies the content of source to the empty destination.
+type contentCopier func(ctx context.Context, source, destination File) error
+
+func (c *BasicCopy) copyContent(ctx context.Context, source, destination File) error {
+	return copyContent(ctx, source, destination, c.Sparse)
+}
+
+// copyFile copies the sourceFile to the destinationFile, its content is copied by content.
+func (c *BasicCopy) copyFile(ctx context.Context, sourceFile, destinationFile string, content contentCopier) error {
+	// opening a named pipe would block until a writer opens it
+	if info, err := c.sourceFS().Stat(sourceFile); err == nil && IsSpecial(info.Mode()) {
+		return fmt.Errorf("cannot copy %s: %w", sourceFile, ErrSpecialFile)
+	}
+
+	source, err := c.sourceFS().Open(sourceFile)
 	if err != nil {
 		return fmt.Errorf("cannot open source file %s: %w", sourceFile, err)
 	}
 	defer source.Close()
 
+	sourceInfo, err := source.Stat()
+	if err != nil {
+		return fmt.Errorf("error getting stats for file %s: %w", sourceFile, err)
+	}
+
 	destinationDir := filepath.Dir(destinationFile)
-	_, err = os.Stat(destinationDir)
+	createdDir, err := c.createParent(filepath.Dir(sourceFile), destinationDir)
 	if err != nil {
-		if os.IsNotExist(err) {
-			srcDir := filepath.Dir(sourceFile)
-			dirStat, err := os.Stat(srcDir)
-			err = os.MkdirAll(destinationDir, dirStat.Mode())
-			if err != nil {
-				return fmt.Errorf("error creating directory %s: %w", destinationDir, err)
-			}
-		} else {
-			return fmt.Errorf("error getting stats for directory %s: %w", destinationDir, err)
-		}
+		return err
+	}
+
+	if c.Atomic {
+		err = c.writeAtomic(sourceFile, sourceInfo, destinationFile, func(temp File) error {
+			return content(ctx, source, temp)
+		})
+	} else {
+		err = c.write(source, sourceInfo, destinationFile, content)
+	}
+	if err != nil {
+		return err
+	}
+
+	if createdDir != nil {
+		return c.copyMetadata(filepath.Dir(sourceFile), destinationDir, createdDir)
 	}
+	return nil
+}
+
+// copyMetadata applies the preserved attributes of the sourceFile, described by info, to the destination entry.
+func (c *BasicCopy) copyMetadata(sourceFile, destination string, info os.FileInfo) error {
+	return CopyMetadataFS(c.sourceFS(), sourceFile, c.destinationFS(), destination, info, c.Preserve)
+}
+
+// createParent creates the destinationDir if it doesn't exist and returns the stats of the sourceDir it was created from.
+// The returned stats are nil if the destinationDir already exists.
+func (c *BasicCopy) createParent(sourceDir, destinationDir string) (os.FileInfo, error) {
+	_, err := c.destinationFS().Stat(destinationDir)
+	if err == nil {
+		return nil, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error getting stats for directory %s: %w", destinationDir, err)
+	}
+
+	dirStat, err := c.sourceFS().Stat(sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("error getting stats for directory %s: %w", sourceDir, err)
+	}
+	err = c.destinationFS().MkdirAll(destinationDir, dirStat.Mode().Perm()|0700)
+	if err != nil {
+		return nil, fmt.Errorf("error creating directory %s: %w", destinationDir, err)
+	}
+	return dirStat, nil
+}
 
-	destination, err := os.Create(destinationFile)
+// write copies the content of source directly in the destinationFile with content.
+func (c *BasicCopy) write(source File, sourceInfo os.FileInfo, destinationFile string, content contentCopier) error {
+	destination, err := c.destinationFS().OpenFile(destinationFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return fmt.Errorf("cannot create destination file %s: %w", destinationFile, err)
 	}
 
-	defer destination.Close()
+	err = content(context.Background(), source, destination)
+	if closeErr := destination.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("cannot close destination file %s: %w", destinationFile, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.copyMetadata(source.Name(), destinationFile, sourceInfo)
+}
 
-	buf := make([]byte, bufferSize)
-	for {
-		n, err := source.Read(buf)
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("cannot read from buffer for file %s: %w", sourceFile, err)
+// writeAtomic writes the content of the destinationFile with fill in a temporary file renamed over the destinationFile.
+// The temporary file is removed if any step fails.
+func (c *BasicCopy) writeAtomic(sourceFile string, sourceInfo os.FileInfo, destinationFile string, fill func(temp File) error) (err error) {
+	temp, err := CreateTemp(c.destinationFS(), filepath.Dir(destinationFile), TempFilePattern(filepath.Base(destinationFile)))
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file for %s: %w", destinationFile, err)
+	}
+	defer func() {
+		if err != nil {
+			c.destinationFS().Remove(temp.Name())
 		}
-		if n == 0 {
-			break
+	}()
+
+	err = fill(temp)
+	if err == nil {
+		if syncErr := temp.Sync(); syncErr != nil {
+			err = fmt.Errorf("cannot sync temporary file %s: %w", temp.Name(), syncErr)
 		}
+	}
+	if closeErr := temp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("cannot close temporary file %s: %w", temp.Name(), closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	return c.replace(temp.Name(), sourceFile, sourceInfo, destinationFile)
+}
 
-		if _, err := destination.Write(buf[:n]); err != nil {
-			return fmt.Errorf("cannot write in buffer for file %s: %w", destinationFile, err)
+// replace applies the attributes of the sourceFile to the written temporary file and renames it over the destinationFile.
+func (c *BasicCopy) replace(temp, sourceFile string, sourceInfo os.FileInfo, destinationFile string) error {
+	if !c.Preserve.Has(Mode) {
+		if err := c.destinationFS().Chmod(temp, defaultFileMode); err != nil {
+			return fmt.Errorf("cannot change mode of %s: %w", temp, err)
 		}
 	}
+	if err := c.copyMetadata(sourceFile, temp, sourceInfo); err != nil {
+		return err
+	}
+
+	if err := c.destinationFS().Rename(temp, destinationFile); err != nil {
+		return fmt.Errorf("cannot rename temporary file %s to %s: %w", temp, destinationFile, err)
+	}
 	return nil
 }
 
-func copySymlink(source, dest string) error {
-	link, err := os.Readlink(source)
+func (c *BasicCopy) copySymlink(source, dest string) error {
+	link, err := c.sourceFS().Readlink(source)
 	if err != nil {
 		return fmt.Errorf("cannot read symlink %s: %w", source, err)
 	}
-	err = os.Symlink(link, dest)
+	return SymlinkFS(c.sourceFS(), source, link, c.destinationFS(), dest, c.Preserve)
+}
+
+// Symlink replaces the destinationLink with a symlink to target, the owner and the extended attributes
+// of the sourceLink are kept if preserve has them.
+func Symlink(sourceLink, target, destinationLink string, preserve Attributes) error {
+	return SymlinkFS(OSFS{}, sourceLink, target, OSFS{}, destinationLink, preserve)
+}
+
+// SymlinkFS replaces the destinationLink of destinationFS with a symlink to target like Symlink,
+// the sourceLink is an entry of sourceFS.
+func SymlinkFS(sourceFS FS, sourceLink, target string, destinationFS FS, destinationLink string, preserve Attributes) error {
+	err := destinationFS.Remove(destinationLink)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot replace symlink %s: %w", destinationLink, err)
+	}
+	err = destinationFS.Symlink(target, destinationLink)
 	if err != nil {
-		return fmt.Errorf("cannot create symlink %s: %w", dest, err)
+		return fmt.Errorf("cannot create symlink %s: %w", destinationLink, err)
 	}
 
+	if preserve&(Owner|ExtendedAttributes) != 0 {
+		info, err := sourceFS.Lstat(sourceLink)
+		if err != nil {
+			return fmt.Errorf("error getting stats for symlink %s: %w", sourceLink, err)
+		}
+		return CopyMetadataFS(sourceFS, sourceLink, destinationFS, destinationLink, info, preserve&(Owner|ExtendedAttributes))
+	}
 	return nil
 }
@@ -1,6 +1,8 @@
 package file
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path"
 	"testing"
@@ -48,3 +50,112 @@ func TestBasicCopy_Copy(t *testing.T) {
 		})
 	}
 }
+
+func TestBasicCopy_CopyAtomic(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "")
+	if err != nil {
+		t.Fatal("cannot create temp dir for test")
+	}
+	defer os.RemoveAll(dir)
+
+	destination := path.Join(dir, "file_a")
+	if err := os.WriteFile(destination, []byte("previous content that is longer"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+
+	ba := BasicCopy{Atomic: true}
+	if err := ba.Copy("../../tests/source_folder_a/file_a", destination, false); err != nil {
+		t.Fatalf("Copy() unexpected error = %v", err)
+	}
+
+	want, err := os.ReadFile("../../tests/source_folder_a/file_a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(destination)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("Copy() content = %q, want %q", got, want)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Copy() left %v entries in the destination folder, want 1", len(entries))
+	}
+}
+
+func TestIsTempFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{".gosync-file_a-1234.tmp", true},
+		{".gosync-file_a", false},
+		{"file_a.tmp", false},
+		{"file_a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTempFile(tt.name); got != tt.want {
+				t.Errorf("IsTempFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicCopy_CopyContextCanceled(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "")
+	if err != nil {
+		t.Fatal("cannot create temp dir for test")
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	destination := path.Join(dir, "file_a")
+	ba := BasicCopy{Atomic: true}
+	err = ba.CopyContext(ctx, "../../tests/source_folder_a/file_a", destination, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CopyContext() error = %v, want context.Canceled", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("CopyContext() left %v entries in the destination folder, want 0", len(entries))
+	}
+}
+
+func TestLink(t *testing.T) {
+	dir := t.TempDir()
+	target, destination := path.Join(dir, "target"), path.Join(dir, "destination")
+	for name, content := range map[string]string{target: "target", destination: "destination"} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("cannot create file for test: %v", err)
+		}
+	}
+
+	// linking twice leaves no temporary link
+	for i := 0; i < 2; i++ {
+		if err := Link(target, destination); err != nil {
+			t.Fatalf("Link() unexpected error: %v", err)
+		}
+	}
+	targetInfo, _ := os.Stat(target)
+	destinationInfo, _ := os.Stat(destination)
+	if !os.SameFile(targetInfo, destinationInfo) {
+		t.Errorf("Link() destination is not a link to the target")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("Link() left %d entries, want 2", len(entries))
+	}
+}
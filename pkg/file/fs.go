@@ -0,0 +1,241 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FS is a file system synchronized from or to. The paths are the ones of the synchronized folders joined with slashes.
+type FS interface {
+	//ReadDir returns the entries of the directory name sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+	//Stat returns the stats of the entry name, symlinks are followed.
+	Stat(name string) (fs.FileInfo, error)
+	//Lstat returns the stats of the entry name, symlinks are not followed.
+	Lstat(name string) (fs.FileInfo, error)
+	//Open opens the file name for reading.
+	Open(name string) (File, error)
+	//OpenFile opens the file name with the flags of os.OpenFile, perm is the permissions of a created file.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	//Remove removes the file or the empty directory name.
+	Remove(name string) error
+	//RemoveAll removes the entry name and its content, it doesn't fail if the entry doesn't exist.
+	RemoveAll(name string) error
+	//MkdirAll creates the directory name and its missing parents with the permissions perm.
+	MkdirAll(name string, perm fs.FileMode) error
+	//Symlink creates the symlink name to target.
+	Symlink(target, name string) error
+	//Readlink returns the target of the symlink name.
+	Readlink(name string) (string, error)
+	//Link creates the hard link newName to the file oldName.
+	Link(oldName, newName string) error
+	//Rename renames the entry oldName to newName, an existing file newName is replaced.
+	Rename(oldName, newName string) error
+	//Chmod changes the permissions of the entry name.
+	Chmod(name string, mode fs.FileMode) error
+	//Chtimes changes the access and modification times of the entry name.
+	Chtimes(name string, atime, mtime time.Time) error
+	//Lchown changes the user and the group owning the entry name, symlinks are not followed.
+	Lchown(name string, uid, gid int) error
+}
+
+// File is a file of an FS, *os.File is the File of the local disk.
+type File interface {
+	fs.File
+	io.Writer
+	io.ReaderAt
+	io.WriterAt
+	io.Seeker
+	//Name returns the name the file was opened with.
+	Name() string
+	//Truncate changes the size of the file.
+	Truncate(size int64) error
+	//Sync commits the content of the file to the storage.
+	Sync() error
+}
+
+// XattrFS is an FS whose entries have extended attributes, the symlinks are not followed.
+type XattrFS interface {
+	FS
+	//ListXattrs returns the names of the extended attributes of the entry name.
+	ListXattrs(name string) ([]string, error)
+	//GetXattr returns the value of the extended attribute attr of the entry name.
+	GetXattr(name, attr string) ([]byte, error)
+	//SetXattr sets the extended attribute attr of the entry name to value.
+	SetXattr(name, attr string, value []byte) error
+	//RemoveXattr removes the extended attribute attr of the entry name.
+	RemoveXattr(name, attr string) error
+}
+
+// SpecialFS is an FS where the named pipes, the sockets and the device nodes can be created.
+type SpecialFS interface {
+	FS
+	//Mknod creates the special file name of the type and the permissions of mode, dev is the device of a device node.
+	Mknod(name string, mode fs.FileMode, dev uint64) error
+}
+
+// OSFS is the FS of the local disk.
+type OSFS struct{}
+
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (OSFS) Open(name string) (File, error) {
+	// a nil *os.File would be a non nil File
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (OSFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (OSFS) Symlink(target, name string) error {
+	return os.Symlink(target, name)
+}
+
+func (OSFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (OSFS) Link(oldName, newName string) error {
+	return os.Link(oldName, newName)
+}
+
+func (OSFS) Rename(oldName, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (OSFS) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (OSFS) Lchown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
+
+func (OSFS) ListXattrs(name string) ([]string, error) {
+	return listXattrs(name)
+}
+
+func (OSFS) GetXattr(name, attr string) ([]byte, error) {
+	return getXattr(name, attr)
+}
+
+func (OSFS) SetXattr(name, attr string, value []byte) error {
+	return setXattr(name, attr, value)
+}
+
+func (OSFS) RemoveXattr(name, attr string) error {
+	return removeXattr(name, attr)
+}
+
+// IsLocal returns true if fsys is the local disk.
+func IsLocal(fsys FS) bool {
+	_, ok := fsys.(OSFS)
+	return ok
+}
+
+// CreateTemp creates a new file of the directory dir of fsys, opened for reading and writing, like os.CreateTemp:
+// the last "*" of pattern is replaced by a random string.
+func CreateTemp(fsys FS, dir, pattern string) (File, error) {
+	if IsLocal(fsys) {
+		f, err := os.CreateTemp(dir, pattern)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for i := 0; i < 10000; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		f, err := fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+	return nil, &fs.PathError{Op: "createtemp", Path: filepath.Join(dir, pattern), Err: fs.ErrExist}
+}
+
+// ReadFile returns the content of the file name of fsys, like os.ReadFile.
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// WriteFile writes data to the file name of fsys, created with the permissions perm if needed, like os.WriteFile.
+func WriteFile(fsys FS, name string, data []byte, perm fs.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// HashFS returns the hash of the content of the file name of fsys computed with the algorithm.
+func HashFS(fsys FS, name string, algorithm HashAlgorithm) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	h := algorithm.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("cannot hash file %s: %w", name, err)
+	}
+
+	return h.Sum(nil), nil
+}
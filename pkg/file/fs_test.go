@@ -0,0 +1,255 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBasicCopy_Copy_fs(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	local := t.TempDir()
+	if err := os.WriteFile(path.Join(local, "file"), []byte("local content"), 0640); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+	os.Chtimes(path.Join(local, "file"), modTime, modTime)
+
+	memory := NewMemFS()
+	memory.MkdirAll("source", 0755)
+	WriteFile(memory, "source/file", []byte("memory content"), 0644)
+	memory.Chmod("source/file", 0640)
+	memory.Chtimes("source/file", modTime, modTime)
+
+	basic := func(source, destination FS, atomic bool) BasicCopy {
+		return BasicCopy{Preserve: DefaultAttributes, Atomic: atomic, Source: source, Destination: destination}
+	}
+	tests := []struct {
+		name        string
+		source      FS
+		sourceDir   string
+		copier      func(source, destination FS) Copier
+		wantContent string
+	}{
+		{"local to memory", OSFS{}, local, func(s, d FS) Copier { c := basic(s, d, true); return &c }, "local content"},
+		{"memory to memory", memory, "source", func(s, d FS) Copier { c := basic(s, d, true); return &c }, "memory content"},
+		{"memory to memory in place", memory, "source", func(s, d FS) Copier { c := basic(s, d, false); return &c }, "memory content"},
+		{"delta", memory, "source", func(s, d FS) Copier {
+			return &DeltaCopy{BasicCopy: basic(s, d, true), BlockSize: 4}
+		}, "memory content"},
+		{"delta in place", memory, "source", func(s, d FS) Copier {
+			return &DeltaCopy{BasicCopy: basic(s, d, false), BlockSize: 4}
+		}, "memory content"},
+		{"kernel copy falls back to the buffered copy", memory, "source", func(s, d FS) Copier {
+			return &FastCopy{BasicCopy: basic(s, d, true), Method: Reflink}
+		}, "memory content"},
+		{"resumable", memory, "source", func(s, d FS) Copier {
+			return &ResumableCopy{BasicCopy: basic(s, d, true), Recorder: &memoryRecorder{checkpoints: make(map[string][]Checkpoint)}, Interval: 4}
+		}, "memory content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination := NewMemFS()
+			c := tt.copier(tt.source, destination)
+			if err := c.Copy(path.Join(tt.sourceDir, "file"), "destination/dir/file", false); err != nil {
+				t.Fatalf("Copy() unexpected error: %v", err)
+			}
+			if got, err := ReadFile(destination, "destination/dir/file"); err != nil || string(got) != tt.wantContent {
+				t.Errorf("Copy() content = %q, %v, want %q", got, err, tt.wantContent)
+			}
+			info, err := destination.Stat("destination/dir/file")
+			if err != nil || info.Mode() != 0640 || !info.ModTime().Equal(modTime) {
+				t.Errorf("Copy() attributes = %v, want mode 0640 and modification time %v", info, modTime)
+			}
+			entries, _ := destination.ReadDir("destination/dir")
+			if len(entries) != 1 {
+				t.Errorf("Copy() left %d entries, want the file only", len(entries))
+			}
+
+			// a new copy replaces an outdated file
+			WriteFile(destination, "destination/dir/file", []byte("outdated memory content and more"), 0644)
+			if err := c.Copy(path.Join(tt.sourceDir, "file"), "destination/dir/file", false); err != nil {
+				t.Errorf("Copy() unexpected error: %v", err)
+			}
+			if got, _ := ReadFile(destination, "destination/dir/file"); string(got) != tt.wantContent {
+				t.Errorf("Copy() content = %q, want %q", got, tt.wantContent)
+			}
+		})
+	}
+
+	t.Run("sparse", func(t *testing.T) {
+		destination := NewMemFS()
+		WriteFile(memory, "source/zeros", []byte("data"+string(make([]byte, 3*bufferSize))+"data"), 0644)
+		c := &BasicCopy{Sparse: true, Source: memory, Destination: destination}
+		if err := c.Copy("source/zeros", "destination/zeros", false); err != nil {
+			t.Fatalf("Copy() unexpected error: %v", err)
+		}
+		want, _ := ReadFile(memory, "source/zeros")
+		if got, err := ReadFile(destination, "destination/zeros"); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Copy() content of %d bytes, want %d bytes", len(got), len(want))
+		}
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		destination := NewMemFS()
+		destination.MkdirAll("destination", 0755)
+		memory.Symlink("file", "source/link")
+		c := &BasicCopy{Source: memory, Destination: destination}
+		if err := c.Copy("source/link", "destination/link", true); err != nil {
+			t.Fatalf("Copy() unexpected error: %v", err)
+		}
+		if target, err := destination.Readlink("destination/link"); err != nil || target != "file" {
+			t.Errorf("Copy() symlink target = %q, %v, want %q", target, err, "file")
+		}
+	})
+
+	t.Run("aborted", func(t *testing.T) {
+		destination := NewMemFS()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := &BasicCopy{Source: memory, Destination: destination, Atomic: true}
+		if err := c.CopyContext(ctx, "source/file", "destination/file", false); !errors.Is(err, context.Canceled) {
+			t.Errorf("CopyContext() error = %v, want %v", err, context.Canceled)
+		}
+		if _, err := destination.Stat("destination/file"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("CopyContext() destination exists after an aborted copy")
+		}
+	})
+}
+
+func TestCopyMetadataFS(t *testing.T) {
+	source, destination := NewMemFS(), NewMemFS()
+	WriteFile(source, "file", []byte("content"), 0644)
+	source.SetXattr("file", "user.kept", []byte("value"))
+	source.SetXattr("file", "trusted.ignored", []byte("value"))
+	WriteFile(destination, "file", []byte("content"), 0644)
+	destination.SetXattr("file", "user.stale", []byte("value"))
+
+	info, _ := source.Lstat("file")
+	if err := CopyMetadataFS(source, "file", destination, "file", info, Mode|Xattrs); err != nil {
+		t.Fatalf("CopyMetadataFS() unexpected error: %v", err)
+	}
+	if names, err := destination.ListXattrs("file"); err != nil || !reflect.DeepEqual(names, []string{"user.kept"}) {
+		t.Errorf("CopyMetadataFS() extended attributes = %v, %v, want [user.kept]", names, err)
+	}
+	if changed, err := XattrsChangedFS(source, "file", destination, "file", Xattrs); err != nil || changed {
+		t.Errorf("XattrsChangedFS() = %v, %v, want false", changed, err)
+	}
+	if changed, err := XattrsChangedFS(source, "file", destination, "file", Xattrs|TrustedXattrs); err != nil || !changed {
+		t.Errorf("XattrsChangedFS() = %v, %v, want true", changed, err)
+	}
+}
+
+func TestCreateSpecialFS(t *testing.T) {
+	source, destination := NewMemFS(), NewMemFS()
+	source.Mknod("device", fs.ModeDevice|fs.ModeCharDevice|0600, 42)
+	WriteFile(destination, "device", []byte("a file"), 0644)
+
+	if err := CreateSpecialFS(source, "device", destination, "device", Mode); err != nil {
+		t.Fatalf("CreateSpecialFS() unexpected error: %v", err)
+	}
+	if info, err := destination.Lstat("device"); err != nil || info.Mode() != fs.ModeDevice|fs.ModeCharDevice|0600 {
+		t.Errorf("CreateSpecialFS() destination = %v, %v, want a character device", info, err)
+	}
+	if changed, err := SpecialChangedFS(source, "device", destination, "device"); err != nil || changed {
+		t.Errorf("SpecialChangedFS() = %v, %v, want false", changed, err)
+	}
+
+	source.Remove("device")
+	source.Mknod("device", fs.ModeDevice|fs.ModeCharDevice|0600, 43)
+	if changed, err := SpecialChangedFS(source, "device", destination, "device"); err != nil || !changed {
+		t.Errorf("SpecialChangedFS() of another device = %v, %v, want true", changed, err)
+	}
+}
+
+func TestLinkFS(t *testing.T) {
+	m := NewMemFS()
+	WriteFile(m, "target", []byte("content"), 0644)
+	WriteFile(m, "file", []byte("other content"), 0644)
+	target, _ := m.Lstat("target")
+	if _, ok := HardLinkID(target); ok {
+		t.Errorf("HardLinkID() of a single link is ok")
+	}
+
+	if err := LinkFS(m, "target", "file"); err != nil {
+		t.Fatalf("LinkFS() unexpected error: %v", err)
+	}
+	// linking again does nothing
+	if err := LinkFS(m, "target", "file"); err != nil {
+		t.Fatalf("LinkFS() unexpected error: %v", err)
+	}
+	target, _ = m.Lstat("target")
+	file, _ := m.Lstat("file")
+	if !SameFile(target, file) {
+		t.Errorf("SameFile() = false, want true")
+	}
+	targetID, ok1 := HardLinkID(target)
+	fileID, ok2 := HardLinkID(file)
+	if !ok1 || !ok2 || targetID != fileID {
+		t.Errorf("HardLinkID() = %v, %v and %v, %v, want the same identity", targetID, ok1, fileID, ok2)
+	}
+	if entries, _ := m.ReadDir("."); len(entries) != 2 {
+		t.Errorf("LinkFS() left %d entries, want 2", len(entries))
+	}
+}
+
+func TestCreateTemp(t *testing.T) {
+	m := NewMemFS()
+	m.MkdirAll("dir", 0755)
+	names := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		f, err := CreateTemp(m, "dir", TempFilePattern("file"))
+		if err != nil {
+			t.Fatalf("CreateTemp() unexpected error: %v", err)
+		}
+		f.Close()
+		if !IsTempFile(path.Base(f.Name())) || path.Dir(f.Name()) != "dir" || names[f.Name()] {
+			t.Errorf("CreateTemp() name = %s", f.Name())
+		}
+		names[f.Name()] = true
+	}
+	if _, err := CreateTemp(m, "missing", "*"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("CreateTemp() error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestChangeDetector_ChangedFS(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	m := NewMemFS()
+	files := map[string]string{"source": "content", "same": "content", "other": "CONTENT", "longer": "longer content"}
+	for name, content := range files {
+		WriteFile(m, name, []byte(content), 0644)
+		m.Chtimes(name, modTime, modTime)
+	}
+
+	tests := []struct {
+		name        string
+		detector    FSChangeDetector
+		destination string
+		want        bool
+	}{
+		{"quick, same", &QuickCheck{}, "same", false},
+		{"quick, same size and time", &QuickCheck{}, "other", false},
+		{"quick, size differs", &QuickCheck{}, "longer", true},
+		{"quick, missing", &QuickCheck{}, "missing", true},
+		{"hash, same", &HashCheck{}, "same", false},
+		{"hash, content differs", &HashCheck{}, "other", true},
+		{"always", &AlwaysCopy{}, "same", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.detector.ChangedFS(m, "source", m, tt.destination)
+			if err != nil {
+				t.Fatalf("ChangedFS() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ChangedFS() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
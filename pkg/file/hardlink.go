@@ -0,0 +1,57 @@
+package file
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// FileID identifies a file by device and inode.
+type FileID struct {
+	Dev, Ino uint64
+}
+
+// HardLinkID returns the identity of the file described by info if it has several hard links.
+// The hard links are detected on Unix systems and on a MemFS.
+func HardLinkID(info fs.FileInfo) (FileID, bool) {
+	if m, ok := info.(*memInfo); ok {
+		return FileID{Ino: m.entry.ino}, m.nlink > 1
+	}
+	return hardLinkID(info)
+}
+
+// SameFile returns true if info1 and info2 describe the same file, such as two hard links to it.
+func SameFile(info1, info2 fs.FileInfo) bool {
+	m1, ok1 := info1.(*memInfo)
+	m2, ok2 := info2.(*memInfo)
+	if ok1 || ok2 {
+		return ok1 && ok2 && m1.entry == m2.entry
+	}
+	return os.SameFile(info1, info2)
+}
+
+// Link replaces the destinationFile with a hard link to the targetFile, through a temporary link renamed over it
+// so the destinationFile is never missing.
+func Link(targetFile, destinationFile string) error {
+	return LinkFS(OSFS{}, targetFile, destinationFile)
+}
+
+// LinkFS replaces the destinationFile of fsys with a hard link to the targetFile like Link.
+func LinkFS(fsys FS, targetFile, destinationFile string) error {
+	temp := tempFileName(destinationFile, "link")
+	if err := fsys.Remove(temp); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove temporary link %s: %w", temp, err)
+	}
+	if err := fsys.Link(targetFile, temp); err != nil {
+		return fmt.Errorf("cannot link %s to %s: %w", destinationFile, targetFile, err)
+	}
+	if err := fsys.Rename(temp, destinationFile); err != nil {
+		fsys.Remove(temp)
+		return fmt.Errorf("cannot rename temporary link %s to %s: %w", temp, destinationFile, err)
+	}
+	// rename does nothing when the destinationFile is already a link to the targetFile
+	if err := fsys.Remove(temp); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove temporary link %s: %w", temp, err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package file
+
+import "os"
+
+// hardLinkID returns the identity of a file of the local disk with several hard links,
+// hard links are not detected on this platform.
+func hardLinkID(os.FileInfo) (FileID, bool) {
+	return FileID{}, false
+}
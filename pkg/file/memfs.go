@@ -0,0 +1,700 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxSymlinks is the number of symlinks followed to resolve a path before it is considered a loop.
+const maxSymlinks = 40
+
+var (
+	errNotDir   = errors.New("not a directory")
+	errIsDir    = errors.New("is a directory")
+	errNotEmpty = errors.New("directory not empty")
+	errNoXattr  = errors.New("no such extended attribute")
+	errReadOnly = errors.New("file not opened for writing")
+	errLoop     = errors.New("too many levels of symbolic links")
+)
+
+// memInodes numbers the entries of all the MemFS, so the entries of different MemFS are different files.
+var memInodes atomic.Uint64
+
+// MemFS is an FS keeping its entries in memory, to test a synchronization without real folders.
+// It supports the hard links, the owners, the extended attributes and the special files. Use NewMemFS to create one.
+type MemFS struct {
+	mu sync.Mutex
+	// entries are the entries by resolved path, the root "/" and "." are the implicit directory root.
+	entries map[string]*memEntry
+	root    *memEntry
+}
+
+type memEntry struct {
+	ino      uint64
+	nlink    int
+	mode     fs.FileMode
+	modTime  time.Time
+	uid, gid int
+	dev      uint64
+	data     []byte
+	target   string
+	xattrs   map[string][]byte
+}
+
+// NewMemFS returns an empty in-memory FS.
+func NewMemFS() *MemFS {
+	return &MemFS{entries: make(map[string]*memEntry), root: newMemEntry(fs.ModeDir | 0755)}
+}
+
+func newMemEntry(mode fs.FileMode) *memEntry {
+	return &memEntry{ino: memInodes.Add(1), nlink: 1, mode: mode, modTime: time.Now()}
+}
+
+// isRoot returns true if the clean path name is the root of the FS.
+func isRoot(name string) bool {
+	return name == "." || name == "/"
+}
+
+// resolve returns the path of the entry name once its symlinks are followed, the last element is only followed
+// if follow is true. The entry itself may not exist but its parents do. It is called with the lock held.
+func (m *MemFS) resolve(op, name string, follow bool) (string, error) {
+	name = path.Clean(name)
+	for links := 0; ; {
+		parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+		resolved := "."
+		if path.IsAbs(name) {
+			resolved = "/"
+		}
+		restart := false
+		for i, part := range parts {
+			next := path.Join(resolved, part)
+			last := i == len(parts)-1
+			e, ok := m.entry(next)
+			switch {
+			case !ok && last:
+			case !ok:
+				return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			case e.mode&fs.ModeSymlink != 0 && (!last || follow):
+				if links++; links > maxSymlinks {
+					return "", &fs.PathError{Op: op, Path: name, Err: errLoop}
+				}
+				target := e.target
+				if !path.IsAbs(target) {
+					target = path.Join(resolved, target)
+				}
+				name = path.Join(append([]string{target}, parts[i+1:]...)...)
+				restart = true
+			case !last && !e.mode.IsDir():
+				return "", &fs.PathError{Op: op, Path: name, Err: errNotDir}
+			}
+			if restart {
+				break
+			}
+			resolved = next
+		}
+		if !restart {
+			return resolved, nil
+		}
+	}
+}
+
+// entry returns the entry of the resolved path name. It is called with the lock held.
+func (m *MemFS) entry(name string) (*memEntry, bool) {
+	if isRoot(name) {
+		return m.root, true
+	}
+	e, ok := m.entries[name]
+	return e, ok
+}
+
+// lookup returns the entry name, following the symlinks if follow is true, and its resolved path.
+// It is called with the lock held.
+func (m *MemFS) lookup(op, name string, follow bool) (*memEntry, string, error) {
+	resolved, err := m.resolve(op, name, follow)
+	if err != nil {
+		return nil, "", err
+	}
+	e, ok := m.entry(resolved)
+	if !ok {
+		return nil, resolved, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, resolved, nil
+}
+
+// create adds the entry e at the resolved path name, which must not exist. It is called with the lock held.
+func (m *MemFS) create(op, name string, e *memEntry) error {
+	if _, ok := m.entry(name); ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+	if parent, _ := m.entry(path.Dir(name)); parent == nil || !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	m.entries[name] = e
+	return nil
+}
+
+// hasChildren returns true if the resolved path name has entries. It is called with the lock held.
+func (m *MemFS) hasChildren(name string) bool {
+	for child := range m.entries {
+		if child != name && path.Dir(child) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, resolved, err := m.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	entries := make([]fs.DirEntry, 0)
+	for child, e := range m.entries {
+		if child != resolved && path.Dir(child) == resolved {
+			entries = append(entries, fs.FileInfoToDirEntry(e.info(child)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	// the stats of a followed symlink are named after the symlink
+	return e.info(name), nil
+}
+
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return e.info(name), nil
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	e, resolved, err := m.lookup("open", name, true)
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case err == nil && e.mode.IsDir() && writable:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+	case err == nil:
+		if flag&os.O_TRUNC != 0 && writable {
+			e.data = nil
+			e.modTime = time.Now()
+		}
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0 && resolved != "":
+		e = newMemEntry(perm.Perm())
+		if err := m.create("open", resolved, e); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return &memFile{fs: m, entry: e, name: name, flag: flag}, nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, resolved, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if isRoot(resolved) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	if e.mode.IsDir() && m.hasChildren(resolved) {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(m.entries, resolved)
+	e.nlink--
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, resolved, err := m.lookup("removeall", name, false)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if isRoot(resolved) {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+	for child, e := range m.entries {
+		if child == resolved || strings.HasPrefix(child, resolved+"/") {
+			delete(m.entries, child)
+			e.nlink--
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the parents are created first
+	var dirs []string
+	for dir := path.Clean(name); !isRoot(dir); dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		e, resolved, err := m.lookup("mkdir", dirs[i], true)
+		switch {
+		case err == nil && !e.mode.IsDir():
+			return &fs.PathError{Op: "mkdir", Path: dirs[i], Err: errNotDir}
+		case errors.Is(err, fs.ErrNotExist) && resolved != "":
+			m.entries[resolved] = newMemEntry(fs.ModeDir | perm.Perm())
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Symlink(target, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resolved, err := m.resolve("symlink", name, false)
+	if err != nil {
+		return err
+	}
+	e := newMemEntry(fs.ModeSymlink | 0777)
+	e.target = target
+	return m.create("symlink", resolved, e)
+}
+
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if e.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return e.target, nil
+}
+
+func (m *MemFS) Link(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("link", oldName, false)
+	if err != nil {
+		return err
+	}
+	if e.mode.IsDir() {
+		return &fs.PathError{Op: "link", Path: oldName, Err: fs.ErrPermission}
+	}
+	resolved, err := m.resolve("link", newName, false)
+	if err != nil {
+		return err
+	}
+	if err := m.create("link", resolved, e); err != nil {
+		return err
+	}
+	e.nlink++
+	return nil
+}
+
+func (m *MemFS) Rename(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, oldPath, err := m.lookup("rename", oldName, false)
+	if err != nil {
+		return err
+	}
+	newPath, err := m.resolve("rename", newName, false)
+	if err != nil {
+		return err
+	}
+	if isRoot(oldPath) || isRoot(newPath) || strings.HasPrefix(newPath, oldPath+"/") {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+	if parent, _ := m.entry(path.Dir(newPath)); parent == nil || !parent.mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: newName, Err: errNotDir}
+	}
+	existing, ok := m.entries[newPath]
+	if ok && existing == e {
+		// renaming a hard link over another link to the same file does nothing
+		return nil
+	}
+	if ok {
+		switch {
+		case existing.mode.IsDir() && !e.mode.IsDir():
+			return &fs.PathError{Op: "rename", Path: newName, Err: errIsDir}
+		case !existing.mode.IsDir() && e.mode.IsDir():
+			return &fs.PathError{Op: "rename", Path: newName, Err: errNotDir}
+		case existing.mode.IsDir() && m.hasChildren(newPath):
+			return &fs.PathError{Op: "rename", Path: newName, Err: errNotEmpty}
+		}
+		existing.nlink--
+	}
+
+	for child, ce := range m.entries {
+		if strings.HasPrefix(child, oldPath+"/") {
+			delete(m.entries, child)
+			m.entries[newPath+child[len(oldPath):]] = ce
+		}
+	}
+	delete(m.entries, oldPath)
+	m.entries[newPath] = e
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	e.mode = e.mode.Type() | mode&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)
+	return nil
+}
+
+func (m *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	e.modTime = mtime
+	return nil
+}
+
+func (m *MemFS) Lchown(name string, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("lchown", name, false)
+	if err != nil {
+		return err
+	}
+	e.uid, e.gid = uid, gid
+	return nil
+}
+
+func (m *MemFS) ListXattrs(name string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("listxattr", name, false)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(e.xattrs))
+	for attr := range e.xattrs {
+		names = append(names, attr)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemFS) GetXattr(name, attr string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("getxattr", name, false)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := e.xattrs[attr]
+	if !ok {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: errNoXattr}
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (m *MemFS) SetXattr(name, attr string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("setxattr", name, false)
+	if err != nil {
+		return err
+	}
+	if e.xattrs == nil {
+		e.xattrs = make(map[string][]byte)
+	}
+	e.xattrs[attr] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *MemFS) RemoveXattr(name, attr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, _, err := m.lookup("removexattr", name, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.xattrs[attr]; !ok {
+		return &fs.PathError{Op: "removexattr", Path: name, Err: errNoXattr}
+	}
+	delete(e.xattrs, attr)
+	return nil
+}
+
+func (m *MemFS) Mknod(name string, mode fs.FileMode, dev uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !IsSpecial(mode) {
+		return &fs.PathError{Op: "mknod", Path: name, Err: fs.ErrInvalid}
+	}
+	resolved, err := m.resolve("mknod", name, false)
+	if err != nil {
+		return err
+	}
+	e := newMemEntry(mode.Type() | mode.Perm())
+	e.dev = dev
+	return m.create("mknod", resolved, e)
+}
+
+// info returns the stats of the entry named name. It is called with the lock held.
+func (e *memEntry) info(name string) *memInfo {
+	size := int64(len(e.data))
+	if e.mode&fs.ModeSymlink != 0 {
+		size = int64(len(e.target))
+	}
+	return &memInfo{name: path.Base(path.Clean(name)), size: size, mode: e.mode, modTime: e.modTime,
+		uid: e.uid, gid: e.gid, dev: e.dev, nlink: e.nlink, entry: e}
+}
+
+// memInfo describes an entry of a MemFS.
+type memInfo struct {
+	name     string
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	uid, gid int
+	dev      uint64
+	nlink    int
+	// entry identifies the file, the hard links of a file share their entry
+	entry *memEntry
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() any           { return nil }
+
+// memFile is a file of a MemFS opened by OpenFile, it reads and writes the content of its entry.
+type memFile struct {
+	fs     *MemFS
+	entry  *memEntry
+	name   string
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.entry.info(f.name), nil
+}
+
+// check returns an error if the file is closed, or not opened for writing when write is true.
+// It is called with the lock held.
+func (f *memFile) check(op string, write bool) error {
+	switch {
+	case f.closed:
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	case write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		return &fs.PathError{Op: op, Path: f.name, Err: errReadOnly}
+	case f.entry.mode.IsDir():
+		return &fs.PathError{Op: op, Path: f.name, Err: errIsDir}
+	}
+	return nil
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	n, err := f.readAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(b []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	n, err := f.readAt(b, off)
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readAt reads the content at off in b. It is called with the lock held.
+func (f *memFile) readAt(b []byte, off int64) (int, error) {
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if off >= int64(len(f.entry.data)) {
+		return 0, io.EOF
+	}
+	return copy(b, f.entry.data[off:]), nil
+}
+
+func (f *memFile) Write(b []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.entry.data))
+	}
+	n, err := f.writeAt(b, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(b []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	return f.writeAt(b, off)
+}
+
+// writeAt writes b at off, the content is extended with zeros if off is after its end. It is called with the lock held.
+func (f *memFile) writeAt(b []byte, off int64) (int, error) {
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if end := off + int64(len(b)); end > int64(len(f.entry.data)) {
+		f.entry.data = append(f.entry.data, make([]byte, end-int64(len(f.entry.data)))...)
+	}
+	copy(f.entry.data[off:], b)
+	f.entry.modTime = time.Now()
+	return len(b), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.entry.data))
+	case io.SeekStart:
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if size <= int64(len(f.entry.data)) {
+		f.entry.data = f.entry.data[:size]
+	} else {
+		f.entry.data = append(f.entry.data, make([]byte, size-int64(len(f.entry.data)))...)
+	}
+	f.entry.modTime = time.Now()
+	return nil
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
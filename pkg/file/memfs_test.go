@@ -0,0 +1,205 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemFS(t *testing.T) {
+	m := NewMemFS()
+	if err := m.MkdirAll("root/dir/sub", 0755); err != nil {
+		t.Fatalf("MkdirAll() unexpected error: %v", err)
+	}
+	WriteFile(m, "root/b", []byte("content of b"), 0644)
+	WriteFile(m, "root/dir/a", []byte("content of a"), 0644)
+	if err := m.Symlink("dir/a", "root/link"); err != nil {
+		t.Fatalf("Symlink() unexpected error: %v", err)
+	}
+
+	entries, err := m.ReadDir("root")
+	if err != nil {
+		t.Fatalf("ReadDir() unexpected error: %v", err)
+	}
+	got := make(map[string]fs.FileMode)
+	names := make([]string, 0)
+	for _, e := range entries {
+		names = append(names, e.Name())
+		got[e.Name()] = e.Type()
+	}
+	if want := []string{"b", "dir", "link"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir() = %v, want %v", names, want)
+	}
+	if got["dir"] != fs.ModeDir || got["link"] != fs.ModeSymlink || got["b"] != 0 {
+		t.Errorf("ReadDir() types = %v", got)
+	}
+
+	tests := []struct {
+		name    string
+		op      func() error
+		wantErr error
+	}{
+		{"stat follows symlinks", func() error {
+			info, err := m.Stat("root/link")
+			if err == nil && (info.Size() != int64(len("content of a")) || info.Name() != "link") {
+				return errors.New("wrong stats")
+			}
+			return err
+		}, nil},
+		{"lstat", func() error {
+			info, err := m.Lstat("root/link")
+			if err == nil && info.Mode()&fs.ModeSymlink == 0 {
+				return errors.New("not a symlink")
+			}
+			return err
+		}, nil},
+		{"open through symlink", func() error {
+			content, err := ReadFile(m, "root/link")
+			if err == nil && string(content) != "content of a" {
+				return errors.New("wrong content")
+			}
+			return err
+		}, nil},
+		{"readlink", func() error {
+			target, err := m.Readlink("root/link")
+			if err == nil && target != "dir/a" {
+				return errors.New("wrong target")
+			}
+			return err
+		}, nil},
+		{"intermediate symlink", func() error {
+			if err := m.Symlink("dir", "root/dirlink"); err != nil {
+				return err
+			}
+			if err := WriteFile(m, "root/dirlink/c", []byte("content of c"), 0644); err != nil {
+				return err
+			}
+			content, err := ReadFile(m, "root/dir/c")
+			if err == nil && string(content) != "content of c" {
+				return errors.New("wrong content")
+			}
+			if err == nil {
+				err = m.Remove("root/dir/c")
+			}
+			return err
+		}, nil},
+		{"symlink loop", func() error {
+			m.Symlink("loop", "root/loop")
+			_, err := m.Stat("root/loop/a")
+			return err
+		}, errLoop},
+		{"exclusive create", func() error { _, err := m.OpenFile("root/b", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644); return err }, fs.ErrExist},
+		{"remove a folder not empty", func() error { return m.Remove("root/dir") }, errNotEmpty},
+		{"write at and truncate", func() error {
+			f, err := m.OpenFile("root/c", os.O_RDWR|os.O_CREATE, 0644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			f.WriteAt([]byte("xy"), 3)
+			f.Truncate(4)
+			if content, _ := ReadFile(m, "root/c"); string(content) != "\x00\x00\x00x" {
+				return fmt.Errorf("content = %q", content)
+			}
+			r, _ := m.Open("root/c")
+			defer r.Close()
+			_, err = r.Write([]byte("z"))
+			return err
+		}, errReadOnly},
+		{"readlink of a file", func() error { _, err := m.Readlink("root/b"); return err }, fs.ErrInvalid},
+		{"missing entry", func() error { _, err := m.Stat("root/missing"); return err }, fs.ErrNotExist},
+		{"missing parent", func() error { _, err := m.OpenFile("root/missing/c", os.O_WRONLY|os.O_CREATE, 0644); return err }, fs.ErrNotExist},
+		{"existing symlink", func() error { return m.Symlink("b", "root/link") }, fs.ErrExist},
+		{"mkdir over a file", func() error { return m.MkdirAll("root/b/c", 0755) }, errNotDir},
+		{"chmod and chtimes", func() error {
+			modTime := time.Unix(1000, 0)
+			if err := m.Chmod("root/b", 0600); err != nil {
+				return err
+			}
+			if err := m.Chtimes("root/b", modTime, modTime); err != nil {
+				return err
+			}
+			info, err := m.Stat("root/b")
+			if err == nil && (info.Mode() != 0600 || !info.ModTime().Equal(modTime)) {
+				return errors.New("wrong mode or times")
+			}
+			return err
+		}, nil},
+		{"rename a folder", func() error {
+			if err := m.Rename("root/dir", "root/moved"); err != nil {
+				return err
+			}
+			content, err := ReadFile(m, "root/moved/a")
+			if err == nil && string(content) != "content of a" {
+				return errors.New("wrong content")
+			}
+			if _, err := m.Stat("root/moved/sub"); err != nil {
+				return err
+			}
+			_, err = m.Stat("root/dir/a")
+			if !errors.Is(err, fs.ErrNotExist) {
+				return errors.New("renamed entry still exists")
+			}
+			return nil
+		}, nil},
+		{"rename a file over a folder", func() error { return m.Rename("root/b", "root/moved") }, errIsDir},
+		{"remove all", func() error {
+			if err := m.RemoveAll("root/moved"); err != nil {
+				return err
+			}
+			if _, err := m.Lstat("root/moved/a"); !errors.Is(err, fs.ErrNotExist) {
+				return errors.New("removed entry still exists")
+			}
+			return m.RemoveAll("root/moved")
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.op()
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemFS_root(t *testing.T) {
+	first, second := NewMemFS(), NewMemFS()
+	firstTime, secondTime := time.Unix(1000, 0), time.Unix(2000, 0)
+	for _, tt := range []struct {
+		m       *MemFS
+		name    string
+		mode    fs.FileMode
+		modTime time.Time
+	}{{first, "/", 0700, firstTime}, {second, ".", 0750, secondTime}} {
+		if err := tt.m.Chmod(tt.name, tt.mode); err != nil {
+			t.Fatalf("Chmod() unexpected error: %v", err)
+		}
+		if err := tt.m.Chtimes(tt.name, tt.modTime, tt.modTime); err != nil {
+			t.Fatalf("Chtimes() unexpected error: %v", err)
+		}
+	}
+
+	for _, tt := range []struct {
+		m       *MemFS
+		mode    fs.FileMode
+		modTime time.Time
+	}{{first, 0700, firstTime}, {second, 0750, secondTime}} {
+		for _, name := range []string{"/", "."} {
+			info, err := tt.m.Stat(name)
+			if err != nil {
+				t.Fatalf("Stat() unexpected error: %v", err)
+			}
+			if info.Mode() != fs.ModeDir|tt.mode || !info.ModTime().Equal(tt.modTime) {
+				t.Errorf("Stat(%q) = %v %v, want %v %v", name, info.Mode(), info.ModTime(), fs.ModeDir|tt.mode, tt.modTime)
+			}
+		}
+	}
+}
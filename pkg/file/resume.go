@@ -0,0 +1,229 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// DefaultCheckpointInterval is the number of bytes between the checkpoints of a ResumableCopy unless configured otherwise.
+const DefaultCheckpointInterval = 64 * 1024 * 1024
+
+// Checkpoint is the progress of a resumable copy: the first Offset bytes of the partial file are the first bytes
+// of the source file, whose SHA-256 hash is Sum. The size and the modification time identify the version of the source.
+type Checkpoint struct {
+	SourceSize    int64  `json:"source_size"`
+	SourceModTime int64  `json:"source_mtime"`
+	Offset        int64  `json:"offset"`
+	Sum           []byte `json:"sum"`
+}
+
+// CheckpointRecorder records the progress of resumable copies, usually in a journal that outlives the process.
+type CheckpointRecorder interface {
+	//Checkpoints returns the checkpoints recorded for the copy to destinationFile, in the order they were recorded.
+	Checkpoints(destinationFile string) []Checkpoint
+	//RecordCheckpoint records a checkpoint of the copy to destinationFile.
+	RecordCheckpoint(destinationFile string, c Checkpoint) error
+}
+
+// PartialFile returns the name of the partial file a ResumableCopy writes the destinationFile in.
+// It is a temporary file, see IsTempFile.
+func PartialFile(destinationFile string) string {
+	return tempFileName(destinationFile, "partial")
+}
+
+// ResumableCopy is a Copier whose interrupted copies of large files can be resumed. A file larger than the checkpoint
+// interval is written in its PartialFile, renamed over the destination file once complete, and a checkpoint is recorded
+// at every interval. A copy aborted by its context keeps the partial file: the next copy of the same version of the source
+// checks the partial file against the checkpoints and resumes after the last one it matches.
+// Smaller files and symlinks are copied as by the embedded BasicCopy.
+type ResumableCopy struct {
+	BasicCopy
+	Recorder CheckpointRecorder
+	// Interval is the number of bytes between checkpoints, DefaultCheckpointInterval if it is 0.
+	Interval int64
+
+	resumed atomic.Int64
+}
+
+func (c *ResumableCopy) Copy(sourceFile, destinationFile string, symlink bool) error {
+	return c.CopyContext(context.Background(), sourceFile, destinationFile, symlink)
+}
+
+// CopyContext aborts the copies when ctx is done, the partial file of a large file is then kept.
+func (c *ResumableCopy) CopyContext(ctx context.Context, sourceFile, destinationFile string, symlink bool) error {
+	sourceInfo, err := c.sourceFS().Lstat(sourceFile)
+	if symlink || c.Recorder == nil || err != nil || !sourceInfo.Mode().IsRegular() || sourceInfo.Size() < c.interval() {
+		return c.BasicCopy.CopyContext(ctx, sourceFile, destinationFile, symlink)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("copy of %s aborted: %w", sourceFile, err)
+	}
+
+	source, err := c.sourceFS().Open(sourceFile)
+	if err != nil {
+		return fmt.Errorf("cannot open source file %s: %w", sourceFile, err)
+	}
+	defer source.Close()
+
+	if sourceInfo, err = source.Stat(); err != nil {
+		return fmt.Errorf("error getting stats for file %s: %w", sourceFile, err)
+	}
+
+	destinationDir := filepath.Dir(destinationFile)
+	createdDir, err := c.createParent(filepath.Dir(sourceFile), destinationDir)
+	if err != nil {
+		return err
+	}
+
+	if err := c.writePartial(ctx, source, sourceInfo, destinationFile); err != nil {
+		return err
+	}
+	if createdDir != nil {
+		return c.copyMetadata(filepath.Dir(sourceFile), destinationDir, createdDir)
+	}
+	return nil
+}
+
+// ResumedBytes returns the number of bytes of partial files reused by all the copies since the ResumableCopy was created.
+func (c *ResumableCopy) ResumedBytes() int64 {
+	return c.resumed.Load()
+}
+
+func (c *ResumableCopy) interval() int64 {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return DefaultCheckpointInterval
+}
+
+// writePartial writes the content of source in the partial file, from the last matching checkpoint if any,
+// and renames it over the destinationFile. The partial file is removed if the copy fails for another reason than ctx.
+func (c *ResumableCopy) writePartial(ctx context.Context, source File, sourceInfo os.FileInfo, destinationFile string) (err error) {
+	name := PartialFile(destinationFile)
+	partial, err := c.destinationFS().OpenFile(name, os.O_RDWR|os.O_CREATE, defaultFileMode)
+	if err != nil {
+		return fmt.Errorf("cannot open partial file for %s: %w", destinationFile, err)
+	}
+	defer func() {
+		if err != nil && ctx.Err() == nil {
+			c.destinationFS().Remove(name)
+		}
+	}()
+
+	offset, h, err := c.resume(partial, sourceInfo, destinationFile)
+	if err == nil {
+		c.resumed.Add(offset)
+		err = c.fill(ctx, source, partial, sourceInfo, destinationFile, offset, h)
+	}
+	if err == nil {
+		if syncErr := partial.Sync(); syncErr != nil {
+			err = fmt.Errorf("cannot sync partial file %s: %w", name, syncErr)
+		}
+	}
+	if closeErr := partial.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("cannot close partial file %s: %w", name, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	return c.replace(name, source.Name(), sourceInfo, destinationFile)
+}
+
+// resume returns the offset the copy resumes from and the hash of the content before it.
+// The partial file is hashed up to the last checkpoint of the same version of the source, the content after the last
+// checkpoint whose hash matches is truncated.
+func (c *ResumableCopy) resume(partial File, sourceInfo os.FileInfo, destinationFile string) (int64, hash.Hash, error) {
+	h := sha256.New()
+	checkpoints := make([]Checkpoint, 0)
+	for _, cp := range c.Recorder.Checkpoints(destinationFile) {
+		// the checkpoints are recorded in increasing offsets, those of a previous version of the source are ignored
+		if cp.SourceSize == sourceInfo.Size() && cp.SourceModTime == sourceInfo.ModTime().UnixNano() && cp.Offset <= sourceInfo.Size() {
+			checkpoints = append(checkpoints, cp)
+		}
+	}
+
+	var offset int64
+	var state []byte
+	for _, cp := range checkpoints {
+		if cp.Offset < offset {
+			continue
+		}
+		if _, err := io.CopyN(h, partial, cp.Offset-offset); errors.Is(err, io.EOF) {
+			// the partial file is shorter than the checkpoint
+			break
+		} else if err != nil {
+			return 0, nil, fmt.Errorf("cannot read partial file %s: %w", partial.Name(), err)
+		}
+		if !bytes.Equal(h.Sum(nil), cp.Sum) {
+			break
+		}
+		offset = cp.Offset
+		var err error
+		if state, err = h.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	h = sha256.New()
+	if state != nil {
+		if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			return 0, nil, err
+		}
+	}
+	if err := partial.Truncate(offset); err != nil {
+		return 0, nil, fmt.Errorf("cannot truncate partial file %s: %w", partial.Name(), err)
+	}
+	if _, err := partial.Seek(offset, io.SeekStart); err != nil {
+		return 0, nil, fmt.Errorf("cannot seek partial file %s: %w", partial.Name(), err)
+	}
+	return offset, h, nil
+}
+
+// fill copies the source from offset to the partial file and records a checkpoint at every interval.
+func (c *ResumableCopy) fill(ctx context.Context, source, partial File, sourceInfo os.FileInfo, destinationFile string, offset int64, h hash.Hash) error {
+	if _, err := source.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("cannot seek source file %s: %w", source.Name(), err)
+	}
+
+	interval := c.interval()
+	next := (offset/interval + 1) * interval
+	buf := make([]byte, 32*bufferSize)
+	w := io.MultiWriter(partial, h)
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("copy of %s aborted: %w", source.Name(), err)
+		}
+		chunk := buf
+		if remaining := next - offset; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		n, err := source.Read(chunk)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("cannot read from buffer for file %s: %w", source.Name(), err)
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return fmt.Errorf("cannot write in buffer for file %s: %w", partial.Name(), err)
+		}
+
+		offset += int64(n)
+		if offset == next {
+			next += interval
+			cp := Checkpoint{SourceSize: sourceInfo.Size(), SourceModTime: sourceInfo.ModTime().UnixNano(), Offset: offset, Sum: h.Sum(nil)}
+			if err := c.Recorder.RecordCheckpoint(destinationFile, cp); err != nil {
+				return fmt.Errorf("cannot record the progress of the copy to %s: %w", destinationFile, err)
+			}
+		}
+	}
+}
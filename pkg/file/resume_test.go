@@ -0,0 +1,117 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRecorder records the checkpoints in memory, it cancels the copies once it recorded cancelAfter checkpoints.
+type memoryRecorder struct {
+	mu          sync.Mutex
+	checkpoints map[string][]Checkpoint
+	cancelAfter int
+	cancel      context.CancelFunc
+}
+
+func (r *memoryRecorder) Checkpoints(destinationFile string) []Checkpoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.checkpoints[destinationFile]
+}
+
+func (r *memoryRecorder) RecordCheckpoint(destinationFile string, c Checkpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkpoints[destinationFile] = append(r.checkpoints[destinationFile], c)
+	if r.cancel != nil && len(r.checkpoints[destinationFile]) == r.cancelAfter {
+		r.cancel()
+	}
+	return nil
+}
+
+func TestResumableCopy_CopyContext(t *testing.T) {
+	const interval = 1024
+	content := make([]byte, 5*interval+100)
+	rand.New(rand.NewSource(3)).Read(content)
+
+	tests := []struct {
+		name string
+		// alter modifies the partial file or the source between the interrupted copy and the resumed copy
+		alter       func(t *testing.T, source, partial string)
+		wantResumed int64
+	}{
+		{"resumed", func(*testing.T, string, string) {}, 3 * interval},
+		{"partial file corrupted", func(t *testing.T, _, partial string) {
+			f, err := os.OpenFile(partial, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer f.Close()
+			if _, err := f.WriteAt([]byte("corrupted"), interval+10); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}, interval},
+		{"partial file missing", func(t *testing.T, _, partial string) {
+			if err := os.Remove(partial); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}, 0},
+		{"source modified", func(t *testing.T, source, _ string) {
+			mtime := time.Now().Add(time.Hour)
+			if err := os.Chtimes(source, mtime, mtime); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source, destination := path.Join(dir, "source"), path.Join(dir, "destination")
+			if err := os.WriteFile(source, content, 0644); err != nil {
+				t.Fatalf("cannot create file for test: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			recorder := &memoryRecorder{checkpoints: make(map[string][]Checkpoint), cancelAfter: 3, cancel: cancel}
+			c := &ResumableCopy{BasicCopy: BasicCopy{Preserve: DefaultAttributes}, Recorder: recorder, Interval: interval}
+			err := c.CopyContext(ctx, source, destination, false)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("CopyContext() error = %v, want context.Canceled", err)
+			}
+			if _, err := os.Stat(destination); !os.IsNotExist(err) {
+				t.Fatalf("CopyContext() interrupted wrote the destination: %v", err)
+			}
+
+			tt.alter(t, source, PartialFile(destination))
+			recorder.cancel = nil
+			if err := c.Copy(source, destination, false); err != nil {
+				t.Fatalf("Copy() unexpected error: %v", err)
+			}
+			if got := c.ResumedBytes(); got != tt.wantResumed {
+				t.Errorf("ResumedBytes() = %v, want %v", got, tt.wantResumed)
+			}
+			got, err := os.ReadFile(destination)
+			if err != nil || !bytes.Equal(got, content) {
+				t.Errorf("Copy() destination differs from the source, error = %v", err)
+			}
+			if _, err := os.Stat(PartialFile(destination)); !os.IsNotExist(err) {
+				t.Errorf("Copy() left the partial file: %v", err)
+			}
+		})
+	}
+}
+
+func TestPartialFile(t *testing.T) {
+	got := PartialFile("dir/big.iso")
+	if got != "dir/.gosync-big.iso-partial.tmp" || !IsTempFile(path.Base(got)) {
+		t.Errorf("PartialFile() = %v, want a temporary file", got)
+	}
+}
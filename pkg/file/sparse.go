@@ -0,0 +1,134 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// regionCopier copies the data of source from start to end, or to the end of the file if end is -1, at the same offset
+// of destination and returns the offset it reached.
+type regionCopier func(ctx context.Context, source, destination File, start, end int64) (int64, error)
+
+// copyContent copies the content of source to the empty destination through a buffer. The holes of a sparse source
+// are skipped, and so are the blocks of zeros if zeros is true.
+func copyContent(ctx context.Context, source, destination File, zeros bool) error {
+	return copyRegions(ctx, source, destination, bufferedRegion(bufferSize, zeros))
+}
+
+// copyRegions copies the data regions of source to the empty destination with copyRegion. The holes of a sparse source
+// are skipped, the destination is then extended to the size of the source.
+func copyRegions(ctx context.Context, source, destination File, copyRegion regionCopier) error {
+	var offset int64
+	for {
+		start, end, err := nextData(source, offset)
+		if errors.Is(err, io.EOF) {
+			// the rest of the source is a hole
+			if offset, err = source.Seek(0, io.SeekEnd); err != nil {
+				return fmt.Errorf("cannot seek source file %s: %w", source.Name(), err)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if offset, err = copyRegion(ctx, source, destination, start, end); err != nil {
+			return err
+		}
+		if end < 0 {
+			break
+		}
+	}
+
+	// the holes at the end of the source are not written
+	if err := destination.Truncate(offset); err != nil {
+		return fmt.Errorf("cannot truncate file %s: %w", destination.Name(), err)
+	}
+	return nil
+}
+
+// bufferedRegion returns a regionCopier that reads and writes through a buffer of size bytes,
+// the blocks of zeros are skipped if zeros is true.
+func bufferedRegion(size int, zeros bool) regionCopier {
+	buf := make([]byte, size)
+	return func(ctx context.Context, source, destination File, start, end int64) (int64, error) {
+		if _, err := source.Seek(start, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("cannot seek source file %s: %w", source.Name(), err)
+		}
+		w := &sparseWriter{file: destination, offset: start, zeros: zeros}
+		var r io.Reader = source
+		if end >= 0 {
+			r = io.LimitReader(source, end-start)
+		}
+		for {
+			if err := ctx.Err(); err != nil {
+				return 0, fmt.Errorf("copy of %s aborted: %w", source.Name(), err)
+			}
+			n, err := r.Read(buf)
+			if err != nil && err != io.EOF {
+				return 0, fmt.Errorf("cannot read from buffer for file %s: %w", source.Name(), err)
+			}
+			if n == 0 {
+				return w.offset, nil
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return 0, fmt.Errorf("cannot write in buffer for file %s: %w", destination.Name(), err)
+			}
+		}
+	}
+}
+
+// nextData returns the data region of the file that starts at or after offset, end is -1 if the region goes on
+// to the end of the file. The error is io.EOF if there is no data after offset. When the holes cannot be detected,
+// the whole rest of the file is a data region, such as out of the local disk.
+func nextData(file File, offset int64) (start, end int64, err error) {
+	f, ok := file.(*os.File)
+	if !ok {
+		return offset, -1, nil
+	}
+	start, err = seekData(f, offset)
+	if errors.Is(err, errHolesUnsupported) {
+		return offset, -1, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err = seekHole(f, start)
+	if err != nil {
+		return start, -1, nil
+	}
+	return start, end, nil
+}
+
+// errHolesUnsupported is the error of the detection of holes when the platform or the file system doesn't support it.
+var errHolesUnsupported = errors.New("holes not supported")
+
+// sparseWriter writes at offset in file, and skips the blocks of zeros if zeros is true.
+type sparseWriter struct {
+	file   File
+	offset int64
+	zeros  bool
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	if !w.zeros || !isZero(p) {
+		if n, err := w.file.WriteAt(p, w.offset); err != nil {
+			w.offset += int64(n)
+			return n, err
+		}
+	}
+	w.offset += int64(len(p))
+	return len(p), nil
+}
+
+// isZero returns true if b only contains zeros.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// the whence values of lseek that find the data and the holes of a sparse file
+const (
+	seekDataWhence = 3
+	seekHoleWhence = 4
+)
+
+// seekData returns the offset of the first data at or after offset, the error is io.EOF if there is none.
+func seekData(f *os.File, offset int64) (int64, error) {
+	n, err := f.Seek(offset, seekDataWhence)
+	switch {
+	case errors.Is(err, syscall.ENXIO):
+		return 0, io.EOF
+	case errors.Is(err, syscall.EINVAL), errors.Is(err, syscall.EOPNOTSUPP):
+		return 0, errHolesUnsupported
+	case err != nil:
+		return 0, fmt.Errorf("cannot seek data of file %s: %w", f.Name(), err)
+	}
+	return n, nil
+}
+
+// seekHole returns the offset of the first hole at or after offset, the end of the file counts as a hole.
+func seekHole(f *os.File, offset int64) (int64, error) {
+	n, err := f.Seek(offset, seekHoleWhence)
+	if err != nil {
+		return 0, fmt.Errorf("cannot seek hole of file %s: %w", f.Name(), err)
+	}
+	return n, nil
+}
+
+// AllocatedSize returns the number of bytes of the disk allocated to the file described by info,
+// which is less than its size for a sparse file.
+func AllocatedSize(info os.FileInfo) (int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return st.Blocks * 512, true
+}
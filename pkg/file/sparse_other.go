@@ -0,0 +1,21 @@
+//go:build !linux
+
+package file
+
+import "os"
+
+// seekData returns the offset of the first data at or after offset, the holes are not detected on this platform.
+func seekData(*os.File, int64) (int64, error) {
+	return 0, errHolesUnsupported
+}
+
+// seekHole returns the offset of the first hole at or after offset, the holes are not detected on this platform.
+func seekHole(*os.File, int64) (int64, error) {
+	return 0, errHolesUnsupported
+}
+
+// AllocatedSize returns the number of bytes of the disk allocated to the file described by info,
+// it is unknown on this platform.
+func AllocatedSize(os.FileInfo) (int64, bool) {
+	return 0, false
+}
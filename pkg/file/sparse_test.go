@@ -0,0 +1,79 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestBasicCopy_CopySparse(t *testing.T) {
+	const size = 1024 * 1024
+
+	tests := []struct {
+		name string
+		// explicitZeros writes the zeros of the source instead of leaving holes
+		explicitZeros bool
+		sparse        bool
+		wantSparse    bool
+	}{
+		{"holes kept", false, false, true},
+		{"zeros written", true, false, false},
+		{"zeros skipped", true, true, true},
+	}
+	for _, tt := range tests {
+		for _, atomic := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s, atomic %v", tt.name, atomic), func(t *testing.T) {
+				dir := t.TempDir()
+				source, destination := path.Join(dir, "source"), path.Join(dir, "destination")
+				content := make([]byte, size)
+				copy(content[size/2:], "data")
+				f, err := os.Create(source)
+				if err != nil {
+					t.Fatalf("cannot create file for test: %v", err)
+				}
+				if tt.explicitZeros {
+					_, err = f.Write(content)
+				} else {
+					_, err = f.WriteAt([]byte("data"), size/2)
+					if err == nil {
+						err = f.Truncate(size)
+					}
+				}
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				if err != nil {
+					t.Fatalf("cannot write file for test: %v", err)
+				}
+
+				c := BasicCopy{Atomic: atomic, Sparse: tt.sparse}
+				if err := c.Copy(source, destination, false); err != nil {
+					t.Fatalf("Copy() unexpected error: %v", err)
+				}
+				got, err := os.ReadFile(destination)
+				if err != nil || !bytes.Equal(got, content) {
+					t.Fatalf("Copy() destination differs from the source, error = %v", err)
+				}
+
+				info, err := os.Stat(destination)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				allocated, ok := AllocatedSize(info)
+				if !ok {
+					t.Skip("the allocated size is unknown on this platform")
+				}
+				if sourceInfo, _ := os.Stat(source); !tt.explicitZeros {
+					if n, _ := AllocatedSize(sourceInfo); n >= size {
+						t.Skip("the file system doesn't support sparse files")
+					}
+				}
+				if sparse := allocated < size; sparse != tt.wantSparse {
+					t.Errorf("Copy() destination allocated %d bytes of %d, want sparse %v", allocated, size, tt.wantSparse)
+				}
+			})
+		}
+	}
+}
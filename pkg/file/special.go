@@ -0,0 +1,93 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrSpecialFile is the error of a copy whose source is a named pipe, a socket or a device node,
+// whose content cannot be copied.
+var ErrSpecialFile = errors.New("special file")
+
+// IsSpecial returns true if mode is the mode of a named pipe, a socket or a device node.
+func IsSpecial(mode os.FileMode) bool {
+	return mode&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeCharDevice) != 0
+}
+
+// SpecialChanged returns true if the destination special file differs from the source: their types differ,
+// or they are device nodes of different devices.
+func SpecialChanged(sourceFile, destinationFile string) (bool, error) {
+	return SpecialChangedFS(OSFS{}, sourceFile, OSFS{}, destinationFile)
+}
+
+// SpecialChangedFS returns true if the destination special file of destinationFS differs from the source of sourceFS
+// like SpecialChanged.
+func SpecialChangedFS(sourceFS FS, sourceFile string, destinationFS FS, destinationFile string) (bool, error) {
+	sourceInfo, err := sourceFS.Lstat(sourceFile)
+	if err != nil {
+		return false, fmt.Errorf("error getting stats for file %s: %w", sourceFile, err)
+	}
+	destinationInfo, err := destinationFS.Lstat(destinationFile)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting stats for file %s: %w", destinationFile, err)
+	}
+	if sourceInfo.Mode().Type() != destinationInfo.Mode().Type() {
+		return true, nil
+	}
+	sourceDevice, _ := device(sourceInfo)
+	destinationDevice, _ := device(destinationInfo)
+	return sourceDevice != destinationDevice, nil
+}
+
+// device returns the device a device node described by info stands for.
+func device(info os.FileInfo) (uint64, bool) {
+	if m, ok := info.(*memInfo); ok {
+		return m.dev, true
+	}
+	return deviceNumber(info)
+}
+
+// CreateSpecial recreates the named pipe, the socket or the device node sourceFile at destinationFile with mknod,
+// through a temporary node renamed over an existing destinationFile, and applies the preserved attributes.
+// Creating a device node usually requires the privileges of root.
+func CreateSpecial(sourceFile, destinationFile string, preserve Attributes) error {
+	return CreateSpecialFS(OSFS{}, sourceFile, OSFS{}, destinationFile, preserve)
+}
+
+// CreateSpecialFS recreates the special file sourceFile of sourceFS at the destinationFile of destinationFS
+// like CreateSpecial, the destinationFS must be a SpecialFS.
+func CreateSpecialFS(sourceFS FS, sourceFile string, destinationFS FS, destinationFile string, preserve Attributes) error {
+	sfs, ok := destinationFS.(SpecialFS)
+	if !ok {
+		return fmt.Errorf("cannot recreate special file %s: not supported by the destination file system", sourceFile)
+	}
+	info, err := sourceFS.Lstat(sourceFile)
+	if err != nil {
+		return fmt.Errorf("error getting stats for file %s: %w", sourceFile, err)
+	}
+	dev, _ := device(info)
+	if !IsSpecial(info.Mode()) {
+		return fmt.Errorf("cannot recreate %s: not a special file", sourceFile)
+	}
+
+	temp := tempFileName(destinationFile, "special")
+	if err := destinationFS.Remove(temp); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove temporary file %s: %w", temp, err)
+	}
+	if err := sfs.Mknod(temp, info.Mode(), dev); err != nil {
+		return fmt.Errorf("cannot create special file %s: %w", destinationFile, err)
+	}
+	if err := CopyMetadataFS(sourceFS, sourceFile, destinationFS, temp, info, preserve); err != nil {
+		destinationFS.Remove(temp)
+		return err
+	}
+	if err := destinationFS.Rename(temp, destinationFile); err != nil {
+		destinationFS.Remove(temp)
+		return fmt.Errorf("cannot rename temporary file %s to %s: %w", temp, destinationFile, err)
+	}
+	return nil
+}
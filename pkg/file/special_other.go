@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// deviceNumber returns the device a device node of the local disk stands for, it is unknown on this platform.
+func deviceNumber(os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// Mknod creates a special file, it is not supported on this platform.
+func (OSFS) Mknod(name string, _ fs.FileMode, _ uint64) error {
+	return &os.PathError{Op: "mknod", Path: name, Err: errors.New("not supported on this platform")}
+}
@@ -0,0 +1,54 @@
+//go:build linux || darwin
+
+package file
+
+import (
+	"errors"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestBasicCopy_CopySpecialFile(t *testing.T) {
+	dir := t.TempDir()
+	fifo := path.Join(dir, "fifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Fatalf("cannot create fifo for test: %v", err)
+	}
+
+	// the copy fails instead of waiting for a writer
+	ba := BasicCopy{Atomic: true}
+	if err := ba.Copy(fifo, path.Join(dir, "copy"), false); !errors.Is(err, ErrSpecialFile) {
+		t.Errorf("Copy() error = %v, want ErrSpecialFile", err)
+	}
+}
+
+func TestCreateSpecial(t *testing.T) {
+	dir := t.TempDir()
+	fifo, destination := path.Join(dir, "fifo"), path.Join(dir, "destination")
+	if err := syscall.Mkfifo(fifo, 0640); err != nil {
+		t.Fatalf("cannot create fifo for test: %v", err)
+	}
+	if err := os.WriteFile(destination, []byte("file"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+
+	changed, err := SpecialChanged(fifo, destination)
+	if err != nil || !changed {
+		t.Errorf("SpecialChanged() = %v, %v, want true", changed, err)
+	}
+	if err := CreateSpecial(fifo, destination, Mode); err != nil {
+		t.Fatalf("CreateSpecial() unexpected error: %v", err)
+	}
+	info, err := os.Lstat(destination)
+	if err != nil || info.Mode() != os.ModeNamedPipe|0640 {
+		t.Errorf("CreateSpecial() destination = %v, %v, want a named pipe", info.Mode(), err)
+	}
+	if changed, err := SpecialChanged(fifo, destination); err != nil || changed {
+		t.Errorf("SpecialChanged() = %v, %v, want false", changed, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("CreateSpecial() left %d entries, want 2", len(entries))
+	}
+}
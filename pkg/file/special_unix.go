@@ -0,0 +1,38 @@
+//go:build linux || darwin
+
+package file
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// deviceNumber returns the device a device node of the local disk stands for.
+func deviceNumber(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Rdev), true
+}
+
+func (OSFS) Mknod(name string, mode fs.FileMode, dev uint64) error {
+	m := uint32(mode.Perm())
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		m |= syscall.S_IFIFO
+	case mode&fs.ModeSocket != 0:
+		m |= syscall.S_IFSOCK
+	case mode&fs.ModeCharDevice != 0:
+		m |= syscall.S_IFCHR
+	case mode&fs.ModeDevice != 0:
+		m |= syscall.S_IFBLK
+	default:
+		return &os.PathError{Op: "mknod", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := syscall.Mknod(name, m, int(dev)); err != nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
+	}
+	return nil
+}
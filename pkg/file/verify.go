@@ -0,0 +1,104 @@
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc64"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// HashAlgorithm is a hash function comparing the content of files.
+type HashAlgorithm string
+
+const (
+	// SHA256 is the SHA-256 cryptographic hash.
+	SHA256 = HashAlgorithm("sha256")
+	// SHA512 is the SHA-512 cryptographic hash, faster than SHA-256 on 64-bit CPUs without SHA extensions.
+	SHA512 = HashAlgorithm("sha512")
+	// CRC64 is the CRC-64 checksum with the ECMA polynomial, a fast non cryptographic hash that detects corruptions
+	// but not deliberate modifications.
+	CRC64 = HashAlgorithm("crc64")
+	// BLAKE2b is the BLAKE2b-512 cryptographic hash, usually faster than SHA-256 and SHA-512 without SHA extensions.
+	BLAKE2b = HashAlgorithm("blake2b")
+	// XXHash is the XXH64 hash, a fast non cryptographic hash that detects corruptions but not deliberate modifications.
+	XXHash = HashAlgorithm("xxhash")
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// ParseHashAlgorithm parses the name of a hash algorithm: sha256, sha512, blake2b, crc64 or xxhash.
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	switch a := HashAlgorithm(name); a {
+	case SHA256, SHA512, BLAKE2b, CRC64, XXHash:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown hash algorithm %q", name)
+	}
+}
+
+// New returns a new hash computing the algorithm, SHA-256 if the algorithm is empty.
+func (a HashAlgorithm) New() hash.Hash {
+	switch a {
+	case SHA512:
+		return sha512.New()
+	case BLAKE2b:
+		// the error is only returned for a key longer than 64 bytes
+		h, _ := blake2b.New512(nil)
+		return h
+	case CRC64:
+		return crc64.New(crc64Table)
+	case XXHash:
+		return newXXHash64()
+	default:
+		return sha256.New()
+	}
+}
+
+// MismatchError is returned when the content of a destination file differs from its source after a copy.
+type MismatchError struct {
+	Source, Destination string
+	Algorithm           HashAlgorithm
+	SourceSum           []byte
+	DestinationSum      []byte
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("content of %s differs from %s: %s %x != %x", e.Destination, e.Source, e.Algorithm, e.DestinationSum, e.SourceSum)
+}
+
+// Verify hashes both files with the algorithm and returns a *MismatchError if their content differs.
+func Verify(sourceFile, destinationFile string, algorithm HashAlgorithm) error {
+	return VerifyFS(OSFS{}, sourceFile, OSFS{}, destinationFile, algorithm)
+}
+
+// VerifyFS hashes the sourceFile of sourceFS and the destinationFile of destinationFS like Verify.
+func VerifyFS(sourceFS FS, sourceFile string, destinationFS FS, destinationFile string, algorithm HashAlgorithm) error {
+	sourceSum, err := HashFS(sourceFS, sourceFile, algorithm)
+	if err != nil {
+		return err
+	}
+	destinationSum, err := HashFS(destinationFS, destinationFile, algorithm)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(sourceSum, destinationSum) {
+		return &MismatchError{
+			Source:         sourceFile,
+			Destination:    destinationFile,
+			Algorithm:      algorithm,
+			SourceSum:      sourceSum,
+			DestinationSum: destinationSum,
+		}
+	}
+	return nil
+}
+
+// HashFile returns the hash of the content of the file name computed with the algorithm.
+func HashFile(name string, algorithm HashAlgorithm) ([]byte, error) {
+	return HashFS(OSFS{}, name, algorithm)
+}
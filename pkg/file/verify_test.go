@@ -0,0 +1,76 @@
+package file
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	source, same, different := path.Join(dir, "source"), path.Join(dir, "same"), path.Join(dir, "different")
+	for name, content := range map[string]string{source: "content", same: "content", different: "CONTENT"} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("cannot create file for test: %v", err)
+		}
+	}
+
+	for _, algorithm := range []HashAlgorithm{SHA256, SHA512, BLAKE2b, CRC64, XXHash} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			if err := Verify(source, same, algorithm); err != nil {
+				t.Errorf("Verify() unexpected error: %v", err)
+			}
+
+			err := Verify(source, different, algorithm)
+			var mismatchErr *MismatchError
+			if !errors.As(err, &mismatchErr) {
+				t.Fatalf("Verify() error = %v, want a *MismatchError", err)
+			}
+			if mismatchErr.Algorithm != algorithm || len(mismatchErr.SourceSum) != algorithm.New().Size() {
+				t.Errorf("Verify() error = %+v", mismatchErr)
+			}
+
+			if err := Verify(source, path.Join(dir, "missing"), algorithm); err == nil || errors.As(err, &mismatchErr) {
+				t.Errorf("Verify() error = %v, want a read error", err)
+			}
+		})
+	}
+}
+
+func TestHashAlgorithm_New(t *testing.T) {
+	tests := []struct {
+		algorithm HashAlgorithm
+		content   string
+		want      string
+	}{
+		{XXHash, "", "ef46db3751d8e999"},
+		{XXHash, "abc", "44bc2cf5ad770999"},
+		// longer than a round of 32 bytes, with a tail of 8, 4 and single bytes
+		{XXHash, "Nobody inspects the spammish repetition", "fbcea83c8a378bf1"},
+		{BLAKE2b, "abc", "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm)+" "+tt.content, func(t *testing.T) {
+			h := tt.algorithm.New()
+			// the content is written in two parts to check the buffering
+			h.Write([]byte(tt.content[:len(tt.content)/3]))
+			h.Write([]byte(tt.content[len(tt.content)/3:]))
+			if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+				t.Errorf("New() sum = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHashAlgorithm(t *testing.T) {
+	for _, name := range []string{"sha256", "sha512", "blake2b", "crc64", "xxhash"} {
+		if a, err := ParseHashAlgorithm(name); err != nil || string(a) != name {
+			t.Errorf("ParseHashAlgorithm(%q) = %v, %v", name, a, err)
+		}
+	}
+	if _, err := ParseHashAlgorithm("md5"); err == nil {
+		t.Errorf("ParseHashAlgorithm() expected an error for an unknown algorithm")
+	}
+}
@@ -0,0 +1,127 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errXattrUnsupported is returned when the file system, or the system, doesn't support the extended attributes.
+var errXattrUnsupported = errors.New("extended attributes not supported")
+
+// xattrAttribute returns the attribute preserving the extended attribute name, 0 if it is never preserved.
+func xattrAttribute(name string) Attributes {
+	switch {
+	case name == "system.posix_acl_access" || name == "system.posix_acl_default":
+		return ACLs
+	case strings.HasPrefix(name, "security."):
+		return SecurityLabels
+	case strings.HasPrefix(name, "user."):
+		return Xattrs
+	case strings.HasPrefix(name, "trusted."):
+		return TrustedXattrs
+	}
+	return 0
+}
+
+// readXattrs returns the extended attributes of the entry name of fsys selected by attrs, without following symlinks.
+// An entry on a file system without extended attributes has none.
+func readXattrs(fsys FS, name string, attrs Attributes) (map[string][]byte, error) {
+	xfs, ok := fsys.(XattrFS)
+	if !ok {
+		return nil, nil
+	}
+	names, err := xfs.ListXattrs(name)
+	if errors.Is(err, errXattrUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot list extended attributes of %s: %w", name, err)
+	}
+
+	xattrs := make(map[string][]byte, len(names))
+	for _, n := range names {
+		if a := xattrAttribute(n); a == 0 || !attrs.Has(a) {
+			continue
+		}
+		value, err := xfs.GetXattr(name, n)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read extended attribute %s of %s: %w", n, name, err)
+		}
+		xattrs[n] = value
+	}
+	return xattrs, nil
+}
+
+// CopyXattrs replaces the extended attributes of the destination entry selected by attrs with the ones of the sourceFile,
+// the ones the sourceFile doesn't have are removed. The symlinks are not followed.
+func CopyXattrs(sourceFile, destination string, attrs Attributes) error {
+	return CopyXattrsFS(OSFS{}, sourceFile, OSFS{}, destination, attrs)
+}
+
+// CopyXattrsFS copies the extended attributes of the sourceFile of sourceFS to the destination entry of destinationFS
+// like CopyXattrs. Nothing is copied if the destinationFS is not an XattrFS.
+func CopyXattrsFS(sourceFS FS, sourceFile string, destinationFS FS, destination string, attrs Attributes) error {
+	xfs, ok := destinationFS.(XattrFS)
+	if attrs&ExtendedAttributes == 0 || !ok {
+		return nil
+	}
+	source, err := readXattrs(sourceFS, sourceFile, attrs)
+	if err != nil {
+		return err
+	}
+	current, err := readXattrs(destinationFS, destination, attrs)
+	if err != nil {
+		return err
+	}
+
+	for name := range current {
+		if _, ok := source[name]; ok {
+			continue
+		}
+		if err := xfs.RemoveXattr(destination, name); err != nil {
+			return fmt.Errorf("cannot remove extended attribute %s of %s: %w", name, destination, err)
+		}
+	}
+	for name, value := range source {
+		if old, ok := current[name]; ok && bytes.Equal(old, value) {
+			continue
+		}
+		if err := xfs.SetXattr(destination, name, value); err != nil {
+			return fmt.Errorf("cannot set extended attribute %s of %s: %w", name, destination, err)
+		}
+	}
+	return nil
+}
+
+// XattrsChanged returns true if the extended attributes selected by attrs differ between the sourceFile and the destination.
+func XattrsChanged(sourceFile, destination string, attrs Attributes) (bool, error) {
+	return XattrsChangedFS(OSFS{}, sourceFile, OSFS{}, destination, attrs)
+}
+
+// XattrsChangedFS returns true if the extended attributes selected by attrs differ between the sourceFile of sourceFS
+// and the destination of destinationFS.
+func XattrsChangedFS(sourceFS FS, sourceFile string, destinationFS FS, destination string, attrs Attributes) (bool, error) {
+	if attrs&ExtendedAttributes == 0 {
+		return false, nil
+	}
+	source, err := readXattrs(sourceFS, sourceFile, attrs)
+	if err != nil {
+		return false, err
+	}
+	current, err := readXattrs(destinationFS, destination, attrs)
+	if err != nil {
+		return false, err
+	}
+
+	if len(source) != len(current) {
+		return true, nil
+	}
+	for name, value := range source {
+		if old, ok := current[name]; !ok || !bytes.Equal(old, value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
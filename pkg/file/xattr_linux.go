@@ -0,0 +1,121 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// xattrError wraps the errors of the file systems without extended attributes with errXattrUnsupported.
+func xattrError(op string, errno syscall.Errno) error {
+	if errno == syscall.ENOTSUP || errno == syscall.ENOSYS {
+		return fmt.Errorf("%s: %w", op, errXattrUnsupported)
+	}
+	return fmt.Errorf("%s: %w", op, errno)
+}
+
+// listXattrs returns the names of the extended attributes of the entry path, without following symlinks.
+func listXattrs(path string) ([]string, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		size, _, errno := syscall.Syscall(syscall.SYS_LLISTXATTR, uintptr(unsafe.Pointer(p)), 0, 0)
+		if errno != 0 {
+			return nil, xattrError("llistxattr", errno)
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size)
+		n, _, errno := syscall.Syscall(syscall.SYS_LLISTXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&buf[0])), size)
+		if errno == syscall.ERANGE {
+			// an attribute was added in between
+			continue
+		}
+		if errno != 0 {
+			return nil, xattrError("llistxattr", errno)
+		}
+
+		var names []string
+		for _, name := range bytes.Split(buf[:n], []byte{0}) {
+			if len(name) > 0 {
+				names = append(names, string(name))
+			}
+		}
+		return names, nil
+	}
+}
+
+// getXattr returns the value of the extended attribute name of the entry path, without following symlinks.
+func getXattr(path, name string) ([]byte, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		size, _, errno := syscall.Syscall6(syscall.SYS_LGETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)), 0, 0, 0, 0)
+		if errno != 0 {
+			return nil, xattrError("lgetxattr", errno)
+		}
+		if size == 0 {
+			return []byte{}, nil
+		}
+		buf := make([]byte, size)
+		n, _, errno := syscall.Syscall6(syscall.SYS_LGETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)),
+			uintptr(unsafe.Pointer(&buf[0])), size, 0, 0)
+		if errno == syscall.ERANGE {
+			// the value grew in between
+			continue
+		}
+		if errno != 0 {
+			return nil, xattrError("lgetxattr", errno)
+		}
+		return buf[:n], nil
+	}
+}
+
+// setXattr sets the extended attribute name of the entry path to value, without following symlinks.
+func setXattr(path, name string, value []byte) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	a, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var v unsafe.Pointer
+	if len(value) > 0 {
+		v = unsafe.Pointer(&value[0])
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_LSETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)),
+		uintptr(v), uintptr(len(value)), 0, 0)
+	if errno != 0 {
+		return xattrError("lsetxattr", errno)
+	}
+	return nil
+}
+
+// removeXattr removes the extended attribute name of the entry path, without following symlinks.
+func removeXattr(path, name string) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	a, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_LREMOVEXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)), 0)
+	if errno != 0 && errno != syscall.ENODATA {
+		return xattrError("lremovexattr", errno)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package file
+
+// listXattrs returns the names of the extended attributes of the entry path, they are not supported on this platform.
+func listXattrs(string) ([]string, error) {
+	return nil, errXattrUnsupported
+}
+
+// getXattr returns the value of an extended attribute, they are not supported on this platform.
+func getXattr(string, string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
+
+// setXattr sets an extended attribute, they are not supported on this platform.
+func setXattr(string, string, []byte) error {
+	return errXattrUnsupported
+}
+
+// removeXattr removes an extended attribute, they are not supported on this platform.
+func removeXattr(string, string) error {
+	return errXattrUnsupported
+}
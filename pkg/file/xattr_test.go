@@ -0,0 +1,118 @@
+//go:build linux
+
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// posixACL returns the value of a system.posix_acl_access attribute granting read to the user uid besides the mode 0644.
+func posixACL(uid uint32) []byte {
+	entries := []struct {
+		tag, perm uint16
+		id        uint32
+	}{
+		{0x01, 6, 0xffffffff}, // user owner
+		{0x02, 4, uid},        // named user
+		{0x04, 4, 0xffffffff}, // group owner
+		{0x10, 4, 0xffffffff}, // mask
+		{0x20, 4, 0xffffffff}, // other
+	}
+	b := binary.LittleEndian.AppendUint32(nil, 2)
+	for _, e := range entries {
+		b = binary.LittleEndian.AppendUint16(b, e.tag)
+		b = binary.LittleEndian.AppendUint16(b, e.perm)
+		b = binary.LittleEndian.AppendUint32(b, e.id)
+	}
+	return b
+}
+
+// setXattrs sets the extended attributes of name for test, the test is skipped if the file system doesn't support them.
+func setXattrs(t *testing.T, name string, xattrs map[string][]byte) {
+	t.Helper()
+	for n, value := range xattrs {
+		if err := setXattr(name, n, value); err != nil {
+			if errors.Is(err, errXattrUnsupported) {
+				t.Skipf("extended attribute %s not supported: %v", n, err)
+			}
+			t.Fatalf("cannot set extended attribute for test: %v", err)
+		}
+	}
+}
+
+func TestCopyXattrs(t *testing.T) {
+	tests := []struct {
+		name     string
+		preserve Attributes
+		want     map[string][]byte
+	}{
+		{"nothing", DefaultAttributes, map[string][]byte{"user.stale": []byte("old")}},
+		{"user namespace", Xattrs, map[string][]byte{"user.mime_type": []byte("text/plain"), "user.empty": {}}},
+		{"acls", ACLs, map[string][]byte{"user.stale": []byte("old"), "system.posix_acl_access": posixACL(1000)}},
+		{"all", Xattrs | ACLs, map[string][]byte{"user.mime_type": []byte("text/plain"), "user.empty": {}, "system.posix_acl_access": posixACL(1000)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source, destination := path.Join(dir, "source"), path.Join(dir, "destination")
+			for _, name := range []string{source, destination} {
+				if err := os.WriteFile(name, []byte("content"), 0644); err != nil {
+					t.Fatalf("cannot create file for test: %v", err)
+				}
+			}
+			setXattrs(t, source, map[string][]byte{"user.mime_type": []byte("text/plain"), "user.empty": {}, "system.posix_acl_access": posixACL(1000)})
+			setXattrs(t, destination, map[string][]byte{"user.stale": []byte("old")})
+
+			if changed, err := XattrsChanged(source, destination, tt.preserve); err != nil || changed != (tt.preserve&ExtendedAttributes != 0) {
+				t.Errorf("XattrsChanged() = %v, %v before the copy", changed, err)
+			}
+			if err := CopyXattrs(source, destination, tt.preserve); err != nil {
+				t.Fatalf("CopyXattrs() unexpected error: %v", err)
+			}
+			if changed, err := XattrsChanged(source, destination, tt.preserve); err != nil || changed {
+				t.Errorf("XattrsChanged() = %v, %v after the copy, want false", changed, err)
+			}
+			got, err := readXattrs(OSFS{}, destination, ExtendedAttributes)
+			if err != nil {
+				t.Fatalf("cannot read extended attributes: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CopyXattrs() destination extended attributes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicCopy_CopyXattrs(t *testing.T) {
+	dir := t.TempDir()
+	source := path.Join(dir, "source")
+	if err := os.WriteFile(source, []byte("content"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+	xattrs := map[string][]byte{"user.checksum": []byte("42")}
+	setXattrs(t, source, xattrs)
+	link := path.Join(dir, "link")
+	if err := os.Symlink("source", link); err != nil {
+		t.Fatalf("cannot create symlink for test: %v", err)
+	}
+
+	for _, atomic := range []bool{true, false} {
+		c := &BasicCopy{Preserve: DefaultAttributes | Xattrs, Atomic: atomic}
+		destination := path.Join(dir, "sub", "destination")
+		if err := c.Copy(source, destination, false); err != nil {
+			t.Fatalf("Copy() unexpected error: %v", err)
+		}
+		if got, err := readXattrs(OSFS{}, destination, Xattrs); err != nil || !reflect.DeepEqual(got, xattrs) {
+			t.Errorf("Copy() atomic %v extended attributes = %q, %v, want %q", atomic, got, err, xattrs)
+		}
+		// the user namespace is not allowed on symlinks, the symlink has none to copy
+		if err := c.Copy(link, path.Join(dir, "sub", "link"), true); err != nil {
+			t.Errorf("Copy() symlink unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package file
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// The primes of the XXH64 algorithm, variables so their sums wrap around like the ones of the accumulators.
+var (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 computes the XXH64 hash with a zero seed, a fast non cryptographic hash reading 32 bytes per round.
+type xxhash64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	// buf holds the bytes written since the last full round, n of them are used.
+	buf [32]byte
+	n   int
+}
+
+// newXXHash64 returns a new XXH64 hash, its sum is the hash in big-endian order.
+func newXXHash64() hash.Hash64 {
+	h := &xxhash64{}
+	h.Reset()
+	return h
+}
+
+func (h *xxhash64) Reset() {
+	h.v1 = xxPrime1 + xxPrime2
+	h.v2 = xxPrime2
+	h.v3 = 0
+	h.v4 = -xxPrime1
+	h.total = 0
+	h.n = 0
+}
+
+func (h *xxhash64) Size() int {
+	return 8
+}
+
+func (h *xxhash64) BlockSize() int {
+	return 32
+}
+
+func (h *xxhash64) Write(b []byte) (int, error) {
+	written := len(b)
+	h.total += uint64(written)
+
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], b)
+		h.n += c
+		b = b[c:]
+		if h.n < len(h.buf) {
+			return written, nil
+		}
+		h.rounds(h.buf[:])
+		h.n = 0
+	}
+	full := len(b) &^ 31
+	h.rounds(b[:full])
+	h.n = copy(h.buf[:], b[full:])
+	return written, nil
+}
+
+// rounds mixes the blocks of 32 bytes of b into the accumulators.
+func (h *xxhash64) rounds(b []byte) {
+	for ; len(b) >= 32; b = b[32:] {
+		h.v1 = xxRound(h.v1, binary.LittleEndian.Uint64(b))
+		h.v2 = xxRound(h.v2, binary.LittleEndian.Uint64(b[8:]))
+		h.v3 = xxRound(h.v3, binary.LittleEndian.Uint64(b[16:]))
+		h.v4 = xxRound(h.v4, binary.LittleEndian.Uint64(b[24:]))
+	}
+}
+
+func (h *xxhash64) Sum64() uint64 {
+	var sum uint64
+	if h.total >= 32 {
+		sum = bits.RotateLeft64(h.v1, 1) + bits.RotateLeft64(h.v2, 7) + bits.RotateLeft64(h.v3, 12) + bits.RotateLeft64(h.v4, 18)
+		sum = xxMergeRound(sum, h.v1)
+		sum = xxMergeRound(sum, h.v2)
+		sum = xxMergeRound(sum, h.v3)
+		sum = xxMergeRound(sum, h.v4)
+	} else {
+		sum = xxPrime5
+	}
+	sum += h.total
+
+	b := h.buf[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		sum ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		sum = bits.RotateLeft64(sum, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		sum ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		sum = bits.RotateLeft64(sum, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		sum ^= uint64(c) * xxPrime5
+		sum = bits.RotateLeft64(sum, 11) * xxPrime1
+	}
+
+	sum ^= sum >> 33
+	sum *= xxPrime2
+	sum ^= sum >> 29
+	sum *= xxPrime3
+	sum ^= sum >> 32
+	return sum
+}
+
+func (h *xxhash64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, h.Sum64())
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	return bits.RotateLeft64(acc, 31) * xxPrime1
+}
+
+func xxMergeRound(acc, v uint64) uint64 {
+	acc ^= xxRound(0, v)
+	return acc*xxPrime1 + xxPrime4
+}
@@ -0,0 +1,113 @@
+package filter
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// DefaultIgnoreFile is the name of the per-directory ignore files.
+const DefaultIgnoreFile = ".syncignore"
+
+// Filter decides which entries of a source tree are synchronized.
+// A nil Filter excludes nothing.
+type Filter struct {
+	rules      []Rule
+	ignoreFile string
+}
+
+// New initializes a filter with ordered rules relative to the root of the tree.
+// When several rules match an entry the last one wins, as in a gitignore file.
+// If ignoreFile is not empty, the rules of the ignore files with that name found in the source directories
+// apply to the entries of their directory and sub directories, with the rules given to New taking precedence.
+func New(ignoreFile string, rules ...Rule) *Filter {
+	return &Filter{rules: rules, ignoreFile: ignoreFile}
+}
+
+// IgnoreFile returns the name of the per-directory ignore files, it is empty if they are disabled.
+func (f *Filter) IgnoreFile() string {
+	if f == nil {
+		return ""
+	}
+	return f.ignoreFile
+}
+
+// OpenFunc opens the file name for reading.
+type OpenFunc func(name string) (io.ReadCloser, error)
+
+// Scope is the set of rules that apply to the entries of a directory.
+type Scope struct {
+	filter *Filter
+	// dir is the path of the directory relative to the root of the tree.
+	dir    string
+	rules  []Rule
+	parent *Scope
+	open   OpenFunc
+}
+
+// Root returns the scope of the root directory of the tree, sourceDir is the root directory in the source.
+func (f *Filter) Root(sourceDir string) (*Scope, error) {
+	return f.RootFS(sourceDir, openFile)
+}
+
+// RootFS returns the scope of the root directory of the tree like Root, the ignore files of the scope
+// and of its children are opened with open, such as the Open method of a file system.
+func (f *Filter) RootFS(sourceDir string, open OpenFunc) (*Scope, error) {
+	return f.newScope(nil, "", sourceDir, open)
+}
+
+// Child returns the scope of the sub directory name, sourceDir is the sub directory in the source.
+func (s *Scope) Child(name, sourceDir string) (*Scope, error) {
+	return s.filter.newScope(s, path.Join(s.dir, name), sourceDir, s.open)
+}
+
+func (f *Filter) newScope(parent *Scope, dir, sourceDir string, open OpenFunc) (*Scope, error) {
+	s := &Scope{filter: f, dir: dir, parent: parent, open: open}
+	if f == nil || f.ignoreFile == "" {
+		return s, nil
+	}
+
+	rules, err := readRulesFile(path.Join(sourceDir, f.ignoreFile), open)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+	s.rules = rules
+	return s, nil
+}
+
+// Excluded returns true if the entry name of the scope directory is excluded.
+func (s *Scope) Excluded(name string, isDir bool) bool {
+	if s.filter == nil {
+		return false
+	}
+
+	relPath := path.Join(s.dir, name)
+	if excluded, ok := lastMatch(s.filter.rules, relPath, isDir); ok {
+		return excluded
+	}
+
+	for scope := s; scope != nil; scope = scope.parent {
+		scopePath := relPath
+		if scope.dir != "" {
+			scopePath = relPath[len(scope.dir)+1:]
+		}
+		if excluded, ok := lastMatch(scope.rules, scopePath, isDir); ok {
+			return excluded
+		}
+	}
+	return false
+}
+
+// lastMatch returns the verdict of the last rule matching relPath, ok is false if no rule matches.
+func lastMatch(rules []Rule, relPath string, isDir bool) (excluded bool, ok bool) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].Match(relPath, isDir) {
+			return rules[i].exclude, true
+		}
+	}
+	return false, false
+}
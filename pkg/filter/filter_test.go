@@ -0,0 +1,76 @@
+package filter
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestScope_Excluded(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "")
+	if err != nil {
+		t.Fatal("cannot create temp dir for test")
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(path.Join(dir, "dir_a"), os.ModePerm); err != nil {
+		t.Fatalf("cannot create dir for test: %v", err)
+	}
+	if err := os.WriteFile(path.Join(dir, DefaultIgnoreFile), []byte("*.tmp\n/file_b\n"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+	if err := os.WriteFile(path.Join(dir, "dir_a", DefaultIgnoreFile), []byte("!keep.tmp\nfile_a\n"), 0644); err != nil {
+		t.Fatalf("cannot create file for test: %v", err)
+	}
+
+	includeLog, _ := Include("*.log")
+	excludeAllLog, _ := Exclude("*.log")
+	excludeCache, _ := Exclude("cache/")
+	f := New(DefaultIgnoreFile, excludeAllLog, includeLog, excludeCache)
+
+	root, err := f.Root(dir)
+	if err != nil {
+		t.Fatalf("Root() unexpected error = %v", err)
+	}
+	child, err := root.Child("dir_a", path.Join(dir, "dir_a"))
+	if err != nil {
+		t.Fatalf("Child() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		scope     *Scope
+		entryName string
+		isDir     bool
+		want      bool
+	}{
+		{"not matched", root, "file_a", false, false},
+		{"root ignore file", root, "x.tmp", false, true},
+		{"root anchored ignore file", root, "file_b", false, true},
+		{"root anchored ignore file in child", child, "file_b", false, false},
+		{"parent ignore file in child", child, "x.tmp", false, true},
+		{"child ignore file overrides parent", child, "keep.tmp", false, false},
+		{"child ignore file", child, "file_a", false, true},
+		{"filter rules last match wins", child, "debug.log", false, false},
+		{"filter rules directory only", child, "cache", true, true},
+		{"filter rules directory only on file", child, "cache", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.Excluded(tt.entryName, tt.isDir); got != tt.want {
+				t.Errorf("Excluded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilFilter(t *testing.T) {
+	var f *Filter
+	root, err := f.Root("")
+	if err != nil {
+		t.Fatalf("Root() unexpected error = %v", err)
+	}
+	if root.Excluded("file_a", false) {
+		t.Errorf("Excluded() = true, want false")
+	}
+}
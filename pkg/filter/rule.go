@@ -0,0 +1,177 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Rule is an include or exclude pattern with the gitignore syntax:
+//   - a pattern without a slash matches an entry name at any depth,
+//   - a pattern with a leading or middle slash is anchored to the directory of the rule,
+//   - a pattern with a trailing slash only matches directories,
+//   - "*", "?" and "[...]" match inside a path segment, "**" matches any number of segments.
+type Rule struct {
+	pattern  string
+	segments []string
+	exclude  bool
+	dirOnly  bool
+}
+
+// Exclude returns a rule that excludes the entries matching pattern.
+func Exclude(pattern string) (Rule, error) {
+	return newRule(pattern, true)
+}
+
+// Include returns a rule that includes the entries matching pattern, even if they are excluded by a previous rule.
+func Include(pattern string) (Rule, error) {
+	return newRule(pattern, false)
+}
+
+func newRule(pattern string, exclude bool) (Rule, error) {
+	r := Rule{pattern: pattern, exclude: exclude}
+
+	p := pattern
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return Rule{}, fmt.Errorf("invalid pattern %q: empty pattern", pattern)
+	}
+
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	r.segments = strings.Split(p, "/")
+	if !anchored {
+		r.segments = append([]string{"**"}, r.segments...)
+	}
+
+	for _, segment := range r.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return Rule{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return r, nil
+}
+
+// ParseRule parses a line of an ignore file: a pattern excludes the matching entries,
+// a pattern prefixed with "!" includes them again. ok is false for blank lines and comments.
+func ParseRule(line string) (rule Rule, ok bool, err error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Rule{}, false, nil
+	}
+
+	exclude := true
+	if strings.HasPrefix(line, "!") {
+		exclude = false
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+
+	rule, err = newRule(line, exclude)
+	if err != nil {
+		return Rule{}, false, err
+	}
+	return rule, true, nil
+}
+
+// ReadRules parses the rules of an ignore file, one rule per line.
+func ReadRules(r io.Reader) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		rule, ok, err := ParseRule(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// ReadRulesFile parses the rules of the ignore file name.
+func ReadRulesFile(name string) ([]Rule, error) {
+	return readRulesFile(name, openFile)
+}
+
+// openFile is the OpenFunc of the local disk.
+func openFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// readRulesFile parses the rules of the ignore file name opened with open.
+func readRulesFile(name string, open OpenFunc) ([]Rule, error) {
+	f, err := open(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open rules file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	rules, err := ReadRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read rules file %s: %w", name, err)
+	}
+	return rules, nil
+}
+
+// Excluded returns true for an exclude rule and false for an include rule.
+func (r Rule) Excluded() bool {
+	return r.exclude
+}
+
+func (r Rule) String() string {
+	if r.exclude {
+		return r.pattern
+	}
+	return "!" + r.pattern
+}
+
+// Match returns true if the rule matches the entry at relPath, a slash separated path relative to the directory of the rule.
+func (r Rule) Match(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(r.segments, strings.Split(relPath, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// a trailing "**" matches everything inside, but not the directory itself
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
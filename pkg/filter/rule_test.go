@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRule_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		relPath string
+		isDir   bool
+		want    bool
+	}{
+		{"name at root", "file_a", "file_a", false, true},
+		{"name in sub folder", "file_a", "dir_a/file_a", false, true},
+		{"other name", "file_a", "file_b", false, false},
+		{"glob", "*.log", "dir_a/debug.log", false, true},
+		{"glob does not cross segments", "dir_*", "dir_a/file_a", false, false},
+		{"anchored at root", "/file_a", "file_a", false, true},
+		{"anchored not in sub folder", "/file_a", "dir_a/file_a", false, false},
+		{"middle slash is anchored", "dir_a/file_a", "dir_b/dir_a/file_a", false, false},
+		{"directory only on directory", "build/", "build", true, true},
+		{"directory only on file", "build/", "build", false, false},
+		{"leading double star", "**/file_a", "dir_a/dir_b/file_a", false, true},
+		{"middle double star", "dir_a/**/file_a", "dir_a/file_a", false, true},
+		{"middle double star deep", "dir_a/**/file_a", "dir_a/b/c/file_a", false, true},
+		{"trailing double star", "dir_a/**", "dir_a/file_a", false, true},
+		{"trailing double star not the folder", "dir_a/**", "dir_a", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Exclude(tt.pattern)
+			if err != nil {
+				t.Fatalf("Exclude() unexpected error = %v", err)
+			}
+			if got := r.Match(tt.relPath, tt.isDir); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRules(t *testing.T) {
+	content := `# comment
+
+*.log
+!keep.log
+\#file
+[invalid
+`
+	_, err := ReadRules(strings.NewReader(content))
+	if err == nil {
+		t.Fatalf("ReadRules() expected an error for an invalid pattern")
+	}
+
+	rules, err := ReadRules(strings.NewReader(strings.TrimSuffix(content, "[invalid\n")))
+	if err != nil {
+		t.Fatalf("ReadRules() unexpected error = %v", err)
+	}
+	want := []string{"*.log", "!keep.log", "#file"}
+	if len(rules) != len(want) {
+		t.Fatalf("ReadRules() got %v rules, want %v", len(rules), len(want))
+	}
+	for i, r := range rules {
+		if r.String() != want[i] {
+			t.Errorf("ReadRules() rule %d = %v, want %v", i, r, want[i])
+		}
+	}
+}
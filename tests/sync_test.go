@@ -24,7 +24,7 @@ func Test_syncFolderA(t *testing.T) {
 	ds := directory.NewSynchronizer(sourceA, dest)
 
 	//act
-	err := ds.Sync()
+	report, err := ds.Sync()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -38,6 +38,9 @@ func Test_syncFolderA(t *testing.T) {
 	if len(destEntries) != 3 {
 		t.Fatalf("expected 3 file got %v file(s)", len(destEntries))
 	}
+	if report.FilesCopied != 3 {
+		t.Fatalf("expected 3 files copied in the report got %v", report.FilesCopied)
+	}
 	err = folderMustContains(dest, []string{dest, path.Join(dest, "file_a"), path.Join(dest, "file_b"), path.Join(dest, "file_c")})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -51,11 +54,11 @@ func Test_syncFolderAThenB(t *testing.T) {
 	ds2 := directory.NewSynchronizer(sourceB, dest)
 
 	//act
-	err := ds.Sync()
+	_, err := ds.Sync()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	err = ds2.Sync()
+	_, err = ds2.Sync()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -82,11 +85,11 @@ func Test_syncFolderBThenC(t *testing.T) {
 	ds2 := directory.NewSynchronizer(sourceC, dest)
 
 	//act
-	err := ds.Sync()
+	_, err := ds.Sync()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	err = ds2.Sync()
+	_, err = ds2.Sync()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -117,7 +120,7 @@ func Test_syncWithFolderNameLikeFiles(t *testing.T) {
 	}
 
 	//act
-	err = ds.Sync()
+	_, err = ds.Sync()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -153,7 +156,7 @@ func Test_syncWithFileNameLikeFolder(t *testing.T) {
 	}
 
 	//act
-	err = ds.Sync()
+	_, err = ds.Sync()
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -174,6 +177,47 @@ func Test_syncWithFileNameLikeFolder(t *testing.T) {
 	}
 }
 
+func Test_syncPropagatesChanges(t *testing.T) {
+	//setup
+	defer os.RemoveAll(dest)
+	source, err := os.MkdirTemp(os.TempDir(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(source)
+
+	err = os.WriteFile(path.Join(source, "file_a"), []byte("first version"), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ds := directory.NewSynchronizer(source, dest)
+	_, err = ds.Sync()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = os.WriteFile(path.Join(source, "file_a"), []byte("second version"), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//act
+	ds2 := directory.NewSynchronizer(source, dest)
+	_, err = ds2.Sync()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	//verify
+	content, err := os.ReadFile(path.Join(dest, "file_a"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(content) != "second version" {
+		t.Fatalf("expected file_a to contain %q got %q", "second version", content)
+	}
+}
+
 func folderMustContains(folderPath string, expected []string) error {
 	files := make([]string, 0)
 	err := filepath.Walk(folderPath, func(path string, info fs.FileInfo, err error) error {